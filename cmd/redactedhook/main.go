@@ -4,11 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -27,7 +29,11 @@ var (
 
 const (
 	path              = "/hook"
+	previewPath       = "/hook/preview"
 	healthPath        = "/healthz"
+	statsPath         = "/stats"
+	cacheClearPath    = "/cache/clear"
+	maintenancePath   = "/maintenance"
 	tokenLength       = 16
 	shutdownTimeout   = 10 * time.Second
 	readTimeout       = 10 * time.Second
@@ -63,7 +69,7 @@ func printHelp() {
 
 func parseFlags() (string, bool) {
 	var configPath string
-	flag.StringVar(&configPath, "config", defaultConfigPath, "Path to the configuration file")
+	flag.StringVar(&configPath, "config", getEnv("CONFIG", defaultConfigPath), "Path to the configuration file, or a comma-separated list of files merged in order")
 	flag.Parse()
 
 	if len(flag.Args()) > 0 {
@@ -98,19 +104,19 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// hasRequiredEnvVars reports whether the environment alone is enough to run
+// without a config file: an API token and at least one indexer API key.
 func hasRequiredEnvVars() bool {
-	essentialVars := []string{
-		"API_TOKEN",
-		"RED_APIKEY",
-		"OPS_APIKEY",
+	if _, exists := os.LookupEnv(envPrefix + "API_TOKEN"); !exists {
+		return false
 	}
 
-	for _, v := range essentialVars {
-		if _, exists := os.LookupEnv(envPrefix + v); !exists {
-			return false
+	for _, v := range []string{"RED_APIKEY", "OPS_APIKEY"} {
+		if _, exists := os.LookupEnv(envPrefix + v); exists {
+			return true
 		}
 	}
-	return true
+	return false
 }
 
 func initLogger() {
@@ -162,43 +168,6 @@ func startHTTPServer(ctx context.Context, address string) error {
 	return nil
 }
 
-func loadEnvironmentConfig() {
-	// Server settings
-	config.GetConfig().Server.Host = getEnv("HOST", config.GetConfig().Server.Host)
-	if port := getEnv("PORT", ""); port != "" {
-		if val, err := fmt.Sscanf(port, "%d", &config.GetConfig().Server.Port); err != nil || val != 1 {
-			log.Warn().Msgf("Invalid PORT value: %s", port)
-		}
-	}
-
-	// Authorization settings
-	config.GetConfig().Authorization.APIToken = getEnv("API_TOKEN", config.GetConfig().Authorization.APIToken)
-	config.GetConfig().IndexerKeys.REDKey = getEnv("RED_APIKEY", config.GetConfig().IndexerKeys.REDKey)
-	config.GetConfig().IndexerKeys.OPSKey = getEnv("OPS_APIKEY", config.GetConfig().IndexerKeys.OPSKey)
-
-	// Logs settings
-	config.GetConfig().Logs.LogLevel = getEnv("LOGS_LOGLEVEL", config.GetConfig().Logs.LogLevel)
-	config.GetConfig().Logs.LogToFile = getEnv("LOGS_LOGTOFILE", "") == "true"
-	config.GetConfig().Logs.LogFilePath = getEnv("LOGS_LOGFILEPATH", config.GetConfig().Logs.LogFilePath)
-
-	if maxSize := getEnv("LOGS_MAXSIZE", ""); maxSize != "" {
-		if val, err := fmt.Sscanf(maxSize, "%d", &config.GetConfig().Logs.MaxSize); err != nil || val != 1 {
-			log.Warn().Msgf("Invalid LOGS_MAXSIZE value: %s", maxSize)
-		}
-	}
-	if maxBackups := getEnv("LOGS_MAXBACKUPS", ""); maxBackups != "" {
-		if val, err := fmt.Sscanf(maxBackups, "%d", &config.GetConfig().Logs.MaxBackups); err != nil || val != 1 {
-			log.Warn().Msgf("Invalid LOGS_MAXBACKUPS value: %s", maxBackups)
-		}
-	}
-	if maxAge := getEnv("LOGS_MAXAGE", ""); maxAge != "" {
-		if val, err := fmt.Sscanf(maxAge, "%d", &config.GetConfig().Logs.MaxAge); err != nil || val != 1 {
-			log.Warn().Msgf("Invalid LOGS_MAXAGE value: %s", maxAge)
-		}
-	}
-	config.GetConfig().Logs.Compress = getEnv("LOGS_COMPRESS", "") == "true"
-}
-
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	log.Info().
 		Str("method", r.Method).
@@ -206,12 +175,82 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		Str("user_agent", r.UserAgent()).
 		Msg("Health check request received")
 
+	// A degraded tracker is not a problem with this service, so the status
+	// stays 200 and container health checks don't restart it.
+	body := "OK"
+	var degraded []string
+	for _, status := range api.IndexerStatuses(time.Now()) {
+		if status.Degraded {
+			degraded = append(degraded, status.Indexer)
+		}
+	}
+	if len(degraded) > 0 {
+		body = "DEGRADED: " + strings.Join(degraded, ", ")
+	}
+
 	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte("OK")); err != nil {
+	if _, err := w.Write([]byte(body)); err != nil {
 		log.Error().Err(err).Msg("Failed to write health check response")
 	}
 }
 
+// statsHandler reports the tracker API health and rate limiter state of
+// every indexer, and the decision and fetch latencies, as JSON.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	response := struct {
+		Indexers []api.IndexerStatus `json:"indexers"`
+		Limiters []api.LimiterStatus `json:"limiters"`
+		Latency  []api.LatencyStatus `json:"latency"`
+	}{Indexers: api.IndexerStatuses(time.Now()), Limiters: api.LimiterStatuses(), Latency: api.LatencyStatuses()}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().Err(err).Msg("Failed to write stats response")
+	}
+}
+
+// endpoint describes a route for the root and not found responses.
+type endpoint struct {
+	Path        string `json:"path"`
+	Method      string `json:"method"`
+	Description string `json:"description"`
+}
+
+var endpoints = []endpoint{
+	{path, http.MethodPost, "Check a release against the requested filters"},
+	{previewPath, http.MethodPost, "Show how a release does on each filter without acting on it"},
+	{cacheClearPath, http.MethodPost, "Clear cached tracker responses"},
+	{maintenancePath, http.MethodPost, "Show or set maintenance mode"},
+	{healthPath, http.MethodGet, "Health check"},
+	{statsPath, http.MethodGet, "Last successful and failed tracker API call, rate limiter state and latency per indexer"},
+}
+
+// rootHandler answers requests for paths no other handler matched. The root
+// itself gets a short description of the service, anything else a 404, both
+// listing the endpoints so a curl of the base URL shows what to call.
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	response := struct {
+		Service   string     `json:"service,omitempty"`
+		Error     string     `json:"error,omitempty"`
+		Endpoints []endpoint `json:"endpoints"`
+	}{Endpoints: endpoints}
+
+	status := http.StatusOK
+	if r.URL.Path == "/" {
+		response.Service = "redactedhook"
+	} else {
+		status = http.StatusNotFound
+		response.Error = fmt.Sprintf("no endpoint at %s", r.URL.Path)
+		log.Debug().Str("remote_addr", r.RemoteAddr).Msgf("Request for unknown path %s", r.URL.Path)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().Err(err).Msg("Failed to write root response")
+	}
+}
+
 func performHealthCheck() {
 	host := "127.0.0.1"
 	port := 42135
@@ -249,38 +288,50 @@ func main() {
 		return
 	}
 
-	// Initialize with default values
-	config.GetConfig().Server.Host = "127.0.0.1"
-	config.GetConfig().Server.Port = 42135
-	config.GetConfig().Logs.LogLevel = "info"
-	config.GetConfig().Logs.MaxSize = 100 // 100MB
-	config.GetConfig().Logs.MaxBackups = 3
-	config.GetConfig().Logs.MaxAge = 28 // 28 days
-	config.GetConfig().Logs.LogFilePath = "redactedhook.log"
-
-	// Try to load config file if it exists
+	// A config file is optional when the required environment variables are set
 	configFileExists := false
-	if _, err := os.Stat(configPath); err == nil {
-		config.InitConfig(configPath)
-		configFileExists = true
+	if paths := config.SplitConfigPaths(configPath); len(paths) > 0 {
+		if _, err := os.Stat(paths[0]); err == nil {
+			configFileExists = true
+		}
 	}
 
-	// If no config file and no environment variables, exit
 	if !configFileExists && !hasRequiredEnvVars() {
-		log.Fatal().Msgf("No config file found and required environment variables are not set. Please provide either a config file or set the required environment variables (%s{API_TOKEN,RED_APIKEY,OPS_APIKEY})",
-			envPrefix)
+		log.Fatal().Msgf("No config file found and required environment variables are not set. Please provide either a config file or set the required environment variables (%sAPI_TOKEN and %sRED_APIKEY and/or %sOPS_APIKEY)",
+			envPrefix, envPrefix, envPrefix)
 	}
 
-	// Load environment variables (these will override config file values if present)
-	loadEnvironmentConfig()
+	// Environment variables override the config files, on every reload too
+	config.InitConfig(configPath)
 
 	// Validate the final configuration
 	if err := config.ValidateConfig(); err != nil {
 		log.Fatal().Err(err).Msg("Invalid configuration")
 	}
+	if err := api.ValidateConfig(config.GetConfig()); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+
+	log.Info().Msgf("Effective config: %s", config.GetConfig().RedactedString())
+
+	if err := api.StartAnalytics(config.GetConfig().Analytics.SQLitePath); err != nil {
+		log.Fatal().Err(err).Msg("Failed to start analytics")
+	}
+	defer api.StopAnalytics()
+
+	api.StartRatioPoll(config.GetConfig().Ratio.PollInterval)
+	defer api.StopRatioPoll()
+
+	api.StartLimiterLog(config.GetConfig().API.LimiterLogInterval)
+	defer api.StopLimiterLog()
 
 	http.HandleFunc(path, api.WebhookHandler)
+	http.HandleFunc(previewPath, api.PreviewHandler)
 	http.HandleFunc(healthPath, healthHandler)
+	http.HandleFunc(statsPath, statsHandler)
+	http.HandleFunc(cacheClearPath, api.CacheClearHandler)
+	http.HandleFunc(maintenancePath, api.MaintenanceHandler)
+	http.HandleFunc("/", rootHandler)
 
 	address := fmt.Sprintf("%s:%d", config.GetConfig().Server.Host, config.GetConfig().Server.Port)
 
@@ -1,12 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
-
-	"github.com/s0up4200/redactedhook/internal/config"
 )
 
 func TestGenerateAPIToken(t *testing.T) {
@@ -75,11 +74,19 @@ func TestHasRequiredEnvVars(t *testing.T) {
 			expected: true,
 		},
 		{
-			name: "missing one required var",
+			name: "only one indexer key",
 			envVars: map[string]string{
 				envPrefix + "API_TOKEN":  "token",
 				envPrefix + "RED_APIKEY": "red",
 			},
+			expected: true,
+		},
+		{
+			name: "missing api token",
+			envVars: map[string]string{
+				envPrefix + "RED_APIKEY": "red",
+				envPrefix + "OPS_APIKEY": "ops",
+			},
 			expected: false,
 		},
 		{
@@ -106,74 +113,6 @@ func TestHasRequiredEnvVars(t *testing.T) {
 	}
 }
 
-func TestLoadEnvironmentConfig(t *testing.T) {
-	// Save original config
-	originalConfig := config.GetConfig()
-	defer func() {
-		// Restore original config after test
-		config.GetConfig().Server = originalConfig.Server
-		config.GetConfig().Authorization = originalConfig.Authorization
-		config.GetConfig().IndexerKeys = originalConfig.IndexerKeys
-		config.GetConfig().Logs = originalConfig.Logs
-	}()
-
-	tests := []struct {
-		name  string
-		env   map[string]string
-		check func(t *testing.T)
-	}{
-		{
-			name: "server settings",
-			env: map[string]string{
-				envPrefix + "HOST": "0.0.0.0",
-				envPrefix + "PORT": "8080",
-			},
-			check: func(t *testing.T) {
-				if config.GetConfig().Server.Host != "0.0.0.0" {
-					t.Errorf("Host = %v, want %v", config.GetConfig().Server.Host, "0.0.0.0")
-				}
-				if config.GetConfig().Server.Port != 8080 {
-					t.Errorf("Port = %v, want %v", config.GetConfig().Server.Port, 8080)
-				}
-			},
-		},
-		{
-			name: "authorization settings",
-			env: map[string]string{
-				envPrefix + "API_TOKEN":  "test-token",
-				envPrefix + "RED_APIKEY": "red-key",
-				envPrefix + "OPS_APIKEY": "ops-key",
-			},
-			check: func(t *testing.T) {
-				if config.GetConfig().Authorization.APIToken != "test-token" {
-					t.Errorf("APIToken = %v, want %v", config.GetConfig().Authorization.APIToken, "test-token")
-				}
-				if config.GetConfig().IndexerKeys.REDKey != "red-key" {
-					t.Errorf("REDKey = %v, want %v", config.GetConfig().IndexerKeys.REDKey, "red-key")
-				}
-				if config.GetConfig().IndexerKeys.OPSKey != "ops-key" {
-					t.Errorf("OPSKey = %v, want %v", config.GetConfig().IndexerKeys.OPSKey, "ops-key")
-				}
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Clear environment before each test
-			os.Clearenv()
-
-			// Set test environment variables
-			for k, v := range tt.env {
-				os.Setenv(k, v)
-			}
-
-			loadEnvironmentConfig()
-			tt.check(t)
-		})
-	}
-}
-
 func TestCreateServer(t *testing.T) {
 	address := "localhost:8080"
 	server := createServer(address)
@@ -219,3 +158,67 @@ func TestHealthHandler(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+func TestRootHandler(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantError  bool
+	}{
+		{"/", http.StatusOK, false},
+		{"/hooks", http.StatusNotFound, true},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		rootHandler(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, rr.Code, tt.wantStatus)
+		}
+
+		var body struct {
+			Error     string     `json:"error"`
+			Endpoints []endpoint `json:"endpoints"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: body is not JSON: %v", tt.path, err)
+		}
+		if (body.Error != "") != tt.wantError {
+			t.Errorf("%s: error = %q, want an error: %t", tt.path, body.Error, tt.wantError)
+		}
+		if len(body.Endpoints) != len(endpoints) {
+			t.Errorf("%s: listed %d endpoints, want %d", tt.path, len(body.Endpoints), len(endpoints))
+		}
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	statsHandler(rr, httptest.NewRequest(http.MethodGet, statsPath, nil))
+
+	var body struct {
+		Indexers []struct {
+			Indexer string `json:"indexer"`
+		} `json:"indexers"`
+		Limiters []struct {
+			Indexer string `json:"indexer"`
+			Burst   int    `json:"burst"`
+		} `json:"limiters"`
+		Latency []struct {
+			Stage string `json:"stage"`
+		} `json:"latency"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if len(body.Indexers) != 2 || body.Indexers[0].Indexer != "ops" || body.Indexers[1].Indexer != "redacted" {
+		t.Errorf("indexers = %+v, want ops and redacted", body.Indexers)
+	}
+	if len(body.Limiters) != 2 || body.Limiters[0].Burst == 0 {
+		t.Errorf("limiters = %+v, want ops and redacted", body.Limiters)
+	}
+	if len(body.Latency) == 0 || body.Latency[0].Stage != "decision" {
+		t.Errorf("latency = %+v, want the decision stage first", body.Latency)
+	}
+}
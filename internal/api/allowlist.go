@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// clientIP returns the address the request came from. When the direct peer
+// is one of trusted, X-Forwarded-For is read from the right and the first
+// address that is not a trusted proxy is the client. It returns an invalid
+// address when RemoteAddr can't be parsed.
+func clientIP(r *http.Request, trusted []netip.Prefix) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr = addr.Unmap()
+
+	if !inPrefixes(addr, trusted) {
+		return addr
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// A hop we can't read ends the chain we can trust.
+			break
+		}
+		addr = hop.Unmap()
+		if !inPrefixes(addr, trusted) {
+			break
+		}
+	}
+	return addr
+}
+
+func inPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceAllowed reports whether the request comes from one of
+// server.allowed_ips. An empty list allows every source. When it refuses
+// the request, it answers it with 403.
+func sourceAllowed(w http.ResponseWriter, r *http.Request, cfg *config.Config) bool {
+	if len(cfg.AllowedIPs) == 0 {
+		return true
+	}
+
+	addr := clientIP(r, cfg.TrustedProxies)
+	if addr.IsValid() && inPrefixes(addr, cfg.AllowedIPs) {
+		return true
+	}
+
+	log.Warn().Str("remote_addr", r.RemoteAddr).Msgf("Refusing request from %s, not in allowed_ips", addr)
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	return false
+}
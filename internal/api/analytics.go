@@ -0,0 +1,179 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite" // Pure Go SQLite driver, registered as "sqlite"
+)
+
+const (
+	analyticsBatchSize     = 100
+	analyticsFlushInterval = 5 * time.Second
+	analyticsQueueSize     = 1000 // Decisions are dropped when this many are waiting
+)
+
+const analyticsSchema = `
+CREATE TABLE IF NOT EXISTS decisions (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp  TEXT    NOT NULL,
+	request_id TEXT    NOT NULL,
+	indexer    TEXT    NOT NULL,
+	torrent_id INTEGER NOT NULL,
+	approved   INTEGER NOT NULL,
+	status     INTEGER NOT NULL,
+	reason     TEXT    NOT NULL,
+	format     TEXT    NOT NULL,
+	encoding   TEXT    NOT NULL,
+	media      TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS decisions_timestamp ON decisions (timestamp);
+`
+
+// analyticsRow is a decision plus the release details worth querying on.
+// The release details are empty when no filter fetched the torrent.
+type analyticsRow struct {
+	decision Decision
+	format   string
+	encoding string
+	media    string
+}
+
+// analyticsWriter inserts decisions into SQLite in batches from a single
+// goroutine, so recording a decision never waits on the database.
+type analyticsWriter struct {
+	db   *sql.DB
+	rows chan analyticsRow
+	done chan struct{}
+}
+
+var analytics atomic.Pointer[analyticsWriter]
+
+// StartAnalytics opens or creates the SQLite database at path and starts
+// persisting every decision to it. An empty path leaves analytics disabled.
+func StartAnalytics(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("opening analytics database %s: %w", path, err)
+	}
+	// A single connection serializes writes, which SQLite requires anyway.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(analyticsSchema); err != nil {
+		db.Close()
+		return fmt.Errorf("creating analytics schema in %s: %w", path, err)
+	}
+
+	writer := &analyticsWriter{
+		db:   db,
+		rows: make(chan analyticsRow, analyticsQueueSize),
+		done: make(chan struct{}),
+	}
+	analytics.Store(writer)
+	go writer.run()
+
+	log.Info().Msgf("Writing decision analytics to %s", path)
+	return nil
+}
+
+// StopAnalytics writes the decisions still queued and closes the database.
+func StopAnalytics() {
+	writer := analytics.Swap(nil)
+	if writer == nil {
+		return
+	}
+
+	close(writer.rows)
+	<-writer.done
+	if err := writer.db.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close analytics database")
+	}
+}
+
+// recordAnalytics queues a decision for the analytics database. It never
+// blocks: when the queue is full the decision is dropped with a warning.
+func recordAnalytics(decision Decision, torrent *TorrentData) {
+	writer := analytics.Load()
+	if writer == nil {
+		return
+	}
+
+	row := analyticsRow{decision: decision}
+	if torrent != nil {
+		row.format = torrent.Format
+		row.encoding = torrent.Encoding
+		row.media = torrent.Media
+	}
+
+	select {
+	case writer.rows <- row:
+	default:
+		log.Warn().Str("request_id", decision.RequestID).Msg("Analytics queue is full, dropping decision")
+	}
+}
+
+func (w *analyticsWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(analyticsFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]analyticsRow, 0, analyticsBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.insert(batch); err != nil {
+			log.Error().Err(err).Msgf("Failed to write %d decisions to the analytics database", len(batch))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case row, ok := <-w.rows:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) >= analyticsBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (w *analyticsWriter) insert(batch []analyticsRow) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO decisions
+		(timestamp, request_id, indexer, torrent_id, approved, status, reason, format, encoding, media)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range batch {
+		d := row.decision
+		if _, err := stmt.Exec(d.Timestamp.Format(time.RFC3339), d.RequestID, d.Indexer, d.TorrentID, d.Approved, d.Status, d.Reason, row.format, row.encoding, row.media); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -1,7 +1,29 @@
 package api
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/inhies/go-bytesize"
+	"golang.org/x/time/rate"
+
+	"github.com/s0up4200/redactedhook/internal/config"
 )
 
 func TestValidateRequestData(t *testing.T) {
@@ -29,8 +51,8 @@ func TestValidateRequestData(t *testing.T) {
 				MinRatio:    1.0,
 				MinSize:     0,
 				MaxSize:     10,
-				Uploaders:   "uploader1",
-				RecordLabel: "label1",
+				Uploaders:   listField{"uploader1"},
+				RecordLabel: listField{"label1"},
 				Mode:        "blacklist",
 			},
 			wantErr: false,
@@ -104,7 +126,7 @@ func TestValidateRequestData(t *testing.T) {
 			name: "Valid RecordLabel with special characters",
 			request: RequestData{
 				Indexer:     "ops",
-				RecordLabel: "label1 & label2 - label3",
+				RecordLabel: listField{"label1 & label2 - label3"},
 				OPSKey:      "validkey123",
 			},
 			wantErr: false,
@@ -114,17 +136,39 @@ func TestValidateRequestData(t *testing.T) {
 			name: "Empty mode with uploaders",
 			request: RequestData{
 				Indexer:   "ops",
-				Uploaders: "uploader1",
+				Uploaders: listField{"uploader1"},
 				OPSKey:    "validkey123",
 			},
 			wantErr: true,
 			errMsg:  "mode must be either 'whitelist' or 'blacklist', got ''",
 		},
+		{
+			name: "MinLeechers greater than MaxLeechers",
+			request: RequestData{
+				Indexer:     "ops",
+				MinLeechers: 10,
+				MaxLeechers: 5,
+				OPSKey:      "validkey123",
+			},
+			wantErr: true,
+			errMsg:  "minLeechers cannot be greater than maxLeechers",
+		},
+		{
+			name: "MinSize greater than MaxSize",
+			request: RequestData{
+				Indexer: "ops",
+				MinSize: 500 * bytesize.MB,
+				MaxSize: 100 * bytesize.MB,
+				OPSKey:  "validkey123",
+			},
+			wantErr: true,
+			errMsg:  "minsize 500.00MB cannot be greater than maxsize 100.00MB, no torrent could pass",
+		},
 		{
 			name: "Empty RecordLabel field",
 			request: RequestData{
 				Indexer:     "ops",
-				RecordLabel: "",
+				RecordLabel: nil,
 				OPSKey:      "validkey123",
 			},
 			wantErr: false,
@@ -145,3 +189,3260 @@ func TestValidateRequestData(t *testing.T) {
 		})
 	}
 }
+
+func TestResponseDataTorrentShapes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		fixture string
+		missing bool
+	}{
+		{name: "Single torrent object", fixture: "torrent_object.json"},
+		{name: "Torrent array", fixture: "torrent_array.json"},
+		{name: "Group torrents array", fixture: "torrent_group_array.json"},
+		{name: "Array with another torrent", fixture: "torrent_array_mismatch.json", missing: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+
+			var responseData ResponseData
+			if err := json.Unmarshal(data, &responseData); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+
+			responseData.Response.selectTorrent(123)
+			torrent := responseData.Response.Torrent
+			if tt.missing {
+				if torrent != nil {
+					t.Errorf("selected torrent = %+v, want none", *torrent)
+				}
+				return
+			}
+			if torrent == nil {
+				t.Fatal("Torrent is nil after selectTorrent")
+			}
+			if torrent.ID != 123 || torrent.Username != "uploader1" || torrent.Size != 314572800 {
+				t.Errorf("selected torrent = %+v, want ID 123 from uploader1", *torrent)
+			}
+		})
+	}
+}
+
+func TestPolicyRejectionsNeverReturn5xx(t *testing.T) {
+	t.Parallel()
+
+	reasons := make(map[string]struct{})
+	for reason := range rejectStatusCodes {
+		reasons[reason] = struct{}{}
+	}
+	for _, hook := range hookDefinitions {
+		reasons[hook.reason] = struct{}{}
+	}
+
+	for reason := range reasons {
+		recorder := httptest.NewRecorder()
+		handleErrors(recorder, reject(reason))
+
+		if recorder.Code >= http.StatusInternalServerError {
+			t.Errorf("rejection %q returned status %d, want a non-5xx code", reason, recorder.Code)
+		}
+		if recorder.Code < http.StatusIMUsed || recorder.Code >= http.StatusMultipleChoices {
+			t.Errorf("rejection %q returned status %d, want a code in the StatusIMUsed+N range", reason, recorder.Code)
+		}
+	}
+}
+
+func TestInfrastructureErrorsReturn5xx(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+	handleErrors(recorder, errors.New("error fetching torrent data for ID 1: HTTP error: 502"))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("infrastructure error returned status %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRequestDataFieldAliases(t *testing.T) {
+	t.Parallel()
+
+	payload := `{"indexer": "ops", "torrentId": 123, "min_ratio": 1.5, "record_label": "label1", "minratio": 0.8}`
+
+	var requestData RequestData
+	if err := json.Unmarshal([]byte(payload), &requestData); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if requestData.TorrentID != 123 {
+		t.Errorf("TorrentID = %d, want 123", requestData.TorrentID)
+	}
+	if !slices.Equal(requestData.RecordLabel, listField{"label1"}) {
+		t.Errorf("RecordLabel = %q, want %q", requestData.RecordLabel, "label1")
+	}
+	if requestData.MinRatio != 0.8 {
+		t.Errorf("MinRatio = %v, want canonical value 0.8", requestData.MinRatio)
+	}
+}
+
+func TestRequestDataListFields(t *testing.T) {
+	t.Parallel()
+
+	payload := `{"indexer": "ops", "uploaders": ["user1", "user2"], "labels": ["Sony Music, Inc."], "block_labels": "label b,label c"}`
+
+	var requestData RequestData
+	if err := json.Unmarshal([]byte(payload), &requestData); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if want := (listField{"user1", "user2"}); !slices.Equal(requestData.Uploaders, want) {
+		t.Errorf("Uploaders = %q, want %q", requestData.Uploaders, want)
+	}
+	if want := (listField{"Sony Music, Inc."}); !slices.Equal(requestData.RecordLabel, want) {
+		t.Errorf("RecordLabel = %q, want the array entry kept whole as %q", requestData.RecordLabel, want)
+	}
+	if want := (listField{"label b", "label c"}); !slices.Equal(requestData.BlockLabels, want) {
+		t.Errorf("BlockLabels = %q, want the comma-separated string split into %q", requestData.BlockLabels, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"uploaders": [1, 2]}`), &requestData); err == nil {
+		t.Error("json.Unmarshal() accepted an array of numbers for uploaders")
+	}
+}
+
+func TestApplyDefaultIndexer(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Server: config.Server{DefaultIndexer: "redacted"}}
+
+	tests := []struct {
+		name    string
+		indexer string
+		want    string
+	}{
+		{name: "Empty indexer uses default", indexer: "", want: "redacted"},
+		{name: "Explicit indexer is kept", indexer: "ops", want: "ops"},
+		{name: "Invalid indexer is kept", indexer: "invalid", want: "invalid"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			requestData := RequestData{Indexer: tt.indexer}
+			applyDefaultIndexer(&requestData, cfg)
+			if requestData.Indexer != tt.want {
+				t.Errorf("applyDefaultIndexer() indexer = %q, want %q", requestData.Indexer, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerIndexerCasing(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{name: "Redacted capitalized", payload: `{"indexer": "Redacted", "red_apikey": "key"}`},
+		{name: "Redacted uppercase", payload: `{"indexer": "REDACTED", "red_apikey": "key"}`},
+		{name: "OPS uppercase", payload: `{"indexer": "OPS", "ops_apikey": "key"}`},
+		{name: "Ops mixed case with spaces", payload: `{"indexer": " Ops ", "ops_apikey": "key"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, http.StatusOK, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMatchInListGlob(t *testing.T) {
+	t.Parallel()
+
+	patterns := parseAndTrimList(splitList("RED*, *Bot, lab?l"))
+
+	tests := []struct {
+		name  string
+		value string
+		glob  bool
+		want  bool
+	}{
+		{name: "Prefix match", value: "redbird", glob: true, want: true},
+		{name: "Suffix match", value: "uploadbot", glob: true, want: true},
+		{name: "Single character match", value: "label", glob: true, want: true},
+		{name: "No match", value: "someone", glob: true, want: false},
+		{name: "Slash is not special", value: "red/records", glob: true, want: true},
+		{name: "Glob disabled uses exact match", value: "redbird", glob: false, want: false},
+		{name: "Glob disabled matches literal pattern", value: "red*", glob: false, want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := matchInList(tt.value, patterns, tt.glob); got != tt.want {
+				t.Errorf("matchInList(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploaderGlobModes(t *testing.T) {
+	t.Parallel()
+
+	patterns := parseAndTrimList(splitList("RED*,*bot"))
+
+	tests := []struct {
+		name     string
+		mode     string
+		uploader string
+		allowed  bool
+	}{
+		{name: "Blacklist rejects glob match", mode: "blacklist", uploader: "redbird", allowed: false},
+		{name: "Blacklist allows non-match", mode: "blacklist", uploader: "someone", allowed: true},
+		{name: "Whitelist allows glob match", mode: "whitelist", uploader: "helperbot", allowed: true},
+		{name: "Whitelist rejects non-match", mode: "whitelist", uploader: "someone", allowed: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if allowed := uploaderAllowed(tt.uploader, patterns, tt.mode, true); allowed != tt.allowed {
+				t.Errorf("uploader %q in %s mode allowed = %v, want %v", tt.uploader, tt.mode, allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestWaitJitter(t *testing.T) {
+	t.Parallel()
+
+	if err := waitJitter(context.Background(), 0); err != nil {
+		t.Errorf("waitJitter() with zero delay error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := waitJitter(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("waitJitter() error = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("waitJitter() did not respect the cancelled context")
+	}
+}
+
+func TestLimitedBodyReader(t *testing.T) {
+	t.Parallel()
+
+	payload := `{"status": "success", "response": {"username": "user"}}`
+
+	var responseData ResponseData
+	body := &limitedBodyReader{reader: strings.NewReader(payload), remaining: int64(len(payload))}
+	if err := json.NewDecoder(body).Decode(&responseData); err != nil {
+		t.Fatalf("Decode() with exact size limit error = %v", err)
+	}
+	if responseData.Response.Username != "user" {
+		t.Errorf("Username = %q, want %q", responseData.Response.Username, "user")
+	}
+
+	body = &limitedBodyReader{reader: strings.NewReader(payload), remaining: 10}
+	if err := json.NewDecoder(body).Decode(&responseData); !errors.Is(err, errResponseTooLarge) {
+		t.Errorf("Decode() over size limit error = %v, want %v", err, errResponseTooLarge)
+	}
+}
+
+func TestReleaseMetadata(t *testing.T) {
+	t.Parallel()
+
+	var responseData ResponseData
+	responseData.Response.Group.Year = 2018
+	responseData.Response.Group.RecordLabel = "Original Records"
+	responseData.Response.Torrent = &TorrentData{
+		RecordLabel:     "Reissue &amp; Co",
+		CatalogueNumber: " ",
+	}
+
+	values := releaseMetadata(&responseData)
+
+	if got := values[config.MetadataRecordLabel]; got != "Reissue & Co" {
+		t.Errorf("record_label = %q, want remaster label %q", got, "Reissue & Co")
+	}
+	if got := values[config.MetadataYear]; got != "2018" {
+		t.Errorf("year = %q, want group year %q", got, "2018")
+	}
+	if got := values[config.MetadataCatalogueNumber]; got != "" {
+		t.Errorf("catalogue_number = %q, want empty", got)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		timeoutSeconds int
+		want           time.Duration
+	}{
+		{name: "Falls back to default", timeoutSeconds: 0, want: defaultRequestTimeout},
+		{name: "Per-request override", timeoutSeconds: 20, want: 20 * time.Second},
+		{name: "Clamped to maximum", timeoutSeconds: 600, want: maxRequestTimeout},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			requestData := RequestData{Indexer: "ops", TimeoutSeconds: tt.timeoutSeconds}
+			if got := requestTimeout(&requestData); got != tt.want {
+				t.Errorf("requestTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerMockIndexer(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.Server.RejectHeaders = true
+
+	tests := []struct {
+		name        string
+		payload     string
+		wantStatus  int
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "Uploader whitelisted",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1", "mode": "whitelist"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Uploader blacklisted",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1", "mode": "blacklist"}`,
+			wantStatus: StatusUploaderNotAllowed,
+			wantHeaders: map[string]string{
+				"X-Reject-Reason": "uploader",
+				"X-Reject-Detail": ErrUploaderNotAllowed,
+			},
+		},
+		{
+			name:       "Reject headers for every collected reason",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "maxsize": "1MB", "uploaders": "uploader1", "mode": "blacklist", "collect_all_reasons": true}`,
+			wantStatus: StatusSizeNotAllowed,
+			wantHeaders: map[string]string{
+				"X-Reject-Reason": "size,uploader",
+				"X-Reject-Detail": ErrSizeNotAllowed + "; " + ErrUploaderNotAllowed,
+			},
+		},
+		{
+			name:       "Ratio below minimum",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "minratio": 2.0}`,
+			wantStatus: StatusRatioNotAllowed,
+		},
+		{
+			name:       "Ratio skipped on freeleech",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "red_user_id": 1, "minratio": 2.0, "skip_ratio_on_freeleech": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Ratio not skipped without freeleech",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "minratio": 2.0, "skip_ratio_on_freeleech": true}`,
+			wantStatus: StatusRatioNotAllowed,
+		},
+		{
+			name:       "Release headers on approval",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "minsize": "1MB"}`,
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"X-Release-Size":     "314572800",
+				"X-Release-Uploader": "uploader1",
+			},
+		},
+		{
+			name:       "Label allowed",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_labels": "Example Records, Other Records"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Block label wins over allow",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_labels": "Example Records", "block_labels": "example records"}`,
+			wantStatus: StatusLabelNotAllowed,
+		},
+		{
+			name:       "Label not in allow list",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_labels": "Other Records"}`,
+			wantStatus: StatusLabelNotAllowed,
+		},
+		{
+			name:       "Allow label with non-breaking space",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_labels": "Example\u00a0Records"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Uploader whitelisted with zero width space",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1\u200b", "mode": "whitelist"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Allow label still different",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_labels": "Exämple Records"}`,
+			wantStatus: StatusLabelNotAllowed,
+		},
+		{
+			name:       "Description excludes keyword",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "description_excludes": "advance, promo"}`,
+			wantStatus: StatusDescription,
+		},
+		{
+			name:       "Description contains keyword",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "description_contains": "copy & scanned"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Required ratio kept",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "respect_required_ratio": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Download drops below required ratio",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 2, "respect_required_ratio": true}`,
+			wantStatus: StatusRequiredRatio,
+		},
+		{
+			name:       "Featured flag not reported",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "require_featured": true}`,
+			wantStatus: StatusNotFeatured,
+		},
+		{
+			name:       "Torrent name matches release",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "torrentname": "Example Artist - Example Album [2020] FLAC", "torrent_name_mode": "reject"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Torrent name mismatch warns",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "torrentname": "Other Artist - Other Album"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Torrent name mismatch rejected",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "torrentname": "Other Artist - Other Album", "torrent_name_mode": "reject"}`,
+			wantStatus: StatusTorrentNameDiffers,
+		},
+		{
+			name:       "Invalid torrent name mode",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "torrentname": "Example Album", "torrent_name_mode": "strict"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Catalogue prefix blocked",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "block_catalogue_prefixes": "boot, ex-"}`,
+			wantStatus: StatusCatalogueBlocked,
+		},
+		{
+			name:       "Catalogue prefix not blocked",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "block_catalogue_prefixes": "BOOT,,EX-002"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Lossless only passes 24bit",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "lossless_only": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Lossless only without encoding",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "lossless_only": true}`,
+			wantStatus: StatusNotLossless,
+		},
+		{
+			name:       "Artists within range",
+			payload:    `{"indexer": "mock", "torrent_id": 127, "minartists": 2, "maxartists": 3}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Too many artists",
+			payload:    `{"indexer": "mock", "torrent_id": 127, "maxartists": 2}`,
+			wantStatus: StatusArtistsNotAllowed,
+		},
+		{
+			name:       "Too few artists",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "minartists": 2}`,
+			wantStatus: StatusArtistsNotAllowed,
+		},
+		{
+			name:       "Bitrate above minimum",
+			payload:    `{"indexer": "mock", "torrent_id": 126, "minbitrate": 192}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Bitrate below minimum",
+			payload:    `{"indexer": "mock", "torrent_id": 126, "minbitrate": 320}`,
+			wantStatus: StatusBitrateNotAllowed,
+			wantHeaders: map[string]string{
+				"X-Reject-Detail": ErrBitrateBelowMinimum + ": V0 (VBR), ~245 kbps",
+			},
+		},
+		{
+			name:       "Bitrate passes lossless",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "minbitrate": 320}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Bitrate of unknown encoding",
+			payload:    `{"indexer": "mock", "torrent_id": 127, "minbitrate": 192}`,
+			wantStatus: StatusBitrateNotAllowed,
+			wantHeaders: map[string]string{
+				"X-Reject-Detail": ErrBitrateBelowMinimum + ": unknown encoding 'Other'",
+			},
+		},
+		{
+			name:       "Bitrate without encoding",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "minbitrate": 192}`,
+			wantStatus: StatusBitrateNotAllowed,
+			wantHeaders: map[string]string{
+				"X-Reject-Detail": ErrBitrateBelowMinimum + ": encoding not reported",
+			},
+		},
+		{
+			name:       "Reported torrent rejected",
+			payload:    `{"indexer": "mock", "torrent_id": 127, "reject_reported": true}`,
+			wantStatus: StatusTorrentReported,
+		},
+		{
+			name:       "Torrent not reported",
+			payload:    `{"indexer": "mock", "torrent_id": 126, "reject_reported": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Reported flag missing",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "reject_reported": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Vanity house rejected",
+			payload:    `{"indexer": "mock", "torrent_id": 126, "reject_vanity_house": true}`,
+			wantStatus: StatusVanityHouse,
+		},
+		{
+			name:       "Vanity house not reported",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "reject_vanity_house": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Average bitrate within range",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "min_avg_bitrate": 900, "max_avg_bitrate": 1200}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Average bitrate below minimum",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "min_avg_bitrate": 1500}`,
+			wantStatus: StatusAvgBitrate,
+		},
+		{
+			name:       "Average bitrate skipped without duration",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "min_avg_bitrate": 1500}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Average bitrate min above max",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "min_avg_bitrate": 1500, "max_avg_bitrate": 900}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Uploader matches original uploader by default",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "uploaders": "editor1", "mode": "whitelist"}`,
+			wantStatus: StatusUploaderNotAllowed,
+		},
+		{
+			name:       "Uploader matches editor",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "uploaders": "editor1", "mode": "whitelist", "match_on": "editor"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Uploader editor falls back to uploader",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1", "mode": "whitelist", "match_on": "editor"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Invalid match_on",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1", "mode": "whitelist", "match_on": "owner"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "MBID in allowlist",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "allow_mbids": ["0B6B4BA0-D36F-47BD-B4EA-6A5B91842D29"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "MBID not in allowlist",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "allow_mbids": "a1b2c3d4-0000-0000-0000-000000000000"}`,
+			wantStatus: StatusMBIDNotAllowed,
+		},
+		{
+			name:       "MBID skipped when not reported",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_mbids": "a1b2c3d4-0000-0000-0000-000000000000"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Invalid MBID",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_mbids": "not-an-mbid"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Already snatched",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "red_user_id": 1, "skip_already_snatched": true}`,
+			wantStatus: StatusAlreadySnatched,
+		},
+		{
+			name:       "Not snatched",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "skip_already_snatched": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Ratio buffer above ratio",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "min_ratio_buffer": 0.2}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Ratio buffer below ratio",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "min_ratio_buffer": 1.0}`,
+			wantStatus: StatusRatioNotAllowed,
+		},
+		{
+			name:       "Minratio wins over ratio buffer",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "minratio": 0.5, "min_ratio_buffer": 1.0}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Neutral leech only passes neutral leech",
+			payload:    `{"indexer": "mock", "torrent_id": 125, "neutral_leech_only": true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Neutral leech only rejects freeleech",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "neutral_leech_only": true}`,
+			wantStatus: StatusNotNeutralLeech,
+		},
+		{
+			name:       "Neutral leech only without flag",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "neutral_leech_only": true}`,
+			wantStatus: StatusNotNeutralLeech,
+		},
+		{
+			name:       "Country in allowlist",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "allow_countries": ["UK", "japan"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Country not in allowlist",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "allow_countries": "UK"}`,
+			wantStatus: StatusCountryNotAllowed,
+		},
+		{
+			name:       "Country not reported",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "allow_countries": "UK"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Name source allowed",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "name_source_allow": ["Vinyl", "flac"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Name source not allowed",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "name_source_allow": "Vinyl,SACD"}`,
+			wantStatus: StatusNameSource,
+		},
+		{
+			name:       "Name source denied",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "name_source_allow": "FLAC", "name_source_deny": "flac"}`,
+			wantStatus: StatusNameSource,
+		},
+		{
+			name:       "Token eligible",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "token_eligible": true, "token_min_size": "100MB"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Token eligible below minimum size",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "token_eligible": true, "token_min_size": "1GB"}`,
+			wantStatus: StatusNotTokenEligible,
+		},
+		{
+			name:       "Token eligible rejects freeleech",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "token_eligible": true}`,
+			wantStatus: StatusNotTokenEligible,
+		},
+		{
+			name:       "Token eligible rejects neutral leech",
+			payload:    `{"indexer": "mock", "torrent_id": 125, "token_eligible": true}`,
+			wantStatus: StatusNotTokenEligible,
+		},
+		{
+			name:       "Ripper required without a log",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "require_ripper": ["EAC", "XLD"]}`,
+			wantStatus: StatusRipperNotAllowed,
+		},
+		{
+			name:       "Lineage excluded keyword",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "lineage_excludes": "unknown lineage"}`,
+			wantStatus: StatusLineageNotAllowed,
+		},
+		{
+			name:       "Lineage required keyword",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "lineage_contains": ["soundboard", "cd-r"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Lineage not reported",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "lineage_contains": "soundboard"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Max files",
+			payload:    `{"indexer": "mock", "torrent_id": 125, "maxfiles": 14}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Too many files",
+			payload:    `{"indexer": "mock", "torrent_id": 125, "max_files": 13}`,
+			wantStatus: StatusTooManyFiles,
+		},
+		{
+			name:       "Max files without a file count",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "maxfiles": 50}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "OPS flags set",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "ops_require_flags": "Scene"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "OPS flag not set",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "ops_require_flags": ["scene", "isTrumpable"]}`,
+			wantStatus: StatusIndexerFlag,
+			wantHeaders: map[string]string{
+				"X-Reject-Detail": ErrIndexerFlag + ": istrumpable not set",
+			},
+		},
+		{
+			name:       "OPS flag not reported",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "ops_require_flags": "scene"}`,
+			wantStatus: StatusIndexerFlag,
+		},
+		{
+			name:       "Missing fixture",
+			payload:    `{"indexer": "mock", "torrent_id": 999, "minsize": "1MB"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			for header, want := range tt.wantHeaders {
+				if got := recorder.Header().Get(header); got != want {
+					t.Errorf("header %s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerFreeSpace(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+
+	downloadPath := t.TempDir()
+	free, err := freeDiskSpace(downloadPath)
+	if err != nil {
+		t.Fatalf("freeDiskSpace() error = %v", err)
+	}
+	// Torrent 123 is 300 MiB.
+	const torrentSize = 314572800
+	if free < 2*torrentSize {
+		t.Skipf("only %d bytes free in %s", free, downloadPath)
+	}
+
+	tests := []struct {
+		name         string
+		downloadPath string
+		minFree      bytesize.ByteSize
+		wantStatus   int
+	}{
+		{name: "Enough space", downloadPath: downloadPath, minFree: bytesize.ByteSize(free - 2*torrentSize), wantStatus: http.StatusOK},
+		{name: "Not enough space after min_free", downloadPath: downloadPath, minFree: bytesize.ByteSize(free), wantStatus: StatusInsufficientSpace},
+		{name: "No download path", minFree: bytesize.ByteSize(free), wantStatus: http.StatusOK},
+		{name: "Missing download path", downloadPath: filepath.Join(downloadPath, "missing"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.SizeCheck.DownloadPath = tt.downloadPath
+			cfg.ParsedSizes.MinFree = tt.minFree
+
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123}`))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestPreviewHandler(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+
+	tests := []struct {
+		name         string
+		token        string
+		payload      string
+		wantStatus   int
+		wantApproved bool
+		wantHooks    map[string]bool // Hook name to whether it passed
+	}{
+		{
+			name:         "Every hook passes",
+			token:        "testtoken",
+			payload:      `{"indexer": "mock", "torrent_id": 124, "minsize": "1MB", "lossless_only": true}`,
+			wantStatus:   http.StatusOK,
+			wantApproved: true,
+			wantHooks:    map[string]bool{"size": true, "lossless": true},
+		},
+		{
+			name:       "One hook fails",
+			token:      "testtoken",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "minsize": "1MB", "uploaders": "uploader1", "mode": "blacklist"}`,
+			wantStatus: http.StatusOK,
+			wantHooks:  map[string]bool{"size": true, "uploader": false},
+		},
+		{
+			name:       "Missing token",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "minsize": "1MB"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid JSON",
+			token:      "testtoken",
+			payload:    `{"indexer": "mock",`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook/preview", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", tt.token)
+			recorder := httptest.NewRecorder()
+
+			PreviewHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("PreviewHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response PreviewResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if response.Approved != tt.wantApproved {
+				t.Errorf("approved = %t, want %t", response.Approved, tt.wantApproved)
+			}
+			if len(response.Hooks) != len(tt.wantHooks) {
+				t.Errorf("got %d hooks, want %d: %+v", len(response.Hooks), len(tt.wantHooks), response.Hooks)
+			}
+			for _, result := range response.Hooks {
+				if passed, ok := tt.wantHooks[result.Hook]; !ok || passed != result.Passed {
+					t.Errorf("hook %s passed = %t, want %v (in %v)", result.Hook, result.Passed, passed, ok)
+				}
+				if result.Hook == "uploader" && (result.Actual != "uploader1" || result.Reason != ErrUploaderNotAllowed) {
+					t.Errorf("uploader actual = %q, reason = %q, want uploader1 and %q", result.Actual, result.Reason, ErrUploaderNotAllowed)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerQuietRejections(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.Server.RejectHeaders = true
+	cfg.Server.QuietRejections = true
+
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123, "maxsize": "1MB"}`))
+	req.Header.Set("X-API-Token", "testtoken")
+	recorder := httptest.NewRecorder()
+	WebhookHandler(recorder, req)
+
+	if recorder.Code != StatusSizeNotAllowed {
+		t.Errorf("status = %d, want %d", recorder.Code, StatusSizeNotAllowed)
+	}
+	if body := recorder.Body.String(); body != "" {
+		t.Errorf("body = %q, want empty", body)
+	}
+	if got := recorder.Header().Get("X-Reject-Reason"); got != "size" {
+		t.Errorf("X-Reject-Reason = %q, want size", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 999, "minsize": "1MB"}`))
+	req.Header.Set("X-API-Token", "testtoken")
+	recorder = httptest.NewRecorder()
+	WebhookHandler(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError || recorder.Body.Len() == 0 {
+		t.Errorf("error response = %d %q, want a 500 with a body", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestWebhookHandlerPayloadErrors(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	cfg.Authorization.APIToken = "testtoken"
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantField  string
+		wantOffset int64
+		wantError  string
+	}{
+		{name: "Syntax error", payload: `{"torrent_id": 1,, "indexer": "ops"}`, wantOffset: 18, wantError: "at byte 18"},
+		{name: "Wrong type", payload: `{"torrent_id": "one", "indexer": "ops"}`, wantField: "torrent_id", wantError: "torrent_id must be a whole number, got string"},
+		{name: "Size as number", payload: `{"minsize": 100, "indexer": "ops"}`, wantField: "minsize", wantError: "minsize must be a string, got number"},
+		{name: "Invalid size", payload: `{"torrent_id": 1, "maxsize": "lots", "indexer": "ops"}`, wantField: "maxsize"},
+		{name: "Invalid list", payload: `{"uploaders": [1, 2], "indexer": "ops"}`, wantField: "uploaders"},
+		{name: "Not an object", payload: `[1, 2]`, wantError: "must be a JSON object"},
+		{name: "Empty body", payload: ``, wantError: "empty"},
+		{name: "Truncated body", payload: `{"torrent_id": 1`, wantError: "ends before"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body: %s)", recorder.Code, http.StatusBadRequest, recorder.Body.String())
+			}
+			var got payloadError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not a JSON payload error: %v", recorder.Body.String(), err)
+			}
+			if got.Field != tt.wantField || got.Offset != tt.wantOffset {
+				t.Errorf("field = %q, offset = %d, want %q and %d", got.Field, got.Offset, tt.wantField, tt.wantOffset)
+			}
+			if !strings.Contains(got.Message, tt.wantError) {
+				t.Errorf("error = %q, want it to contain %q", got.Message, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestStrictRequest(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	tests := []struct {
+		name      string
+		strict    bool
+		payload   string
+		wantField string
+		wantError string
+	}{
+		{name: "Unknown field ignored", payload: `{"torrent_id": 1, "minratoi": 1.2}`},
+		{name: "Known fields", strict: true, payload: `{"torrent_id": 1, "minratio": 1.2, "Indexer": "ops"}`},
+		{name: "Alias", strict: true, payload: `{"torrent_id": 1, "min_ratio": 1.2}`},
+		{name: "Typo", strict: true, payload: `{"torrent_id": 1, "minratoi": 1.2}`, wantField: "minratoi", wantError: "did you mean minratio?"},
+		{name: "Unrelated field", strict: true, payload: `{"torrent_id": 1, "colour": "blue"}`, wantField: "colour", wantError: "unknown field colour"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Server.StrictRequest = tt.strict
+
+			var requestData RequestData
+			err := json.Unmarshal([]byte(tt.payload), &requestData)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Errorf("Unmarshal() error = %v", err)
+				}
+				return
+			}
+
+			var payloadErr *payloadError
+			if !errors.As(err, &payloadErr) {
+				t.Fatalf("Unmarshal() error = %v, want a payload error", err)
+			}
+			if payloadErr.Field != tt.wantField || !strings.Contains(payloadErr.Message, tt.wantError) {
+				t.Errorf("Unmarshal() error = %+v, want field %q and %q", payloadErr, tt.wantField, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerScore(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.Score = config.Score{Enabled: true, Threshold: 2, Weights: map[string]float64{"uploader": 2}}
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Heavy filter passes alone",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "maxsize": "1MB", "uploaders": "uploader1", "mode": "whitelist"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Light filter is not enough",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "minsize": "1MB", "uploaders": "someone", "mode": "whitelist"}`,
+			wantStatus: StatusScoreTooLow,
+			wantBody:   "scored 1 of 3, needs 2 (failed: uploader)",
+		},
+		{
+			name:       "Two light filters",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "minsize": "1MB", "minleechers": 1, "uploaders": "someone", "mode": "whitelist"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Infrastructure errors still fail",
+			payload:    `{"indexer": "mock", "torrent_id": 999, "minsize": "1MB"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", recorder.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	// The quota is a gate: passing filters can't outvote it.
+	cfg.ParsedSizes.QuotaMaxSize = bytesize.MB
+	defer func() { quotaGrabs = nil }()
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1", "mode": "whitelist"}`))
+	req.Header.Set("X-API-Token", "testtoken")
+	recorder := httptest.NewRecorder()
+	WebhookHandler(recorder, req)
+	if recorder.Code != StatusQuotaExceeded {
+		t.Errorf("WebhookHandler() over the quota status = %d, want %d (body: %s)", recorder.Code, StatusQuotaExceeded, recorder.Body.String())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr string
+	}{
+		{name: "Empty", cfg: config.Config{}},
+		{name: "Known weights", cfg: config.Config{Score: config.Score{Weights: map[string]float64{"uploader": 2, "size": 1}}}},
+		{name: "Unknown weight", cfg: config.Config{Score: config.Score{Weights: map[string]float64{"uploaders": 2}}}, wantErr: "Invalid score weight for 'uploaders', no such filter"},
+		{name: "Weight on a gate", cfg: config.Config{Score: config.Score{Weights: map[string]float64{"quota": 2}}}, wantErr: "Invalid score weight for 'quota', it is always a hard filter"},
+		{name: "Custom status codes", cfg: config.Config{StatusCodes: map[string]int{"ratio": 460, "score": 461}}},
+		{name: "Status code of an unknown filter", cfg: config.Config{StatusCodes: map[string]int{"uploaders": 460}}, wantErr: "Invalid status code for 'uploaders', no such filter"},
+		{name: "Status code of another filter", cfg: config.Config{StatusCodes: map[string]int{"ratio": StatusUploaderNotAllowed}}, wantErr: fmt.Sprintf("Invalid status code %d for 'ratio', it is already the default code of 'uploader'", StatusUploaderNotAllowed)},
+		{name: "Default code of a remapped filter", cfg: config.Config{StatusCodes: map[string]int{"ratio": StatusUploaderNotAllowed, "uploader": 460}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(&tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateConfig() error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateConfig() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerRatioBrackets(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+
+	// The mock user has a ratio of 1.25 and torrent 123 is 300MB.
+	tests := []struct {
+		name       string
+		brackets   []config.ParsedRatioBracket
+		payload    string
+		wantStatus int
+	}{
+		{
+			name:       "Large bracket rejects",
+			brackets:   []config.ParsedRatioBracket{{MinSize: 0, MinRatio: 1.0}, {MinSize: 200 * bytesize.MB, MinRatio: 2.0}},
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1}`,
+			wantStatus: StatusRatioNotAllowed,
+		},
+		{
+			name:       "Small bracket passes",
+			brackets:   []config.ParsedRatioBracket{{MinSize: 0, MinRatio: 1.0}, {MinSize: bytesize.GB, MinRatio: 2.0}},
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Request minratio wins",
+			brackets:   []config.ParsedRatioBracket{{MinSize: 0, MinRatio: 2.0}},
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "minratio": 1.0}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Freeleech still skipped",
+			brackets:   []config.ParsedRatioBracket{{MinSize: 0, MinRatio: 2.0}},
+			payload:    `{"indexer": "mock", "torrent_id": 124, "red_user_id": 1, "skip_ratio_on_freeleech": true}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.RatioBrackets = tt.brackets
+
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestBracketMinRatio(t *testing.T) {
+	brackets := []config.ParsedRatioBracket{{MinSize: bytesize.GB, MinRatio: 0.8}, {MinSize: 5 * bytesize.GB, MinRatio: 1.0}}
+
+	tests := []struct {
+		size bytesize.ByteSize
+		want float64
+	}{
+		{500 * bytesize.MB, 0.6},
+		{bytesize.GB, 0.8},
+		{4 * bytesize.GB, 0.8},
+		{10 * bytesize.GB, 1.0},
+	}
+	for _, tt := range tests {
+		if got := bracketMinRatio(brackets, tt.size, 0.6); got != tt.want {
+			t.Errorf("bracketMinRatio(%s) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookHandlerIncludeRelease(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Fetched release",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "minsize": "1MB", "include_release": true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"torrent_id":124,"release":{"name":"Example Artist - Example Album (2020) [FLAC]","size":314572800,"encoding":"24bit Lossless","uploader":"uploader1","label":"Example Records"}}` + "\n",
+		},
+		{
+			name:       "No torrent fetched",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "red_user_id": 1, "minratio": 1.0, "include_release": true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"torrent_id":123}` + "\n",
+		},
+		{
+			name:       "Rejections are unchanged",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "maxsize": "1MB", "include_release": true}`,
+			wantStatus: StatusSizeNotAllowed,
+			wantBody:   ErrSizeNotAllowed + "\n",
+		},
+		{
+			name:       "Off by default",
+			payload:    `{"indexer": "mock", "torrent_id": 124, "minsize": "1MB"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if got := recorder.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerMatchAnyID(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+
+	// Only torrent 125 is neutral leech, and 999 has no fixture.
+	tests := []struct {
+		name       string
+		payload    string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Second candidate passes",
+			payload:    `{"indexer": "mock", "torrent_ids": [123, 125], "match_any_id": true, "neutral_leech_only": true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"torrent_id":125}`,
+		},
+		{
+			name:       "Stops at the first pass",
+			payload:    `{"indexer": "mock", "torrent_ids": [125, 999], "match_any_id": true, "neutral_leech_only": true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"torrent_id":125}`,
+		},
+		{
+			name:       "Torrent ID is the first candidate",
+			payload:    `{"indexer": "mock", "torrent_id": 125, "torrent_ids": [123], "match_any_id": true, "neutral_leech_only": true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"torrent_id":125}`,
+		},
+		{
+			name:       "Unknown candidate is skipped",
+			payload:    `{"indexer": "mock", "torrent_ids": [999, 125], "match_any_id": true, "neutral_leech_only": true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"torrent_id":125}`,
+		},
+		{
+			name:       "Unknown candidate next to a rejected one",
+			payload:    `{"indexer": "mock", "torrent_ids": [999, 123], "match_any_id": true, "neutral_leech_only": true}`,
+			wantStatus: StatusNotNeutralLeech,
+			wantBody:   ErrNotNeutralLeech + ": torrent 123",
+		},
+		{
+			name:       "No candidate is known",
+			payload:    `{"indexer": "mock", "torrent_ids": [998, 999], "match_any_id": true, "neutral_leech_only": true}`,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "Internal Server Error",
+		},
+		{
+			name:       "No candidate passes",
+			payload:    `{"indexer": "mock", "torrent_ids": [123, 124], "match_any_id": true, "neutral_leech_only": true}`,
+			wantStatus: StatusNotNeutralLeech,
+			wantBody:   ErrNotNeutralLeech + ": torrent 123; " + ErrNotNeutralLeech + ": torrent 124",
+		},
+		{
+			name:       "Torrent IDs without match_any_id",
+			payload:    `{"indexer": "mock", "torrent_ids": [123, 125]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "torrent_ids needs match_any_id",
+		},
+		{
+			name:       "Match any ID without torrent IDs",
+			payload:    `{"indexer": "mock", "torrent_id": 123, "match_any_id": true}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "match_any_id needs torrent_ids",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", recorder.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerSuccessStatus(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.Server.SuccessStatus = http.StatusNoContent
+
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123, "minsize": "1MB"}`))
+	req.Header.Set("X-API-Token", "testtoken")
+	recorder := httptest.NewRecorder()
+
+	WebhookHandler(recorder, req)
+
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("WebhookHandler() status = %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
+
+func TestWebhookHandlerCollectAllReasons(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+
+	tests := []struct {
+		name         string
+		payload      string
+		wantBody     []string
+		unwantedBody string
+	}{
+		{
+			name:         "Short-circuit by default",
+			payload:      `{"indexer": "mock", "torrent_id": 123, "maxsize": "1MB", "uploaders": "someone", "mode": "whitelist"}`,
+			wantBody:     []string{ErrSizeNotAllowed},
+			unwantedBody: ErrUploaderNotAllowed,
+		},
+		{
+			name:     "Collect all reasons",
+			payload:  `{"indexer": "mock", "torrent_id": 123, "maxsize": "1MB", "uploaders": "someone", "mode": "whitelist", "collect_all_reasons": true}`,
+			wantBody: []string{ErrSizeNotAllowed, ErrUploaderNotAllowed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != StatusSizeNotAllowed {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, StatusSizeNotAllowed, recorder.Body.String())
+			}
+			body := recorder.Body.String()
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("body %q does not contain %q", body, want)
+				}
+			}
+			if tt.unwantedBody != "" && strings.Contains(body, tt.unwantedBody) {
+				t.Errorf("body %q contains %q", body, tt.unwantedBody)
+			}
+		})
+	}
+}
+
+func TestMatchesPreset(t *testing.T) {
+	t.Parallel()
+
+	perfect, ok := lookupPreset("Perfect FLAC CD")
+	if !ok {
+		t.Fatal("lookupPreset() did not find built-in preset perfect_flac_cd")
+	}
+	webV0, _ := lookupPreset("v0-web")
+
+	tests := []struct {
+		name    string
+		torrent TorrentData
+		preset  config.Preset
+		want    bool
+	}{
+		{
+			name:    "Perfect CD rip",
+			torrent: TorrentData{Format: "FLAC", Encoding: "Lossless", Media: "CD", HasLog: true, LogScore: 100, HasCue: true},
+			preset:  perfect,
+			want:    true,
+		},
+		{
+			name:    "CD rip with imperfect log",
+			torrent: TorrentData{Format: "FLAC", Encoding: "Lossless", Media: "CD", HasLog: true, LogScore: 95, HasCue: true},
+			preset:  perfect,
+			want:    false,
+		},
+		{
+			name:    "WEB FLAC against CD preset",
+			torrent: TorrentData{Format: "FLAC", Encoding: "Lossless", Media: "WEB"},
+			preset:  perfect,
+			want:    false,
+		},
+		{
+			name:    "V0 WEB",
+			torrent: TorrentData{Format: "MP3", Encoding: "V0 (VBR)", Media: "WEB"},
+			preset:  webV0,
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := matchesPreset(&tt.torrent, tt.preset); got != tt.want {
+				t.Errorf("matchesPreset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchErrorWrapping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id") {
+		case "1":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "2":
+			w.WriteHeader(http.StatusNotFound)
+		case "3":
+			w.Write([]byte(`{"status": "failure", "error": "bad id parameter"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		torrentID int
+		wantErr   error
+	}{
+		{name: "HTTP 429", torrentID: 1, wantErr: ErrRateLimited},
+		{name: "HTTP 404", torrentID: 2, wantErr: ErrNotFound},
+		{name: "Bad ID", torrentID: 3, wantErr: ErrNotFound},
+		{name: "HTTP 502", torrentID: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestData := RequestData{Indexer: "redacted", REDKey: "key", TorrentID: tt.torrentID, MinSize: 1}
+			err := runHooks(&requestData, server.URL)
+			if err == nil {
+				t.Fatal("runHooks() returned no error")
+			}
+
+			for _, want := range []string{"size hook failed", "torrent data", "redacted"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+
+			for _, sentinel := range []error{ErrRateLimited, ErrNotFound} {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.wantErr) {
+					t.Errorf("errors.Is(%q, %v) = %t", err, sentinel, got)
+				}
+			}
+
+			var rejection *rejectionError
+			if errors.As(err, &rejection) {
+				t.Errorf("infrastructure error %q was wrapped as a rejection", err)
+			}
+		})
+	}
+}
+
+func TestLogVerification(t *testing.T) {
+	t.Parallel()
+
+	yes, no := true, false
+	tests := []struct {
+		name         string
+		torrent      TorrentData
+		wantVerified bool
+		wantOK       bool
+	}{
+		{name: "No log", torrent: TorrentData{HasLog: false, HasLogDB: &yes}, wantVerified: false, wantOK: true},
+		{name: "Fields missing", torrent: TorrentData{HasLog: true}, wantVerified: false, wantOK: false},
+		{name: "Checked log", torrent: TorrentData{HasLog: true, HasLogDB: &yes, LogChecksum: &yes}, wantVerified: true, wantOK: true},
+		{name: "Bad checksum", torrent: TorrentData{HasLog: true, HasLogDB: &yes, LogChecksum: &no}, wantVerified: false, wantOK: true},
+		{name: "Not in log database", torrent: TorrentData{HasLog: true, HasLogDB: &no}, wantVerified: false, wantOK: true},
+		{name: "Only checksum reported", torrent: TorrentData{HasLog: true, LogChecksum: &yes}, wantVerified: true, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			verified, ok := logVerification(&tt.torrent)
+			if verified != tt.wantVerified || ok != tt.wantOK {
+				t.Errorf("logVerification() = (%t, %t), want (%t, %t)", verified, ok, tt.wantVerified, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRejectionMessage(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := cfg.Messages
+	defer func() { cfg.Messages = previous }()
+
+	cfg.Messages = map[string]string{
+		"ratio":    "Ratio too low",
+		"metadata": "Incomplete: {detail}",
+	}
+
+	tests := []struct {
+		name      string
+		rejection rejectionError
+		want      string
+	}{
+		{name: "Custom message", rejection: rejectionError{hook: "ratio", reason: ErrRatioBelowMinimum}, want: "Ratio too low"},
+		{name: "Detail placeholder", rejection: rejectionError{hook: "metadata", reason: ErrMetadataIncomplete, detail: "year is missing"}, want: "Incomplete: year is missing"},
+		{name: "Built-in fallback", rejection: rejectionError{hook: "size", reason: ErrSizeNotAllowed}, want: ErrSizeNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rejectionMessage(&tt.rejection); got != tt.want {
+				t.Errorf("rejectionMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckErrorRates(t *testing.T) {
+	counter := apiCallCounters["ops"]
+	defer counter.alerting.Store(false)
+
+	for i := 0; i < 3; i++ {
+		recordAPIResult("ops", errors.New("HTTP error: 502"))
+	}
+	recordAPIResult("ops", nil)
+	checkErrorRates()
+
+	if !counter.alerting.Load() {
+		t.Error("3 of 4 failed calls did not trigger the watchdog")
+	}
+	if total := counter.total.Load(); total != 0 {
+		t.Errorf("counters not reset after check, total = %d", total)
+	}
+
+	for i := 0; i < errorRateMinRequests; i++ {
+		recordAPIResult("ops", nil)
+	}
+	checkErrorRates()
+
+	if counter.alerting.Load() {
+		t.Error("watchdog still alerting after a window without failures")
+	}
+}
+
+func TestIndexerFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Success", nil, false},
+		{"Transport error", errors.New("dial tcp: connection refused"), true},
+		{"Server error", &upstreamError{indexer: "ops", status: http.StatusBadGateway}, true},
+		{"Unauthorized", &upstreamError{indexer: "ops", status: http.StatusUnauthorized}, true},
+		{"Bad id", apiFailure("ops", "bad id parameter"), false},
+		{"Not found", &upstreamError{indexer: "ops", status: http.StatusNotFound, err: ErrNotFound}, false},
+		{"Rate limited", &upstreamError{indexer: "ops", status: http.StatusTooManyRequests, err: ErrRateLimited}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := indexerFailure(tt.err); got != tt.want {
+				t.Errorf("indexerFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	counter := apiCallCounters["ops"]
+	defer counter.alerting.Store(false)
+
+	for i := 0; i < errorRateMinRequests; i++ {
+		recordAPIResult("ops", apiFailure("ops", "bad id parameter"))
+	}
+	checkErrorRates()
+
+	if counter.alerting.Load() {
+		t.Error("stale torrent IDs marked the indexer degraded")
+	}
+}
+
+func TestDecisionWebhook(t *testing.T) {
+	received := make(chan Decision, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var decision Decision
+		if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+			t.Errorf("invalid decision payload: %v", err)
+		}
+		received <- decision
+	}))
+	defer server.Close()
+
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.DecisionWebhook.URL = server.URL
+
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1", "mode": "blacklist", "ops_apikey": "secret"}`))
+	req.Header.Set("X-API-Token", "testtoken")
+	req.Header.Set("X-Request-ID", "req-1")
+	WebhookHandler(httptest.NewRecorder(), req)
+
+	select {
+	case decision := <-received:
+		if decision.RequestID != "req-1" || decision.Approved || decision.Status != StatusUploaderNotAllowed {
+			t.Errorf("unexpected decision: %+v", decision)
+		}
+		if decision.Request.OPSKey != "" {
+			t.Error("decision leaked the API key")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("decision webhook was not called")
+	}
+}
+
+func TestParseFileList(t *testing.T) {
+	t.Parallel()
+
+	files := parseFileList("01 Intro.flac{{{12345}}}|||Scans/Cover &amp; Back.JPG{{{678}}}|||broken{{{x}}}")
+
+	want := []torrentFile{
+		{Name: "01 Intro.flac", Size: 12345},
+		{Name: "Scans/Cover & Back.JPG", Size: 678},
+		{Name: "broken", Size: 0},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("parseFileList() returned %d files, want %d", len(files), len(want))
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, files[i], want[i])
+		}
+	}
+
+	if !isImageFile(files[1].Name) || isImageFile(files[0].Name) {
+		t.Error("isImageFile() misclassified the file list")
+	}
+}
+
+func TestTrackCount(t *testing.T) {
+	t.Parallel()
+
+	files := parseFileList("01 Intro.flac{{{1}}}|||02 Song.FLAC{{{1}}}|||CD2/01 Outro.mp3{{{1}}}|||rip.log{{{1}}}|||rip.cue{{{1}}}|||cover.jpg{{{1}}}")
+	if got := trackCount(files); got != 3 {
+		t.Errorf("trackCount() = %d, want 3", got)
+	}
+	if got := trackCount(nil); got != 0 {
+		t.Errorf("trackCount(nil) = %d, want 0", got)
+	}
+}
+
+func TestFileCount(t *testing.T) {
+	t.Parallel()
+
+	torrent := &TorrentData{FileList: "01 Intro.flac{{{1}}}|||rip.log{{{1}}}|||cover.jpg{{{1}}}"}
+	if got := fileCount(torrent); got != 3 {
+		t.Errorf("fileCount() from the file list = %d, want 3", got)
+	}
+
+	torrent.FileCount = 40
+	if got := fileCount(torrent); got != 40 {
+		t.Errorf("fileCount() with fileCount reported = %d, want 40", got)
+	}
+
+	if got := fileCount(&TorrentData{}); got != 0 {
+		t.Errorf("fileCount() without file info = %d, want 0", got)
+	}
+}
+
+func TestArtworkSource(t *testing.T) {
+	t.Parallel()
+
+	var responseData ResponseData
+	responseData.Response.Torrent = &TorrentData{FileList: "01 Intro.flac{{{12345}}}"}
+	if got := artworkSource(&responseData); got != "" {
+		t.Errorf("artworkSource() = %q without artwork, want empty", got)
+	}
+
+	responseData.Response.Torrent.FileList += "|||folder.jpg{{{100}}}"
+	if got := artworkSource(&responseData); got != "image file folder.jpg" {
+		t.Errorf("artworkSource() = %q, want the image file", got)
+	}
+
+	responseData.Response.Group.WikiImage = "https://ptpimg.me/cover.jpg"
+	if got := artworkSource(&responseData); got != "group image" {
+		t.Errorf("artworkSource() = %q, want the group image", got)
+	}
+}
+
+func TestAcquireRateLimit(t *testing.T) {
+	t.Parallel()
+
+	limiter := rate.NewLimiter(rate.Every(50*time.Millisecond), 1)
+	ctx := context.Background()
+
+	if err := acquireRateLimit(ctx, limiter, "ops", config.RateLimitReject); err != nil {
+		t.Fatalf("first call rejected: %v", err)
+	}
+	if err := acquireRateLimit(ctx, limiter, "ops", config.RateLimitReject); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("reject mode returned %v, want ErrRateLimited", err)
+	}
+
+	start := time.Now()
+	if err := acquireRateLimit(ctx, limiter, "ops", config.RateLimitWait); err != nil {
+		t.Errorf("wait mode returned %v", err)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("wait mode did not wait for a token")
+	}
+}
+
+func TestLimiterStatuses(t *testing.T) {
+	previousLimiter := redactedLimiter
+	redactedLimiter = rate.NewLimiter(rate.Every(time.Hour), 2)
+	defer func() { redactedLimiter = previousLimiter }()
+
+	counter := limiterCounters["redacted"]
+	throttled, rejected := counter.throttled.Load(), counter.rejected.Load()
+
+	ctx := context.Background()
+	for range 2 {
+		if err := acquireRateLimit(ctx, redactedLimiter, "redacted", config.RateLimitReject); err != nil {
+			t.Fatalf("call within the burst rejected: %v", err)
+		}
+	}
+	acquireRateLimit(ctx, redactedLimiter, "redacted", config.RateLimitReject)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	acquireRateLimit(timeout, redactedLimiter, "redacted", config.RateLimitWait)
+
+	var status LimiterStatus
+	for _, s := range LimiterStatuses() {
+		if s.Indexer == "redacted" {
+			status = s
+		}
+	}
+	if status.Burst != 2 || status.Tokens >= 1 {
+		t.Errorf("status = %+v, want burst 2 and no tokens left", status)
+	}
+	if got := status.Throttled - throttled; got != 2 {
+		t.Errorf("throttled %d calls, want 2", got)
+	}
+	if got := status.Rejected - rejected; got != 2 {
+		t.Errorf("rejected %d calls, want 2", got)
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	var window latencyWindow
+	for i := 1; i <= 100; i++ {
+		window.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	samples, count := window.snapshot()
+	if count != 100 {
+		t.Errorf("count = %d, want 100", count)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{{50, 50 * time.Millisecond}, {95, 95 * time.Millisecond}, {99, 99 * time.Millisecond}} {
+		if got := percentile(samples, tt.p); got != tt.want {
+			t.Errorf("p%.0f = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+
+	// Once the ring is full the oldest samples make way for new ones.
+	for range latencyWindowSize {
+		window.observe(time.Second)
+	}
+	samples, count = window.snapshot()
+	if len(samples) != latencyWindowSize || count != 100+latencyWindowSize {
+		t.Errorf("got %d samples of %d, want %d of %d", len(samples), count, latencyWindowSize, 100+latencyWindowSize)
+	}
+	if got := percentile(samples, 50); got != time.Second {
+		t.Errorf("p50 after wrapping = %s, want 1s", got)
+	}
+
+	if got := percentile(nil, 99); got != 0 {
+		t.Errorf("p99 of no samples = %s, want 0", got)
+	}
+}
+
+func TestLatencyStatusesIncludeLimiterWait(t *testing.T) {
+	previousLimiter := redactedLimiter
+	redactedLimiter = rate.NewLimiter(rate.Inf, 0)
+	defer func() { redactedLimiter = previousLimiter }()
+
+	count := func() int64 {
+		for _, status := range LatencyStatuses() {
+			if status.Stage == latencyLimiterWait && status.Indexer == "redacted" {
+				return status.Count
+			}
+		}
+		t.Fatal("no limiter_wait status for redacted")
+		return 0
+	}
+
+	before := count()
+	if err := acquireRateLimit(context.Background(), redactedLimiter, "redacted", config.RateLimitWait); err != nil {
+		t.Fatalf("acquireRateLimit() error = %v", err)
+	}
+	if got := count() - before; got != 1 {
+		t.Errorf("recorded %d limiter waits, want 1", got)
+	}
+}
+
+func TestTorrentFreeleech(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		payload string
+		want    bool
+	}{
+		{payload: `{"freeTorrent": false}`, want: false},
+		{payload: `{"freeTorrent": true}`, want: true},
+		{payload: `{"freeTorrent": "1"}`, want: true},
+		{payload: `{"freeTorrent": 2}`, want: false},
+		{payload: `{"freeTorrent": "0", "isFreeleech": true}`, want: true},
+		{payload: `{"isPersonalFreeleech": "1"}`, want: true},
+		{payload: `{}`, want: false},
+	}
+
+	for _, tt := range tests {
+		var torrent TorrentData
+		if err := json.Unmarshal([]byte(tt.payload), &torrent); err != nil {
+			t.Errorf("Unmarshal(%s) error = %v", tt.payload, err)
+			continue
+		}
+		if got := torrent.isFreeleech(); got != tt.want {
+			t.Errorf("isFreeleech() for %s = %t, want %t", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestValidateHookCount(t *testing.T) {
+	t.Parallel()
+
+	requestData := RequestData{Indexer: "ops", TorrentID: 1, MinSize: 1, MinLeechers: 1, RejectReported: true}
+
+	if err := validateHookCount(&requestData, 0); err != nil {
+		t.Errorf("unlimited max_hooks returned %v", err)
+	}
+	if err := validateHookCount(&requestData, 3); err != nil {
+		t.Errorf("3 hooks with max_hooks 3 returned %v", err)
+	}
+	if err := validateHookCount(&requestData, 2); err == nil {
+		t.Error("3 hooks with max_hooks 2 were not rejected")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"Direct", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"Forwarded header from untrusted peer ignored", "192.0.2.1:1234", "198.51.100.7", "192.0.2.1"},
+		{"Trusted proxy", "10.0.0.2:1234", "198.51.100.7", "198.51.100.7"},
+		{"Chain of trusted proxies", "10.0.0.2:1234", "198.51.100.7, 10.0.0.3", "198.51.100.7"},
+		{"Spoofed leftmost entry", "10.0.0.2:1234", "127.0.0.1, 198.51.100.7", "198.51.100.7"},
+		{"Trusted proxy without header", "10.0.0.2:1234", "", "10.0.0.2"},
+		{"IPv4-mapped IPv6", "[::ffff:192.0.2.1]:1234", "", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(req, trusted); got.String() != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerAllowedIPs(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.AllowedIPs = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+
+	for remoteAddr, want := range map[string]int{
+		"192.0.2.10:1234":    http.StatusOK,
+		"198.51.100.7:1234":  http.StatusForbidden,
+		"[2001:db8::1]:1234": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123, "minsize": "1MB"}`))
+		req.Header.Set("X-API-Token", "testtoken")
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+
+		WebhookHandler(recorder, req)
+
+		if recorder.Code != want {
+			t.Errorf("request from %s: status = %d, want %d", remoteAddr, recorder.Code, want)
+		}
+	}
+
+	for path, handler := range map[string]http.HandlerFunc{
+		"/maintenance": MaintenanceHandler,
+		"/cache/clear": CacheClearHandler,
+	} {
+		for remoteAddr, want := range map[string]int{
+			"192.0.2.10:1234":   http.StatusOK,
+			"198.51.100.7:1234": http.StatusForbidden,
+		} {
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			req.Header.Set("X-API-Token", "testtoken")
+			req.RemoteAddr = remoteAddr
+			recorder := httptest.NewRecorder()
+
+			handler(recorder, req)
+
+			if recorder.Code != want {
+				t.Errorf("%s from %s: status = %d, want %d", path, remoteAddr, recorder.Code, want)
+			}
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	defer maintenanceEnabled.Store(false)
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+
+	hook := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123}`))
+		req.Header.Set("X-API-Token", "testtoken")
+		recorder := httptest.NewRecorder()
+		WebhookHandler(recorder, req)
+		return recorder
+	}
+	setMaintenance := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/maintenance", strings.NewReader(body))
+		req.Header.Set("X-API-Token", "testtoken")
+		recorder := httptest.NewRecorder()
+		MaintenanceHandler(recorder, req)
+		return recorder
+	}
+
+	if recorder := hook(); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d outside maintenance, want 200", recorder.Code)
+	}
+
+	cfg.Server.Maintenance = true
+	if recorder := hook(); recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "maintenance") {
+		t.Errorf("status = %d (body: %s) with maintenance in the config, want 503", recorder.Code, recorder.Body.String())
+	}
+	cfg.Server.Maintenance = false
+
+	if recorder := setMaintenance(`{"enabled": true}`); recorder.Body.String() != "{\"maintenance\":true}\n" {
+		t.Errorf("maintenance endpoint body = %q, want maintenance on", recorder.Body.String())
+	}
+	if recorder := hook(); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d after enabling maintenance, want 503", recorder.Code)
+	}
+
+	if recorder := setMaintenance(""); recorder.Body.String() != "{\"maintenance\":true}\n" {
+		t.Errorf("maintenance endpoint body = %q without a change, want maintenance on", recorder.Body.String())
+	}
+
+	setMaintenance(`{"enabled": false}`)
+	if recorder := hook(); recorder.Code != http.StatusOK {
+		t.Errorf("status = %d after disabling maintenance, want 200", recorder.Code)
+	}
+}
+
+func TestReserveFetch(t *testing.T) {
+	const key = "redacted_torrent_ID_9301"
+	defer func() {
+		liveFetchesLock.Lock()
+		delete(liveFetches, key)
+		liveFetchesLock.Unlock()
+	}()
+
+	now := time.Now()
+	if wait, ok := reserveFetch(key, now, time.Minute, time.Hour); wait != 0 || !ok {
+		t.Errorf("first fetch waits %s (%t), want 0", wait, ok)
+	}
+	if wait, ok := reserveFetch(key, now.Add(10*time.Second), time.Minute, time.Hour); wait != 50*time.Second || !ok {
+		t.Errorf("second fetch waits %s (%t), want 50s", wait, ok)
+	}
+	if wait, ok := reserveFetch(key, now.Add(10*time.Second), time.Minute, time.Hour); wait != 110*time.Second || !ok {
+		t.Errorf("third fetch waits %s (%t), want 110s after the second", wait, ok)
+	}
+
+	// Refused callers don't reserve a slot, so they can't push later ones back.
+	for range 5 {
+		if _, ok := reserveFetch(key, now.Add(10*time.Second), time.Minute, time.Second); ok {
+			t.Fatal("fetch beyond maxWait was reserved")
+		}
+	}
+	if wait, ok := reserveFetch(key, now.Add(10*time.Second), time.Minute, time.Hour); wait != 170*time.Second || !ok {
+		t.Errorf("fetch after refused ones waits %s (%t), want 170s", wait, ok)
+	}
+
+	if wait, ok := reserveFetch(key, now.Add(5*time.Minute), time.Minute, time.Hour); wait != 0 || !ok {
+		t.Errorf("fetch after the interval waits %s (%t), want 0", wait, ok)
+	}
+}
+
+func TestSpaceLiveFetch(t *testing.T) {
+	const key = "redacted_torrent_ID_9302"
+	defer clearCache("redacted", 9302)
+	defer func() {
+		liveFetchesLock.Lock()
+		delete(liveFetches, key)
+		liveFetchesLock.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if data, err := spaceLiveFetch(ctx, key, "redacted", 0); data != nil || err != nil {
+		t.Errorf("disabled spaceLiveFetch() = %v, %v, want nothing", data, err)
+	}
+
+	if data, err := spaceLiveFetch(ctx, key, "redacted", time.Minute); data != nil || err != nil {
+		t.Fatalf("first spaceLiveFetch() = %v, %v, want a live fetch", data, err)
+	}
+	if _, err := spaceLiveFetch(ctx, key, "redacted", time.Minute); err == nil {
+		t.Error("refetch within the interval was allowed without cached data")
+	}
+
+	// A short interval is waited out, unless the context ends first.
+	const shortKey = key + "_short"
+	defer func() {
+		liveFetchesLock.Lock()
+		delete(liveFetches, shortKey)
+		liveFetchesLock.Unlock()
+	}()
+	spaceLiveFetch(ctx, shortKey, "redacted", 50*time.Millisecond)
+	if _, err := spaceLiveFetch(ctx, shortKey, "redacted", 50*time.Millisecond); err != nil {
+		t.Errorf("spaceLiveFetch() within the timeout = %v, want it to wait", err)
+	}
+	canceled, cancelNow := context.WithTimeout(context.Background(), time.Second)
+	cancelNow()
+	if _, err := spaceLiveFetch(canceled, shortKey, "redacted", 50*time.Millisecond); !errors.Is(err, context.Canceled) {
+		t.Errorf("spaceLiveFetch() with a canceled context = %v, want context.Canceled", err)
+	}
+
+	cached := &ResponseData{Status: "success"}
+	cacheResponseData(key, cached)
+	if data, err := spaceLiveFetch(ctx, key, "redacted", time.Minute); data != cached || err != nil {
+		t.Errorf("spaceLiveFetch() = %v, %v, want the cached data", data, err)
+	}
+}
+
+func TestCacheClearHandler(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := cfg.Authorization.APIToken
+	defer func() { cfg.Authorization.APIToken = previous }()
+	cfg.Authorization.APIToken = "testtoken"
+
+	seed := func() {
+		cacheResponseData("redacted_torrent_ID_1", &ResponseData{})
+		cacheResponseData("redacted_torrent_ID_12", &ResponseData{})
+		cacheResponseData("redacted_user_ID_1", &ResponseData{})
+		cacheResponseData("ops_torrent_ID_1", &ResponseData{})
+	}
+	defer clearCache("", 0)
+
+	tests := []struct {
+		name        string
+		token       string
+		body        string
+		wantStatus  int
+		wantEvicted int
+	}{
+		{name: "Missing token", body: "", wantStatus: http.StatusUnauthorized},
+		{name: "Everything", token: "testtoken", body: "", wantStatus: http.StatusOK, wantEvicted: 4},
+		{name: "Indexer", token: "testtoken", body: `{"indexer": "redacted"}`, wantStatus: http.StatusOK, wantEvicted: 3},
+		{name: "Torrent", token: "testtoken", body: `{"torrent_id": 1}`, wantStatus: http.StatusOK, wantEvicted: 2},
+		{name: "Indexer and torrent", token: "testtoken", body: `{"indexer": "redacted", "torrent_id": 1}`, wantStatus: http.StatusOK, wantEvicted: 1},
+		{name: "Invalid JSON", token: "testtoken", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearCache("", 0)
+			seed()
+
+			req := httptest.NewRequest(http.MethodPost, "/cache/clear", strings.NewReader(tt.body))
+			req.Header.Set("X-API-Token", tt.token)
+			rec := httptest.NewRecorder()
+			CacheClearHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got map[string]int
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got["evicted"] != tt.wantEvicted {
+				t.Errorf("evicted = %d, want %d", got["evicted"], tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestRipperAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		torrent TorrentData
+		rippers []string
+		want    bool
+	}{
+		{"No log", TorrentData{Ripper: "EAC"}, []string{"eac"}, false},
+		{"Reported ripper allowed", TorrentData{HasLog: true, Ripper: "XLD"}, []string{"xld"}, true},
+		{"Reported ripper not allowed", TorrentData{HasLog: true, Ripper: "whipper"}, []string{"eac", "xld"}, false},
+		{"Full ripper name", TorrentData{HasLog: true, Ripper: "Exact Audio Copy"}, []string{"eac"}, true},
+		{"Scored log, both logchecker rippers allowed", TorrentData{HasLog: true, LogScore: 100}, []string{"eac", "xld"}, true},
+		{"Scored log, one logchecker ripper allowed", TorrentData{HasLog: true, LogScore: 100}, []string{"eac"}, false},
+		{"Unscored log", TorrentData{HasLog: true}, []string{"eac", "xld"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, detail := ripperAllowed(&tt.torrent, tt.rippers); got != tt.want {
+				t.Errorf("ripperAllowed() = %t (%s), want %t", got, detail, tt.want)
+			}
+		})
+	}
+}
+
+func TestTorrentFlag(t *testing.T) {
+	var torrent TorrentData
+	if err := json.Unmarshal([]byte(`{"id": 1, "scene": true, "isTrumpable": "0", "remastered": 1, "tag": "gold", "unknown": null}`), &torrent); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if torrent.ID != 1 {
+		t.Errorf("ID = %d, want the known fields decoded too", torrent.ID)
+	}
+
+	tests := []struct {
+		name      string
+		wantValue bool
+		wantOK    bool
+	}{
+		{"scene", true, true},
+		{"istrumpable", false, true},
+		{"Remastered", true, true},
+		{"tag", false, false},
+		{"unknown", false, false},
+		{"missing", false, false},
+	}
+	for _, tt := range tests {
+		if value, ok := torrent.flag(tt.name); value != tt.wantValue || ok != tt.wantOK {
+			t.Errorf("flag(%q) = %t, %t, want %t, %t", tt.name, value, ok, tt.wantValue, tt.wantOK)
+		}
+	}
+}
+
+func TestOPSFlagsApply(t *testing.T) {
+	if opsFlagsApply("redacted") {
+		t.Error("ops_require_flags applied to a RED request")
+	}
+	if !opsFlagsApply("ops") {
+		t.Error("ops_require_flags not applied to an OPS request")
+	}
+}
+
+func TestLineageText(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want lineageText
+	}{
+		{"String", `{"lineage": "SBD > DAT"}`, "SBD > DAT"},
+		{"List", `{"lineage": ["SBD > DAT", "DAT > FLAC"]}`, "SBD > DAT\nDAT > FLAC"},
+		{"Null", `{"lineage": null}`, ""},
+		{"Unexpected shape", `{"lineage": {"source": "SBD"}}`, ""},
+		{"Missing", `{}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var torrent TorrentData
+			if err := json.Unmarshal([]byte(tt.json), &torrent); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if torrent.Lineage != tt.want {
+				t.Errorf("Lineage = %q, want %q", torrent.Lineage, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownFlagValues(t *testing.T) {
+	var torrent TorrentData
+	data := `{"id": 1, "freeTorrent": "gold", "isFreeleech": "yes", "isNeutralLeech": 2, "hasLog": true}`
+	if err := json.Unmarshal([]byte(data), &torrent); err != nil {
+		t.Fatalf("Unmarshal() error = %v, want unknown values to decode", err)
+	}
+	if torrent.FreeTorrent != freeleechNone || torrent.IsFreeleech || torrent.IsNeutralLeech {
+		t.Errorf("unknown values decoded as %+v, want false", torrent)
+	}
+	if !torrent.HasLog || torrent.ID != 1 {
+		t.Errorf("known fields not decoded next to unknown values: %+v", torrent)
+	}
+}
+
+func TestCueLogMismatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		torrent *TorrentData
+		want    string
+	}{
+		{name: "CD with log and cue", torrent: &TorrentData{Media: "CD", HasLog: true, HasCue: true}, want: ""},
+		{name: "CD with neither", torrent: &TorrentData{Media: "CD"}, want: ""},
+		{name: "CD with log only", torrent: &TorrentData{Media: "CD", HasLog: true}, want: "log without cue"},
+		{name: "CD with cue only", torrent: &TorrentData{Media: "CD", HasCue: true}, want: "cue without log"},
+		{name: "WEB is skipped", torrent: &TorrentData{Media: "WEB", HasCue: true}, want: ""},
+		{name: "Vinyl is skipped", torrent: &TorrentData{Media: "Vinyl", HasLog: true}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := cueLogMismatch(tt.torrent); got != tt.want {
+				t.Errorf("cueLogMismatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatioBelow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		ratio   float64
+		minimum float64
+		epsilon float64
+		want    bool
+	}{
+		{name: "Exactly at threshold", ratio: 1.0, minimum: 1.0, epsilon: config.DefaultRatioEpsilon, want: false},
+		{name: "Exactly at threshold without epsilon", ratio: 1.0, minimum: 1.0, epsilon: 0, want: false},
+		{name: "Rounding error below threshold", ratio: 0.9999999, minimum: 1.0, epsilon: config.DefaultRatioEpsilon, want: false},
+		{name: "Rounding error without epsilon", ratio: 0.9999999, minimum: 1.0, epsilon: 0, want: true},
+		{name: "Clearly below", ratio: 0.99, minimum: 1.0, epsilon: config.DefaultRatioEpsilon, want: true},
+		{name: "Above", ratio: 1.01, minimum: 1.0, epsilon: config.DefaultRatioEpsilon, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ratioBelow(tt.ratio, tt.minimum, tt.epsilon); got != tt.want {
+				t.Errorf("ratioBelow(%v, %v, %v) = %v, want %v", tt.ratio, tt.minimum, tt.epsilon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrencyPerIndexer(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := cfg.API.MaxConcurrentPerIndexer
+	defer func() { cfg.API.MaxConcurrentPerIndexer = previous }()
+	cfg.API.MaxConcurrentPerIndexer = 1
+
+	unblock := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Write([]byte(`{"status": "success", "response": {}}`))
+	}))
+	defer slow.Close()
+	defer close(unblock)
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "success", "response": {}}`))
+	}))
+	defer fast.Close()
+
+	newClient := func(timeout time.Duration) *APIClient {
+		return &APIClient{client: http.DefaultClient, limiter: rate.NewLimiter(rate.Inf, 0), timeout: timeout}
+	}
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		_ = makeRequest(slow.URL, "key", newClient(5*time.Second), "redacted", &ResponseData{})
+	}()
+	<-started
+	// Give the slow request time to take the only redacted slot.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := makeRequest(fast.URL, "key", newClient(time.Second), "ops", &ResponseData{}); err != nil {
+		t.Fatalf("ops request blocked by slow redacted request: %v", err)
+	}
+
+	err := makeRequest(fast.URL, "key", newClient(100*time.Millisecond), "redacted", &ResponseData{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second redacted request error = %v, want it to wait for a slot until the deadline", err)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.db")
+	if err := StartAnalytics(path); err != nil {
+		t.Fatalf("StartAnalytics() error = %v", err)
+	}
+
+	recordAnalytics(Decision{RequestID: "a", Timestamp: time.Now().UTC(), Indexer: "redacted", TorrentID: 1, Approved: true, Status: http.StatusOK}, &TorrentData{Format: "FLAC", Encoding: "Lossless", Media: "CD"})
+	recordAnalytics(Decision{RequestID: "b", Timestamp: time.Now().UTC(), Indexer: "ops", TorrentID: 2, Status: StatusSizeNotAllowed, Reason: ErrSizeNotAllowed}, nil)
+	StopAnalytics()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open analytics database: %v", err)
+	}
+	defer db.Close()
+
+	var rejected int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM decisions WHERE approved = 0`).Scan(&rejected); err != nil {
+		t.Fatalf("query rejected decisions: %v", err)
+	}
+	if rejected != 1 {
+		t.Errorf("rejected decisions = %d, want 1", rejected)
+	}
+
+	var format string
+	if err := db.QueryRow(`SELECT format FROM decisions WHERE request_id = 'a'`).Scan(&format); err != nil {
+		t.Fatalf("query approved decision: %v", err)
+	}
+	if format != "FLAC" {
+		t.Errorf("format = %q, want FLAC", format)
+	}
+
+	// Recording without a running writer is a no-op.
+	recordAnalytics(Decision{RequestID: "c"}, nil)
+}
+
+func TestQuota(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	defer func() { quotaGrabs = nil }()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.ParsedSizes.QuotaMaxSize = 500 * bytesize.MB
+	cfg.Quota.Window = time.Hour
+	quotaGrabs = nil
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+		req.Header.Set("X-API-Token", "testtoken")
+		recorder := httptest.NewRecorder()
+		WebhookHandler(recorder, req)
+		return recorder.Code
+	}
+
+	// A release rejected by a later hook takes no share of the quota.
+	if status := post(`{"indexer": "mock", "torrent_id": 123, "uploaders": "uploader1", "mode": "blacklist"}`); status == http.StatusOK {
+		t.Fatal("blacklisted uploader was approved")
+	}
+	if used := quotaUsed(time.Now(), time.Hour); used != 0 {
+		t.Errorf("quotaUsed() after a rejection = %s, want 0", used)
+	}
+
+	// The fixture torrent is 300MB, so only one of a burst fits in the quota.
+	var wg sync.WaitGroup
+	var approved atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch status := post(`{"indexer": "mock", "torrent_id": 123}`); status {
+			case http.StatusOK:
+				approved.Add(1)
+			case StatusQuotaExceeded:
+			default:
+				t.Errorf("status = %d, want %d or %d", status, http.StatusOK, StatusQuotaExceeded)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := approved.Load(); n != 1 {
+		t.Errorf("%d concurrent requests approved, want 1", n)
+	}
+
+	if used := quotaUsed(time.Now().Add(2*time.Hour), time.Hour); used != 0 {
+		t.Errorf("quotaUsed() after the window = %s, want 0", used)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	window := 5 * time.Minute
+
+	request := func(timestamp, nonce string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/hook", nil)
+		if timestamp != "" {
+			req.Header.Set("X-Timestamp", timestamp)
+		}
+		if nonce != "" {
+			req.Header.Set("X-Nonce", nonce)
+		}
+		return req
+	}
+
+	fresh := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	if err := verifyReplay(request("", ""), 0, now); err != nil {
+		t.Errorf("verifyReplay() with the check disabled = %v, want nil", err)
+	}
+	if err := verifyReplay(request("", ""), window, now); !errors.Is(err, errMissingReplayHeaders) {
+		t.Errorf("verifyReplay() without headers = %v, want %v", err, errMissingReplayHeaders)
+	}
+	if err := verifyReplay(request(stale, "replay-test-1"), window, now); !errors.Is(err, errStaleTimestamp) {
+		t.Errorf("verifyReplay() with a stale timestamp = %v, want %v", err, errStaleTimestamp)
+	}
+	if err := verifyReplay(request(fresh, "replay-test-2"), window, now); err != nil {
+		t.Errorf("verifyReplay() with a fresh request = %v, want nil", err)
+	}
+	if err := verifyReplay(request(fresh, "replay-test-2"), window, now); !errors.Is(err, errReplayedNonce) {
+		t.Errorf("verifyReplay() with a reused nonce = %v, want %v", err, errReplayedNonce)
+	}
+	later := now.Add(time.Hour)
+	if err := verifyReplay(request(strconv.FormatInt(later.Unix(), 10), "replay-test-2"), window, later); err != nil {
+		t.Errorf("verifyReplay() with an expired nonce = %v, want nil", err)
+	}
+
+	removeExpiredNonces(later.Add(time.Hour))
+	seenNoncesLock.Lock()
+	_, kept := seenNonces["replay-test-2"]
+	seenNoncesLock.Unlock()
+	if kept {
+		t.Error("removeExpiredNonces() kept an expired nonce")
+	}
+}
+
+func TestQBittorrentDuplicate(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	var torrents string
+	logins := 0
+	qbt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/auth/login":
+			if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+				io.WriteString(w, "Fails.")
+				return
+			}
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session", Path: "/"})
+			io.WriteString(w, "Ok.")
+		case "/api/v2/torrents/info":
+			if cookie, err := r.Cookie("SID"); err != nil || cookie.Value != "session" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			io.WriteString(w, torrents)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer qbt.Close()
+
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.Mock.Enabled = true
+	cfg.Mock.FixturesDir = filepath.Join("testdata", "mock")
+	cfg.Integrations.QBittorrent = config.QBittorrent{URL: qbt.URL, Username: "admin", Password: "secret"}
+
+	tests := []struct {
+		name     string
+		torrents string
+		want     int
+	}{
+		{"Not in client", `[{"name": "Other Artist - Other Album (2021) [FLAC]", "hash": "abc"}]`, http.StatusOK},
+		{"Same name", `[{"name": "example artist - example album (2020) [flac]", "hash": "abc"}]`, StatusAlreadyInClient},
+		{"Invalid response", `not json`, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			torrents = tt.torrents
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "mock", "torrent_id": 123}`))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d (body: %s)", recorder.Code, tt.want, recorder.Body.String())
+			}
+		})
+	}
+
+	if logins != 1 {
+		t.Errorf("logins = %d, want 1", logins)
+	}
+}
+
+func TestHandleErrorsExposeUpstream(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	err := fmt.Errorf("torrent hook failed: %w", apiFailure("redacted", "bad id parameter"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("apiFailure() error does not wrap ErrNotFound")
+	}
+
+	tests := []struct {
+		name   string
+		expose bool
+		want   string
+	}{
+		{"Hidden by default", false, "Internal Server Error\n"},
+		{"Exposed", true, "redacted returned 200: bad id parameter\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.API.ExposeUpstreamErrors = tt.expose
+			recorder := httptest.NewRecorder()
+
+			status := handleErrors(recorder, err)
+
+			if status != http.StatusInternalServerError {
+				t.Errorf("status = %d, want %d", status, http.StatusInternalServerError)
+			}
+			if recorder.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", recorder.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizationValue(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	tests := []struct {
+		scheme string
+		want   string
+	}{
+		{scheme: "", want: "secret"},
+		{scheme: "token", want: "token secret"},
+		{scheme: "Bearer ", want: "Bearer secret"},
+	}
+
+	for _, tt := range tests {
+		cfg.API.AuthScheme = tt.scheme
+		if got := authorizationValue("secret"); got != tt.want {
+			t.Errorf("authorizationValue() with scheme %q = %q, want %q", tt.scheme, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamMessage(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"status": "failure", "error": "bad credentials"}`, "bad credentials"},
+		{"  Service Unavailable\n", "Service Unavailable"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := upstreamMessage(strings.NewReader(tt.body)); got != tt.want {
+			t.Errorf("upstreamMessage(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderValue(t *testing.T) {
+	t.Parallel()
+
+	if got := headerValue("line one\r\nline\ttwo"); got != "line one  line two" {
+		t.Errorf("headerValue() = %q, want control characters replaced with spaces", got)
+	}
+}
+
+func TestFirstSourceTag(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		release string
+		tags    []string
+		want    string
+	}{
+		{name: "Bracketed tag", release: "Artist - Album (1979) [Vinyl-24bit]", tags: []string{"sacd", "vinyl"}, want: "vinyl"},
+		{name: "Multi-token tag", release: "Artist - Album WEB.DL FLAC", tags: []string{"web-dl"}, want: "web-dl"},
+		{name: "Whole tokens only", release: "Artist - Vinylize (2020) [FLAC]", tags: []string{"vinyl"}},
+		{name: "Joined tokens differ", release: "Artist - Album WEBDL", tags: []string{"web-dl"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := firstSourceTag(nameTokens(tt.release), tt.tags)
+			if got != tt.want || found != (tt.want != "") {
+				t.Errorf("firstSourceTag() = %q, %t, want %q", got, found, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectStatus(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+
+	cfg.StatusCodes = map[string]int{"ratio": 460}
+
+	tests := []struct {
+		name      string
+		rejection *rejectionError
+		want      int
+	}{
+		{"Custom code", &rejectionError{hook: "ratio", reason: ErrRatioBelowMinimum}, 460},
+		{"Default code", &rejectionError{hook: "uploader", reason: ErrUploaderNotAllowed}, StatusUploaderNotAllowed},
+		{"Unknown reason", &rejectionError{hook: "other", reason: "something else"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rejectStatus(tt.rejection); got != tt.want {
+				t.Errorf("rejectStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIndexerConfigured(t *testing.T) {
+	tests := []struct {
+		name    string
+		request RequestData
+		wantErr string
+	}{
+		{"Key present", RequestData{Indexer: "redacted", REDKey: "key"}, ""},
+		{"Mock needs no key", RequestData{Indexer: "mock"}, ""},
+		{"Only other indexer configured", RequestData{Indexer: "redacted", OPSKey: "key"}, "RED is not configured on this instance: no API key in the config or request, only OPS is"},
+		{"Nothing configured", RequestData{Indexer: "ops"}, "OPS is not configured on this instance: no API key in the config or request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkIndexerConfigured(&tt.request)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkIndexerConfigured() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkIndexerConfigured() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPolledUser(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	defer func() { polledUsers = make(map[string]polledUser) }()
+	defer setRatioPollInterval(0)
+
+	now := time.Now()
+	data := &ResponseData{}
+	data.Response.Stats.Ratio = 1.5
+	storePolledUser("redacted", 1, data, now)
+
+	// Only the interval the poller started with counts, not a reloaded one.
+	cfg.Ratio.PollInterval = 10 * time.Minute
+	if _, ok := loadPolledUser("redacted", 1, now); ok {
+		t.Errorf("loadPolledUser() found stats with polling disabled")
+	}
+
+	setRatioPollInterval(10 * time.Minute)
+	cfg.Ratio.PollInterval = time.Minute
+	if got, ok := loadPolledUser("redacted", 1, now.Add(15*time.Minute)); !ok || got.Response.Stats.Ratio != 1.5 {
+		t.Errorf("loadPolledUser() = %v, %t, want the polled stats", got, ok)
+	}
+	if _, ok := loadPolledUser("ops", 1, now); ok {
+		t.Errorf("loadPolledUser() found stats for another indexer")
+	}
+	if _, ok := loadPolledUser("redacted", 1, now.Add(25*time.Minute)); ok {
+		t.Errorf("loadPolledUser() returned stats older than two intervals")
+	}
+}
+
+func TestRawNameList(t *testing.T) {
+	got := rawNameList(splitList("Uploader1\u200b, uploader2\u00a0,upl\u043eader3"))
+	want := []string{"uploader1\u200b", "uploader2\u00a0", "upl\u043eader3"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("rawNameList() = %q, want %q", got, want)
+	}
+
+	hint := uploaderMismatchHint("uploader2", got)
+	if !strings.Contains(hint, "whitespace U+00A0") {
+		t.Errorf("uploaderMismatchHint() = %q, want the non-breaking space pointed out", hint)
+	}
+}
+
+func TestUploaderMismatchHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		entries  []string
+		want     string
+	}{
+		{"Typo", "uploader1", []string{"someone", "uploadr1"}, "closest list entry is 'uploadr1' (1 edits away)"},
+		{"Zero width space", "uploader1", []string{"uploader1\u200b"}, "closest list entry is 'uploader1\u200b' (1 edits away); list entry 'uploader1\u200b' contains invisible U+200B at position 10"},
+		{"Cyrillic lookalike", "uploader1", []string{"uplo\u0430der1"}, "closest list entry is 'uplo\u0430der1' (1 edits away); list entry 'uplo\u0430der1' contains non-ASCII '\u0430' (U+0430) at position 5"},
+		{"Nothing close", "uploader1", []string{"someone"}, ""},
+		{"Empty list", "uploader1", []string{""}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uploaderMismatchHint(tt.username, tt.entries); got != tt.want {
+				t.Errorf("uploaderMismatchHint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"Combining accent", "Cafe\u0301 Records", "Café Records"},
+		{"Curly apostrophe", "Rock’n’Roll Records", "Rock'n'Roll Records"},
+		{"Curly quotes", "“Heavenly” Recordings", `"Heavenly" Recordings`},
+		{"Non-breaking space", "Ninja\u00a0Tune", "ninja tune"},
+		{"Repeated spaces", "  Ninja   Tune ", "Ninja Tune"},
+		{"En dash", "Warp – Records", "Warp - Records"},
+		{"Zero width space", "uploader\u200b1", "uploader1"},
+		{"HTML entity", "Tom &amp; Jerry", "tom & jerry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := normalizeName(tt.a), normalizeName(tt.b); a != b {
+				t.Errorf("normalizeName(%q) = %q, normalizeName(%q) = %q, want equal", tt.a, a, tt.b, b)
+			}
+		})
+	}
+
+	if a, b := normalizeName("Café"), normalizeName("Cafe"); a == b {
+		t.Errorf("normalizeName() folded the accent in %q", a)
+	}
+}
+
+func TestAPICallCount(t *testing.T) {
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("action") == "user" {
+			io.WriteString(w, `{"status": "success", "response": {"username": "me", "stats": {"ratio": 1.25}}}`)
+			return
+		}
+		io.WriteString(w, `{"status": "success", "response": {"torrent": {"id": 9101, "username": "uploader1", "size": 314572800}}}`)
+	}))
+	defer tracker.Close()
+
+	previousBase := apiBases["redacted"]
+	apiBases["redacted"] = tracker.URL
+	defer func() { apiBases["redacted"] = previousBase }()
+	defer clearCache("redacted", 0)
+
+	for i, want := range []int{2, 0} {
+		requestData := RequestData{Indexer: "redacted", REDKey: "redkey", TorrentID: 9101, REDUserID: 9102, MinRatio: 1.0, MinSize: bytesize.MB}
+		if err := processRequest(&requestData); err != nil {
+			t.Fatalf("request %d: processRequest() = %v", i+1, err)
+		}
+		if requestData.apiCalls != want {
+			t.Errorf("request %d: apiCalls = %d, want %d", i+1, requestData.apiCalls, want)
+		}
+	}
+}
+
+func TestRequestWithKeys(t *testing.T) {
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			io.WriteString(w, `{"status": "success", "response": {"torrent": {"id": 9201, "username": "uploader1", "size": 1024}}}`)
+		}
+	}))
+	defer tracker.Close()
+
+	previousLimiter := redactedLimiter
+	redactedLimiter = rate.NewLimiter(rate.Inf, 0)
+	defer func() { redactedLimiter = previousLimiter }()
+
+	tests := []struct {
+		name      string
+		keys      []string
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "First key works", keys: []string{"good", "other"}, wantCalls: 1},
+		{name: "Rate limited key", keys: []string{"limited", "good"}, wantCalls: 2},
+		{name: "Revoked key", keys: []string{"revoked", "limited", "good"}, wantCalls: 3},
+		{name: "Every key fails", keys: []string{"limited", "revoked"}, wantErr: true, wantCalls: 2},
+		{name: "Tracker error is not retried", keys: []string{"broken", "good"}, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestData := RequestData{Indexer: "redacted"}
+			_, err := requestWithKeys(&requestData, 9201, "torrent", tt.keys, tracker.URL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("requestWithKeys() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if requestData.apiCalls != tt.wantCalls {
+				t.Errorf("apiCalls = %d, want %d", requestData.apiCalls, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("Locally limited key", func(t *testing.T) {
+		redactedLimiter = rate.NewLimiter(0, 0)
+		keyLimitersLock.Lock()
+		keyLimiters["redacted\x00spare"] = rate.NewLimiter(rate.Inf, 0)
+		keyLimitersLock.Unlock()
+		defer func() {
+			keyLimitersLock.Lock()
+			delete(keyLimiters, "redacted\x00spare")
+			keyLimitersLock.Unlock()
+		}()
+
+		failed := apiCallCounters["redacted"].failed.Load()
+		requestData := RequestData{Indexer: "redacted"}
+		if _, err := requestWithKeys(&requestData, 9201, "torrent", []string{"good", "spare"}, tracker.URL); err != nil {
+			t.Fatalf("requestWithKeys() error = %v", err)
+		}
+		// The refusal of the local limiter never reached the tracker.
+		if requestData.apiCalls != 1 {
+			t.Errorf("apiCalls = %d, want 1", requestData.apiCalls)
+		}
+		if got := apiCallCounters["redacted"].failed.Load(); got != failed {
+			t.Errorf("failed API calls went from %d to %d, want no change", failed, got)
+		}
+	})
+}
+
+func TestEmptyResponseRetry(t *testing.T) {
+	previousDelay := emptyResponseRetryDelay
+	emptyResponseRetryDelay = 0
+	defer func() { emptyResponseRetryDelay = previousDelay }()
+
+	tests := []struct {
+		name      string
+		bodies    []string
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "Empty body once", bodies: []string{"", `{"status": "success", "response": {"username": "me"}}`}, wantCalls: 2},
+		{name: "Empty object once", bodies: []string{"{}", `{"status": "success", "response": {"username": "me"}}`}, wantCalls: 2},
+		{name: "Empty twice", bodies: []string{" ", ""}, wantErr: errEmptyResponse, wantCalls: 2},
+		{name: "API error is not retried", bodies: []string{`{"status": "failure", "error": "bad id parameter"}`}, wantErr: ErrNotFound, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, tt.bodies[min(calls, len(tt.bodies)-1)])
+				calls++
+			}))
+			defer tracker.Close()
+
+			_, counted, err := requestWithLimiter(1, "user", "key", tracker.URL, "redacted", time.Second, rate.NewLimiter(rate.Inf, 0))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("requestWithLimiter() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("tracker got %d calls, want %d", calls, tt.wantCalls)
+			}
+			if counted != calls {
+				t.Errorf("requestWithLimiter() counted %d calls, want %d", counted, calls)
+			}
+		})
+	}
+
+	// The wait before the retry ends with the request timeout.
+	emptyResponseRetryDelay = time.Hour
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tracker.Close()
+	start := time.Now()
+	if _, _, err := requestWithLimiter(1, "user", "key", tracker.URL, "redacted", 100*time.Millisecond, rate.NewLimiter(rate.Inf, 0)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("requestWithLimiter() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("requestWithLimiter() took %s, want it to stop at the timeout", elapsed)
+	}
+}
+
+func TestIndexerStatus(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tests := []struct {
+		name         string
+		lastSuccess  time.Time
+		lastError    time.Time
+		window       time.Duration
+		wantDegraded bool
+	}{
+		{name: "Never called", window: time.Hour},
+		{name: "Only successes", lastSuccess: now.Add(-2 * time.Hour), window: time.Hour},
+		{name: "Recovered", lastSuccess: now.Add(-time.Minute), lastError: now.Add(-2 * time.Minute), window: time.Hour},
+		{name: "Failing recently", lastSuccess: now.Add(-10 * time.Minute), lastError: now.Add(-time.Minute), window: time.Hour},
+		{name: "Failing too long", lastSuccess: now.Add(-2 * time.Hour), lastError: now.Add(-time.Minute), window: time.Hour, wantDegraded: true},
+		{name: "Never succeeded", lastError: now.Add(-time.Minute), window: time.Hour, wantDegraded: true},
+		{name: "Disabled", lastError: now.Add(-time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &apiCallCounter{}
+			if !tt.lastSuccess.IsZero() {
+				counter.lastSuccess.Store(tt.lastSuccess.UnixNano())
+			}
+			if !tt.lastError.IsZero() {
+				counter.lastError.Store(tt.lastError.UnixNano())
+			}
+
+			status := counter.status("redacted", now, tt.window)
+			if status.Degraded != tt.wantDegraded {
+				t.Errorf("Degraded = %t, want %t", status.Degraded, tt.wantDegraded)
+			}
+			if (status.LastSuccess != nil) != !tt.lastSuccess.IsZero() || (status.LastError != nil) != !tt.lastError.IsZero() {
+				t.Errorf("status = %+v, want timestamps only for calls made", status)
+			}
+		})
+	}
+}
+
+func TestGetAPIKeys(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	cfg.IndexerKeys.REDKeys = []string{"first", "second", "", "third"}
+
+	got, err := getAPIKeys(&RequestData{Indexer: "redacted", REDKey: "second"})
+	if err != nil {
+		t.Fatalf("getAPIKeys() error = %v", err)
+	}
+	if want := "second,first,third"; strings.Join(got, ",") != want {
+		t.Errorf("getAPIKeys() = %v, want %s", got, want)
+	}
+
+	got, _ = getAPIKeys(&RequestData{Indexer: "ops", OPSKey: "opskey"})
+	if len(got) != 1 || got[0] != "opskey" {
+		t.Errorf("getAPIKeys() for ops = %v, want only the OPS key", got)
+	}
+
+	got, _ = getAPIKeys(&RequestData{Indexer: "redacted", REDKey: "second", APIBase: "https://staging.example"})
+	if len(got) != 1 || got[0] != "second" {
+		t.Errorf("getAPIKeys() with api_base = %v, want only the request's key", got)
+	}
+}
+
+func TestAPIBaseOverride(t *testing.T) {
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status": "success", "response": {"torrent": {"id": 9201, "username": "staginguser", "size": 314572800}}}`)
+	}))
+	defer staging.Close()
+
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	cfg.Authorization.APIToken = "testtoken"
+	cfg.IndexerKeys.REDKey = "redkey"
+
+	previousLimiter := redactedLimiter
+	redactedLimiter = rate.NewLimiter(rate.Inf, 0)
+	defer func() { redactedLimiter = previousLimiter }()
+	defer clearCache("redacted", 0)
+
+	tests := []struct {
+		name       string
+		allowed    bool
+		payload    string
+		wantStatus int
+	}{
+		{"Override disabled", false, `{"indexer": "redacted", "torrent_id": 9201, "uploaders": "staginguser", "mode": "blacklist", "api_base": "` + staging.URL + `"}`, http.StatusBadRequest},
+		{"Override enabled", true, `{"indexer": "redacted", "torrent_id": 9201, "uploaders": "staginguser", "mode": "blacklist", "api_base": "` + staging.URL + `"}`, StatusUploaderNotAllowed},
+		{"Not an HTTP URL", true, `{"indexer": "redacted", "torrent_id": 9201, "uploaders": "staginguser", "api_base": "file:///etc/passwd"}`, http.StatusBadRequest},
+		{"Mock indexer", true, `{"indexer": "mock", "torrent_id": 123, "uploaders": "staginguser", "api_base": "` + staging.URL + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.API.AllowAPIBaseOverride = tt.allowed
+
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("WebhookHandler() status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+
+	// An override answering 401 never gets the rest of the red_apikeys chain.
+	var keysSeen []string
+	var keysLock sync.Mutex
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keysLock.Lock()
+		keysSeen = append(keysSeen, r.Header.Get("Authorization"))
+		keysLock.Unlock()
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer rejecting.Close()
+	cfg.API.AllowAPIBaseOverride = true
+	cfg.IndexerKeys.REDKeys = []string{"spare1", "spare2"}
+
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"indexer": "redacted", "torrent_id": 9203, "uploaders": "staginguser", "mode": "whitelist", "api_base": "`+rejecting.URL+`"}`))
+	req.Header.Set("X-API-Token", "testtoken")
+	WebhookHandler(httptest.NewRecorder(), req)
+	keysLock.Lock()
+	if len(keysSeen) != 1 || keysSeen[0] != "redkey" {
+		t.Errorf("override received keys %v, want only redkey", keysSeen)
+	}
+	keysLock.Unlock()
+
+	// The response cached from the override is cleared by torrent ID, without
+	// touching the other torrents.
+	cacheResponseData("redacted_torrent_ID_9202", &ResponseData{})
+	if evicted := clearCache("redacted", 9201); evicted != 1 {
+		t.Errorf("clearCache() of the overridden torrent evicted %d, want 1", evicted)
+	}
+	if _, found := checkCache("redacted_torrent_ID_9202", "redacted"); !found {
+		t.Error("clearCache() evicted another torrent")
+	}
+}
+
+func TestWebhookHandlerEndToEnd(t *testing.T) {
+	const (
+		torrentID = 9001
+		userID    = 9002
+	)
+
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "redkey" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		switch {
+		case query.Get("action") == "torrent" && query.Get("id") == strconv.Itoa(torrentID):
+			io.WriteString(w, `{"status": "success", "response": {
+				"group": {"name": "Album", "recordLabel": "Group Records"},
+				"torrent": {"id": 9001, "username": "uploader1", "size": 314572800, "remasterRecordLabel": "Example Records"}
+			}}`)
+		case query.Get("action") == "user" && query.Get("id") == strconv.Itoa(userID):
+			io.WriteString(w, `{"status": "success", "response": {"username": "me", "stats": {"ratio": 1.25}}}`)
+		default:
+			io.WriteString(w, `{"status": "failure", "error": "bad id parameter"}`)
+		}
+	}))
+	defer tracker.Close()
+
+	cfg := config.GetConfig()
+	previous := *cfg
+	defer func() { *cfg = previous }()
+	cfg.Authorization.APIToken = "testtoken"
+
+	previousBase := apiBases["redacted"]
+	apiBases["redacted"] = tracker.URL
+	defer func() { apiBases["redacted"] = previousBase }()
+	defer clearCache("redacted", 0)
+
+	tests := []struct {
+		name       string
+		filters    string
+		wantStatus int
+	}{
+		{"No filters", ``, http.StatusOK},
+		{"Uploader blacklisted", `"uploaders": "uploader1", "mode": "blacklist"`, StatusUploaderNotAllowed},
+		{"Uploader not blacklisted", `"uploaders": "someone", "mode": "blacklist"`, http.StatusOK},
+		{"Uploader whitelisted", `"uploaders": "uploader1", "mode": "whitelist"`, http.StatusOK},
+		{"Uploader not whitelisted", `"uploaders": "someone", "mode": "whitelist"`, StatusUploaderNotAllowed},
+		{"Label matches", `"record_labels": "Example Records"`, http.StatusOK},
+		{"Label misses", `"record_labels": "Other Records"`, StatusLabelNotAllowed},
+		{"Size in range", `"minsize": "100MB", "maxsize": "500MB"`, http.StatusOK},
+		{"Size below range", `"minsize": "400MB"`, StatusSizeNotAllowed},
+		{"Size above range", `"maxsize": "200MB"`, StatusSizeNotAllowed},
+		{"Ratio above minimum", `"red_user_id": 9002, "minratio": 1.0`, http.StatusOK},
+		{"Ratio below minimum", `"red_user_id": 9002, "minratio": 1.5`, StatusRatioNotAllowed},
+		{"Unknown torrent", `"torrent_id": 1234, "minsize": "1MB"`, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := `{"indexer": "redacted", "red_apikey": "redkey", "torrent_id": 9001`
+			if tt.filters != "" {
+				// A later torrent_id in filters overrides the default one.
+				payload += ", " + tt.filters
+			}
+			payload += "}"
+
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(payload))
+			req.Header.Set("X-API-Token", "testtoken")
+			recorder := httptest.NewRecorder()
+
+			WebhookHandler(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body: %s)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// getAPIKeys returns the keys to try for the request's indexer, in order:
+// the request's own key, then the red_apikeys chain for Redacted. An
+// api_base override only ever gets the first key, so a host chosen by the
+// caller can't collect the whole chain by answering 401 or 429.
+func getAPIKeys(requestData *RequestData) ([]string, error) {
+	apiKey, err := getAPIKey(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := []string{apiKey}
+	if requestData.Indexer != "redacted" || requestData.APIBase != "" {
+		return apiKeys, nil
+	}
+	for _, extra := range config.GetConfig().IndexerKeys.REDKeys {
+		if extra != "" && extra != apiKey {
+			apiKeys = append(apiKeys, extra)
+		}
+	}
+	return apiKeys, nil
+}
+
+// requestWithKeys makes the API call with the first key, moving on to the
+// next one while a key is rate limited or rejected by the tracker. Other
+// errors, and the error of the last key, are returned as is.
+func requestWithKeys(requestData *RequestData, id int, action string, apiKeys []string, apiBase string) (*ResponseData, error) {
+	var lastErr error
+	for i, apiKey := range apiKeys {
+		limiter, err := getKeyLimiter(requestData.Indexer, apiKey, i == 0)
+		if err != nil {
+			return nil, fmt.Errorf("could not get rate limiter for indexer: %s, %w", requestData.Indexer, err)
+		}
+
+		responseData, calls, err := requestWithLimiter(id, action, apiKey, apiBase, requestData.Indexer, requestTimeout(requestData), limiter)
+		// Only calls that reached the tracker count.
+		requestData.apiCalls += calls
+		if calls > 0 {
+			recordAPIResult(requestData.Indexer, err)
+		}
+		if err == nil || !tryNextKey(err) {
+			return responseData, err
+		}
+
+		lastErr = err
+		if i < len(apiKeys)-1 {
+			log.Warn().Str("indexer", requestData.Indexer).Err(err).Msgf("API key %d of %d failed, trying the next one", i+1, len(apiKeys))
+		}
+	}
+	return nil, lastErr
+}
+
+// tryNextKey reports whether err is specific to the key that was used: a
+// rate limit, local or from the tracker, or a 401 for an invalid key.
+func tryNextKey(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var upstream *upstreamError
+	return errors.As(err, &upstream) && upstream.status == http.StatusUnauthorized
+}
+
+// limitedLocally reports whether err is a refusal of our own rate limiter,
+// as opposed to a rate limit from the tracker.
+func limitedLocally(err error) bool {
+	var upstream *upstreamError
+	return errors.Is(err, ErrRateLimited) && !errors.As(err, &upstream)
+}
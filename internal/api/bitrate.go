@@ -0,0 +1,48 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// defaultEncodingBitrates maps lossy encodings to their nominal bitrate in
+// kbps. VBR presets use their typical average. Keys are lowercase.
+var defaultEncodingBitrates = map[string]int{
+	"320":        320,
+	"256":        256,
+	"224":        224,
+	"192":        192,
+	"160":        160,
+	"128":        128,
+	"96":         96,
+	"64":         64,
+	"v0 (vbr)":   245,
+	"apx (vbr)":  245,
+	"v1 (vbr)":   225,
+	"aps (vbr)":  215,
+	"v2 (vbr)":   190,
+	"q8.x (vbr)": 256,
+}
+
+func isLosslessEncoding(encoding string) bool {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "lossless", "24bit lossless":
+		return true
+	default:
+		return false
+	}
+}
+
+// encodingBitrate returns the nominal bitrate of an encoding, preferring the
+// bitrate.encodings config overrides over the built-in table.
+func encodingBitrate(encoding string) (int, bool) {
+	key := strings.ToLower(strings.TrimSpace(encoding))
+
+	if bitrate, ok := config.GetConfig().Bitrate.Encodings[key]; ok {
+		return bitrate, true
+	}
+
+	bitrate, ok := defaultEncodingBitrates[key]
+	return bitrate, ok
+}
@@ -1,10 +1,20 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
 )
 
 const (
@@ -23,6 +33,13 @@ var (
 	done      = make(chan struct{}) // Channel to signal cleanup goroutine to stop
 )
 
+// liveFetches holds the time of the latest live fetch, or the reserved time
+// of the next one, per cache key, for api.min_refetch_interval.
+var (
+	liveFetches     = make(map[string]time.Time)
+	liveFetchesLock sync.Mutex
+)
+
 func init() {
 	go startCacheCleanup()
 }
@@ -49,6 +66,78 @@ func checkCache(cacheKey, indexer string) (*ResponseData, bool) {
 	return nil, false
 }
 
+// cachedWithin returns the cached data for cacheKey if it was fetched less
+// than interval ago, even when the cache entry itself has expired.
+func cachedWithin(cacheKey string, now time.Time, interval time.Duration) (*ResponseData, bool) {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
+
+	if cached, ok := cache[cacheKey]; ok && now.Sub(cached.LastFetched) < interval {
+		return cached.Data, true
+	}
+	return nil, false
+}
+
+// reserveFetch reserves the next live fetch of cacheKey at least interval
+// after the previous one, and returns how long to wait until then. Waiting
+// callers each get their own slot, so a burst is spread out instead of
+// released at once. A slot more than maxWait away is not reserved, and ok is
+// false: a refused caller must not push the slots of later ones back.
+func reserveFetch(cacheKey string, now time.Time, interval, maxWait time.Duration) (wait time.Duration, ok bool) {
+	liveFetchesLock.Lock()
+	defer liveFetchesLock.Unlock()
+
+	next := now
+	if last, found := liveFetches[cacheKey]; found && last.Add(interval).After(now) {
+		next = last.Add(interval)
+	}
+	if wait = next.Sub(now); wait > maxWait {
+		return wait, false
+	}
+	liveFetches[cacheKey] = next
+	return wait, true
+}
+
+// spaceLiveFetch enforces api.min_refetch_interval before a live fetch of
+// cacheKey. Within the interval it serves the last fetched data if there is
+// any, and otherwise waits for the interval to pass, failing when that would
+// outlast ctx.
+func spaceLiveFetch(ctx context.Context, cacheKey, indexer string, interval time.Duration) (*ResponseData, error) {
+	if interval <= 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if data, found := cachedWithin(cacheKey, now, interval); found {
+		log.Debug().Msgf("[%s] Serving %s from the cache, fetched less than %s ago", indexer, cacheKey, interval)
+		return data, nil
+	}
+
+	maxWait := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = deadline.Sub(now)
+	}
+
+	wait, ok := reserveFetch(cacheKey, now, interval, maxWait)
+	if !ok {
+		return nil, fmt.Errorf("%s was fetched less than %s ago, refusing to fetch it again yet", cacheKey, interval)
+	}
+	if wait <= 0 {
+		return nil, nil
+	}
+
+	log.Debug().Msgf("[%s] Waiting %s before fetching %s again", indexer, wait, cacheKey)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting to fetch %s again: %w", cacheKey, ctx.Err())
+	}
+}
+
 func startCacheCleanup() {
 	ticker := time.NewTicker(cacheCleanupInterval)
 	defer ticker.Stop()
@@ -74,6 +163,86 @@ func removeExpiredCacheEntries() {
 			//log.Trace().Msgf("Removed expired cache entry for %s", key)
 		}
 	}
+
+	interval := config.GetConfig().API.MinRefetchInterval
+	liveFetchesLock.Lock()
+	defer liveFetchesLock.Unlock()
+	for key, last := range liveFetches {
+		if now.Sub(last) >= interval {
+			delete(liveFetches, key)
+		}
+	}
+}
+
+// clearCache removes cached responses and returns how many were evicted. An
+// empty indexer matches every indexer, and a zero torrentID matches every
+// entry rather than only that torrent.
+func clearCache(indexer string, torrentID int) int {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	torrentSuffix := fmt.Sprintf("_torrent_ID_%d", torrentID)
+	evicted := 0
+	for key := range cache {
+		if indexer != "" && !strings.HasPrefix(key, indexer+"_") {
+			continue
+		}
+		if torrentID != 0 && !strings.HasSuffix(key, torrentSuffix) {
+			continue
+		}
+		delete(cache, key)
+		evicted++
+	}
+	return evicted
+}
+
+// CacheClearRequest optionally narrows down which cached responses to clear.
+type CacheClearRequest struct {
+	Indexer   string `json:"indexer,omitempty"`
+	TorrentID int    `json:"torrent_id,omitempty"`
+}
+
+// CacheClearHandler empties the response cache, or the part of it matching
+// the indexer and torrent ID in the request body.
+func CacheClearHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := config.GetConfig()
+	if !sourceAllowed(w, r, cfg) {
+		return
+	}
+
+	if err := verifyAPIKey(r.Header.Get("X-API-Token"), cfg.Authorization.APIToken); err != nil {
+		writeHTTPError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	if err := verifyReplay(r, cfg.Authorization.ReplayWindow, time.Now()); err != nil {
+		writeHTTPError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	if err := validateRequestMethod(r.Method); err != nil {
+		writeHTTPError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var request CacheClearRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		writeHTTPError(w, fmt.Errorf("invalid JSON payload: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	request.Indexer = normalizeIndexer(request.Indexer)
+	evicted := clearCache(request.Indexer, request.TorrentID)
+	log.Info().
+		Str("indexer", request.Indexer).
+		Int("torrent_id", request.TorrentID).
+		Msgf("Cache cleared by %s, evicted %d entries", r.RemoteAddr, evicted)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{"evicted": evicted}); err != nil {
+		log.Error().Err(err).Msg("Failed to write cache clear response")
+	}
 }
 
 // StopCache stops the cleanup goroutine gracefully
@@ -2,6 +2,8 @@ package api
 
 import (
 	"github.com/inhies/go-bytesize"
+	"github.com/rs/zerolog/log"
+
 	"github.com/s0up4200/redactedhook/internal/config"
 )
 
@@ -29,21 +31,100 @@ func fallbackToConfig(requestData *RequestData) {
 		}
 	}
 
+	setBool := func(webhookField *bool, configValue bool) {
+		if !*webhookField {
+			*webhookField = configValue
+		}
+	}
+
+	setStrings := func(webhookField *[]string, configValue []string) {
+		if len(*webhookField) == 0 {
+			*webhookField = configValue
+		}
+	}
+
 	setString := func(webhookField *string, configValue string) {
 		if *webhookField == "" {
 			*webhookField = configValue
 		}
 	}
 
+	setList := func(webhookField *listField, configValue string) {
+		if len(*webhookField) == 0 {
+			*webhookField = splitList(configValue)
+		}
+	}
+
 	// Check and set the fields, ensuring webhook data takes priority if present
 	setInt(&requestData.REDUserID, cfg.UserIDs.REDUserID)
 	setInt(&requestData.OPSUserID, cfg.UserIDs.OPSUserID)
 	setString(&requestData.REDKey, cfg.IndexerKeys.REDKey)
+	if len(cfg.IndexerKeys.REDKeys) > 0 {
+		setString(&requestData.REDKey, cfg.IndexerKeys.REDKeys[0])
+	}
 	setString(&requestData.OPSKey, cfg.IndexerKeys.OPSKey)
+	requestData.ratioBrackets = cfg.RatioBrackets
 	setFloat64(&requestData.MinRatio, cfg.Ratio.MinRatio)
+	setBool(&requestData.RespectRequiredRatio, cfg.Ratio.RespectRequiredRatio)
+	setBool(&requestData.SkipRatioOnFreeleech, cfg.Ratio.SkipRatioOnFreeleech)
+	setByteSize(&requestData.MinUploaded, cfg.ParsedSizes.MinUploaded)
 	setByteSize(&requestData.MinSize, cfg.ParsedSizes.MinSize)
 	setByteSize(&requestData.MaxSize, cfg.ParsedSizes.MaxSize)
-	setString(&requestData.Uploaders, cfg.Uploaders.Uploaders)
+	setInt(&requestData.MinLeechers, cfg.Leechers.MinLeechers)
+	setInt(&requestData.MaxLeechers, cfg.Leechers.MaxLeechers)
+	setInt(&requestData.MinSeedersOrFreeleech, cfg.Seeders.MinSeedersOrFreeleech)
+	setInt(&requestData.MinArtists, cfg.Artists.MinArtists)
+	setInt(&requestData.MaxArtists, cfg.Artists.MaxArtists)
+	setInt(&requestData.MinTracks, cfg.Tracks.MinTracks)
+	setInt(&requestData.MaxTracks, cfg.Tracks.MaxTracks)
+	setInt(&requestData.MaxFiles, cfg.Tracks.MaxFiles)
+	setInt(&requestData.MinBitrate, cfg.Bitrate.MinBitrate)
+	setInt(&requestData.MinAvgBitrate, cfg.Bitrate.MinAvgBitrate)
+	setInt(&requestData.MaxAvgBitrate, cfg.Bitrate.MaxAvgBitrate)
+	setBool(&requestData.LosslessOnly, cfg.Bitrate.LosslessOnly)
+	setBool(&requestData.RejectReported, cfg.Filters.RejectReported)
+	setBool(&requestData.RejectVanityHouse, cfg.Filters.RejectVanityHouse)
+	setBool(&requestData.RequireVerifiedLog, cfg.Filters.RequireVerifiedLog)
+	setList(&requestData.RequireRipper, cfg.Filters.RequireRipper)
+	setBool(&requestData.CueLogConsistent, cfg.Filters.CueLogConsistent)
+	setBool(&requestData.RequireArtwork, cfg.Filters.RequireArtwork)
+	setBool(&requestData.RequireFeatured, cfg.Filters.RequireFeatured)
+	setBool(&requestData.SkipAlreadySnatched, cfg.Filters.SkipAlreadySnatched)
+	setBool(&requestData.TokenEligible, cfg.Filters.TokenEligible)
+	setByteSize(&requestData.TokenMinSize, cfg.ParsedSizes.TokenMinSize)
+	setBool(&requestData.CollectAllReasons, cfg.Server.CollectAllReasons)
+	setBool(&requestData.IncludeRelease, cfg.Server.IncludeRelease)
+	setBool(&requestData.NeutralLeechOnly, cfg.Filters.NeutralLeechOnly)
+	setList(&requestData.Uploaders, cfg.Uploaders.Uploaders)
 	setString(&requestData.Mode, cfg.Uploaders.Mode)
-	setString(&requestData.RecordLabel, cfg.RecordLabels.RecordLabels)
+	setString(&requestData.MatchOn, cfg.Uploaders.MatchOn)
+	setBool(&requestData.Glob, cfg.Filters.Glob)
+	setStrings(&requestData.RequireMetadata, cfg.Filters.RequireCompleteMetadata)
+	setList(&requestData.RecordLabel, cfg.RecordLabels.RecordLabels)
+	setList(&requestData.AllowLabels, cfg.RecordLabels.AllowLabels)
+	setList(&requestData.BlockLabels, cfg.RecordLabels.BlockLabels)
+	setList(&requestData.BlockCatalogue, cfg.RecordLabels.BlockCataloguePrefixes)
+	setList(&requestData.AllowMBIDs, cfg.Filters.AllowMBIDs)
+	setList(&requestData.AllowCountries, cfg.Filters.AllowCountries)
+	setList(&requestData.NameSourceAllow, cfg.Filters.NameSourceAllow)
+	setList(&requestData.NameSourceDeny, cfg.Filters.NameSourceDeny)
+	setList(&requestData.Preset, cfg.Filters.Preset)
+	setString(&requestData.TorrentNameMode, cfg.Filters.TorrentNameMode)
+	setList(&requestData.DescriptionContains, cfg.Filters.DescriptionContains)
+	setList(&requestData.DescriptionExcludes, cfg.Filters.DescriptionExcludes)
+	setList(&requestData.LineageContains, cfg.Filters.LineageContains)
+	setList(&requestData.LineageExcludes, cfg.Filters.LineageExcludes)
+	setList(&requestData.OPSRequireFlags, cfg.Filters.OPSRequireFlags)
+}
+
+// applyDefaultIndexer falls back to server.default_indexer when the request
+// did not name an indexer. An explicitly invalid indexer is left untouched so
+// validation still rejects it.
+func applyDefaultIndexer(requestData *RequestData, cfg *config.Config) {
+	if requestData.Indexer != "" || cfg.Server.DefaultIndexer == "" {
+		return
+	}
+
+	log.Debug().Msgf("No indexer provided, using default indexer: %s", cfg.Server.DefaultIndexer)
+	requestData.Indexer = cfg.Server.DefaultIndexer
 }
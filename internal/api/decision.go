@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+const defaultDecisionWebhookTimeout = 5 * time.Second
+
+// Decision is the payload POSTed to decision_webhook.url after every
+// request that made it past validation.
+type Decision struct {
+	RequestID string      `json:"request_id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Indexer   string      `json:"indexer"`
+	TorrentID int         `json:"torrent_id,omitempty"`
+	Approved  bool        `json:"approved"`
+	Status    int         `json:"status"`
+	Reason    string      `json:"reason,omitempty"`
+	Request   RequestData `json:"request"`
+}
+
+// newRequestID returns the caller's X-Request-ID, or a random ID when none
+// was sent, so decisions can be correlated with the autobrr request.
+func newRequestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// notifyDecision hands the decision to the analytics database and POSTs it
+// to the configured decision webhook, both in the background. Either is
+// skipped when not configured.
+func notifyDecision(requestData *RequestData, status int, err error) {
+	cfg := config.GetConfig().DecisionWebhook
+	if cfg.URL == "" && analytics.Load() == nil {
+		return
+	}
+
+	request := *requestData
+	request.REDKey = ""
+	request.OPSKey = ""
+	request.fetchedTorrent = nil
+
+	decision := Decision{
+		RequestID: requestData.requestID,
+		Timestamp: time.Now().UTC(),
+		Indexer:   requestData.Indexer,
+		TorrentID: requestData.TorrentID,
+		Approved:  err == nil,
+		Status:    status,
+		Request:   request,
+	}
+
+	var rejection *rejectionError
+	if errors.As(err, &rejection) {
+		decision.Reason = rejection.Error()
+	} else if err != nil {
+		decision.Reason = err.Error()
+	}
+
+	var torrent *TorrentData
+	if requestData.fetchedTorrent != nil {
+		torrent = requestData.fetchedTorrent.Response.Torrent
+	}
+	recordAnalytics(decision, torrent)
+
+	if cfg.URL == "" {
+		return
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultDecisionWebhookTimeout
+	}
+
+	go postDecision(cfg.URL, timeout, decision)
+}
+
+func postDecision(url string, timeout time.Duration, decision Decision) {
+	body, err := json.Marshal(decision)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode decision")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create decision webhook request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", decision.RequestID)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Str("request_id", decision.RequestID).Msg("Failed to send decision webhook")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		log.Warn().Str("request_id", decision.RequestID).Msgf("Decision webhook responded with status %d", resp.StatusCode)
+		return
+	}
+	log.Trace().Str("request_id", decision.RequestID).Msg("Decision webhook sent")
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxSuggestDistance is the largest edit distance at which a list entry is
+// reported as a likely typo of the uploader.
+const maxSuggestDistance = 2
+
+// uploaderMismatchHint explains why username matched none of entries: the
+// closest entry by edit distance, and any invisible or non-ASCII characters
+// in either that would make two names look equal without being equal. It
+// returns "" when no entry is close enough to be a likely mistake.
+func uploaderMismatchHint(username string, entries []string) string {
+	closest, distance := closestEntry(username, entries)
+	if closest == "" {
+		return ""
+	}
+
+	var hints []string
+	if odd := suspiciousRunes(closest); len(odd) > 0 {
+		hints = append(hints, fmt.Sprintf("list entry '%s' contains %s", closest, strings.Join(odd, ", ")))
+	}
+	if odd := suspiciousRunes(username); len(odd) > 0 {
+		hints = append(hints, fmt.Sprintf("uploader '%s' contains %s", username, strings.Join(odd, ", ")))
+	}
+	if len(hints) == 0 && distance > maxSuggestDistance {
+		return ""
+	}
+
+	hint := fmt.Sprintf("closest list entry is '%s' (%d edits away)", closest, distance)
+	if len(hints) > 0 {
+		hint += "; " + strings.Join(hints, "; ")
+	}
+	return hint
+}
+
+// closestEntry returns the non-empty entry with the smallest edit distance
+// to s, and that distance.
+func closestEntry(s string, entries []string) (string, int) {
+	closest, best := "", -1
+	for _, entry := range entries {
+		if entry == "" {
+			continue
+		}
+		if distance := editDistance(s, entry); best < 0 || distance < best {
+			closest, best = entry, distance
+		}
+	}
+	return closest, best
+}
+
+// editDistance is the Levenshtein distance between a and b, counted in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// suspiciousRunes describes the characters in s that are easy to miss:
+// whitespace, invisible formatting characters and non-ASCII lookalikes.
+func suspiciousRunes(s string) []string {
+	var found []string
+	for i, r := range []rune(s) {
+		switch {
+		case unicode.IsSpace(r) && r != ' ':
+			found = append(found, fmt.Sprintf("whitespace %U at position %d", r, i+1))
+		case unicode.Is(unicode.Cf, r):
+			found = append(found, fmt.Sprintf("invisible %U at position %d", r, i+1))
+		case r > unicode.MaxASCII && unicode.IsLetter(r):
+			found = append(found, fmt.Sprintf("non-ASCII '%c' (%U) at position %d", r, r, i+1))
+		}
+	}
+	return found
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package api
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace returns the number of bytes available to the current user
+// on the volume containing path.
+func freeDiskSpace(path string) (uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, nil, nil); err != nil {
+		return 0, err
+	}
+	return freeBytesAvailable, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"html"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// torrentFile is a single entry of a torrent's file list.
+type torrentFile struct {
+	Name string
+	Size int64
+}
+
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".bmp":  true,
+	".webp": true,
+	".tif":  true,
+	".tiff": true,
+}
+
+var audioExtensions = map[string]bool{
+	".flac": true,
+	".mp3":  true,
+	".m4a":  true,
+	".aac":  true,
+	".ogg":  true,
+	".opus": true,
+	".wav":  true,
+	".aif":  true,
+	".aiff": true,
+	".ape":  true,
+	".wv":   true,
+	".dsf":  true,
+	".dff":  true,
+}
+
+// parseFileList parses the fileList field of the torrent API response, which
+// looks like "01 Track.flac{{{12345}}}|||cover.jpg{{{678}}}". Entries with an
+// unparseable size are kept with a size of 0.
+func parseFileList(fileList string) []torrentFile {
+	if fileList == "" {
+		return nil
+	}
+
+	entries := strings.Split(html.UnescapeString(fileList), "|||")
+	files := make([]torrentFile, 0, len(entries))
+	for _, entry := range entries {
+		name, size, _ := strings.Cut(entry, "{{{")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		bytes, _ := strconv.ParseInt(strings.TrimSuffix(size, "}}}"), 10, 64)
+		files = append(files, torrentFile{Name: name, Size: bytes})
+	}
+	return files
+}
+
+func isImageFile(name string) bool {
+	return imageExtensions[strings.ToLower(path.Ext(name))]
+}
+
+func isAudioFile(name string) bool {
+	return audioExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// fileCount returns the number of files in the torrent: the fileCount the
+// tracker reports, or the length of the file list when it reports none. It
+// returns 0 when neither is in the response.
+func fileCount(torrent *TorrentData) int {
+	if torrent.FileCount > 0 {
+		return torrent.FileCount
+	}
+	return len(parseFileList(torrent.FileList))
+}
+
+// trackCount counts the audio files in a file list. Neither tracker reports
+// a track count, so this is the closest estimate: multi-track images (eg. a
+// single FLAC with a cue sheet) count as one track.
+func trackCount(files []torrentFile) int {
+	tracks := 0
+	for _, file := range files {
+		if isAudioFile(file.Name) {
+			tracks++
+		}
+	}
+	return tracks
+}
@@ -2,17 +2,60 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/s0up4200/redactedhook/internal/config"
 )
 
+// Policy rejections respond with a status code in the http.StatusIMUsed+N
+// range. 5xx codes are reserved for infrastructure problems such as tracker
+// API failures, so operators can tell "rejected by a filter" apart from
+// "something broke".
 const (
 	StatusUploaderNotAllowed = http.StatusIMUsed + 1
 	StatusLabelNotAllowed    = http.StatusIMUsed + 2
 	StatusSizeNotAllowed     = http.StatusIMUsed + 3
+	StatusLeechersNotAllowed = http.StatusIMUsed + 4
+	StatusArtistsNotAllowed  = http.StatusIMUsed + 5
+	StatusBitrateNotAllowed  = http.StatusIMUsed + 6
+	StatusTorrentReported    = http.StatusIMUsed + 7
+	StatusUploadedNotAllowed = http.StatusIMUsed + 8
+	StatusMetadataIncomplete = http.StatusIMUsed + 9
+	StatusVanityHouse        = http.StatusIMUsed + 10
+	StatusPresetNotMatched   = http.StatusIMUsed + 11
+	StatusInsufficientSpace  = http.StatusIMUsed + 12
+	StatusLogNotVerified     = http.StatusIMUsed + 13
+	StatusArtworkMissing     = http.StatusIMUsed + 14
+	StatusDescription        = http.StatusIMUsed + 15
+	StatusRequiredRatio      = http.StatusIMUsed + 16
+	StatusSeedersNotAllowed  = http.StatusIMUsed + 17
+	StatusNotFeatured        = http.StatusIMUsed + 18
+	StatusCueLogInconsistent = http.StatusIMUsed + 19
+	StatusTorrentNameDiffers = http.StatusIMUsed + 20
+	StatusTracksNotAllowed   = http.StatusIMUsed + 21
+	StatusCatalogueBlocked   = http.StatusIMUsed + 22
+	StatusNotLossless        = http.StatusIMUsed + 23
+	StatusQuotaExceeded      = http.StatusIMUsed + 24
+	StatusAlreadyInClient    = http.StatusIMUsed + 25
+	StatusAvgBitrate         = http.StatusIMUsed + 26
+	StatusMBIDNotAllowed     = http.StatusIMUsed + 27
+	StatusOutsideSchedule    = http.StatusIMUsed + 28
+	StatusAlreadySnatched    = http.StatusIMUsed + 29
+	StatusNotNeutralLeech    = http.StatusIMUsed + 30
+	StatusCountryNotAllowed  = http.StatusIMUsed + 31
+	StatusScoreTooLow        = http.StatusIMUsed + 32
+	StatusNameSource         = http.StatusIMUsed + 33
+	StatusNotTokenEligible   = http.StatusIMUsed + 34
+	StatusRipperNotAllowed   = http.StatusIMUsed + 35
+	StatusLineageNotAllowed  = http.StatusIMUsed + 36
+	StatusTooManyFiles       = http.StatusIMUsed + 37
+	StatusIndexerFlag        = http.StatusIMUsed + 38
 	StatusRatioNotAllowed    = http.StatusIMUsed
 )
 
@@ -23,31 +66,187 @@ const (
 	ErrUploaderNotAllowed    = "uploader is not allowed"
 	ErrSizeNotAllowed        = "torrent size is outside the requested size range"
 	ErrRatioBelowMinimum     = "returned ratio is below minimum requirement"
+	ErrLeechersNotAllowed    = "torrent leechers is outside the requested leechers range"
+	ErrArtistsNotAllowed     = "number of artists is outside the requested artists range"
+	ErrBitrateBelowMinimum   = "bitrate is below minimum requirement"
+	ErrTorrentReported       = "torrent is reported"
+	ErrUploadedBelowMinimum  = "returned uploaded amount is below minimum requirement"
+	ErrMetadataIncomplete    = "release metadata is incomplete"
+	ErrVanityHouse           = "release is a vanity house release"
+	ErrPresetNotMatched      = "release does not match the requested preset"
+	ErrInsufficientDiskSpace = "not enough free disk space for torrent"
+	ErrLogNotVerified        = "release log has not been verified"
+	ErrArtworkMissing        = "release has no artwork"
+	ErrDescriptionNotAllowed = "torrent description does not match the requested keywords"
+	ErrRequiredRatio         = "download would drop ratio below the required ratio"
+	ErrSeedersNotFreeleech   = "torrent has too few seeders and is not freeleech"
+	ErrNotFeatured           = "release is not featured"
+	ErrCueLogInconsistent    = "release has a log without a cue or a cue without a log"
+	ErrTorrentNameMismatch   = "torrent name does not match the release on the tracker"
+	ErrTracksNotAllowed      = "number of tracks is outside the requested tracks range"
+	ErrCatalogueBlocked      = "catalogue number has a blocked prefix"
+	ErrNotLossless           = "release is not lossless"
+	ErrQuotaExceeded         = "approved size quota for the window is reached"
+	ErrAlreadyInClient       = "release is already in qBittorrent"
+	ErrAvgBitrate            = "average bitrate is outside the allowed range"
+	ErrMBIDNotAllowed        = "MusicBrainz ID is not in the allowlist"
+	ErrOutsideSchedule       = "outside allowed schedule"
+	ErrAlreadySnatched       = "release is already snatched"
+	ErrNotNeutralLeech       = "torrent is not neutral leech"
+	ErrCountryNotAllowed     = "release country is not in the allowlist"
+	ErrScoreTooLow           = "score is below the threshold"
+	ErrNameSource            = "release name source tags do not match the requested sources"
+	ErrNotTokenEligible      = "torrent is not worth a freeleech token"
+	ErrRipperNotAllowed      = "log was not made with an allowed ripper"
+	ErrLineageNotAllowed     = "release lineage does not match the requested keywords"
+	ErrTooManyFiles          = "torrent has more files than the requested maximum"
+	ErrIndexerFlag           = "torrent does not have the required indexer flags"
 )
 
+// rejectStatusCodes maps every policy rejection reason to its status code.
+var rejectStatusCodes = map[string]int{
+	ErrRecordLabelNotFound:   StatusLabelNotAllowed,
+	ErrRecordLabelNotAllowed: StatusLabelNotAllowed,
+	ErrUploaderNotAllowed:    StatusUploaderNotAllowed,
+	ErrSizeNotAllowed:        StatusSizeNotAllowed,
+	ErrRatioBelowMinimum:     StatusRatioNotAllowed,
+	ErrLeechersNotAllowed:    StatusLeechersNotAllowed,
+	ErrArtistsNotAllowed:     StatusArtistsNotAllowed,
+	ErrBitrateBelowMinimum:   StatusBitrateNotAllowed,
+	ErrTorrentReported:       StatusTorrentReported,
+	ErrUploadedBelowMinimum:  StatusUploadedNotAllowed,
+	ErrMetadataIncomplete:    StatusMetadataIncomplete,
+	ErrVanityHouse:           StatusVanityHouse,
+	ErrPresetNotMatched:      StatusPresetNotMatched,
+	ErrInsufficientDiskSpace: StatusInsufficientSpace,
+	ErrLogNotVerified:        StatusLogNotVerified,
+	ErrArtworkMissing:        StatusArtworkMissing,
+	ErrDescriptionNotAllowed: StatusDescription,
+	ErrRequiredRatio:         StatusRequiredRatio,
+	ErrSeedersNotFreeleech:   StatusSeedersNotAllowed,
+	ErrNotFeatured:           StatusNotFeatured,
+	ErrCueLogInconsistent:    StatusCueLogInconsistent,
+	ErrTorrentNameMismatch:   StatusTorrentNameDiffers,
+	ErrTracksNotAllowed:      StatusTracksNotAllowed,
+	ErrCatalogueBlocked:      StatusCatalogueBlocked,
+	ErrNotLossless:           StatusNotLossless,
+	ErrQuotaExceeded:         StatusQuotaExceeded,
+	ErrAlreadyInClient:       StatusAlreadyInClient,
+	ErrAvgBitrate:            StatusAvgBitrate,
+	ErrMBIDNotAllowed:        StatusMBIDNotAllowed,
+	ErrOutsideSchedule:       StatusOutsideSchedule,
+	ErrAlreadySnatched:       StatusAlreadySnatched,
+	ErrNotNeutralLeech:       StatusNotNeutralLeech,
+	ErrCountryNotAllowed:     StatusCountryNotAllowed,
+	ErrScoreTooLow:           StatusScoreTooLow,
+	ErrNameSource:            StatusNameSource,
+	ErrNotTokenEligible:      StatusNotTokenEligible,
+	ErrRipperNotAllowed:      StatusRipperNotAllowed,
+	ErrLineageNotAllowed:     StatusLineageNotAllowed,
+	ErrTooManyFiles:          StatusTooManyFiles,
+	ErrIndexerFlag:           StatusIndexerFlag,
+}
+
+// rejectionError is returned when a release fails a filter. Any other error
+// coming out of the hooks is treated as an infrastructure problem.
+type rejectionError struct {
+	hook   string
+	reason string
+	detail string
+	// also holds the rejections of later hooks when collect_all_reasons is set.
+	also []*rejectionError
+}
+
+func (e *rejectionError) Error() string {
+	messages := make([]string, 0, 1+len(e.also))
+	messages = append(messages, e.message())
+	for _, other := range e.also {
+		messages = append(messages, other.message())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *rejectionError) message() string {
+	if e.detail != "" {
+		return fmt.Sprintf("%s: %s", e.reason, e.detail)
+	}
+	return e.reason
+}
+
+func reject(reason string) error {
+	return &rejectionError{reason: reason}
+}
+
+// rejectWithDetail is like reject, but adds context such as which value
+// caused the rejection.
+func rejectWithDetail(reason, detail string) error {
+	return &rejectionError{reason: reason, detail: detail}
+}
+
 type validationError struct {
 	err    error
 	status int
 }
 
 func WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	cfg := config.GetConfig()
 	var requestData RequestData
 
+	if !sourceAllowed(w, r, cfg) {
+		return
+	}
+
+	if inMaintenance(cfg) {
+		log.Info().Msgf("Maintenance mode, turning away request from %s", r.RemoteAddr)
+		writeMaintenance(w, cfg)
+		return
+	}
+
 	if err := validateRequest(r, cfg, &requestData); err != nil {
 		writeHTTPError(w, err.err, err.status)
 		return
 	}
 
-	log.Info().Msgf("Received data request from %s", r.RemoteAddr)
+	requestData.requestID = newRequestID(r)
+	w.Header().Set("X-Request-ID", requestData.requestID)
+	log.Info().Str("request_id", requestData.requestID).Msgf("Received data request from %s", r.RemoteAddr)
 
 	if err := processRequest(&requestData); err != nil {
-		handleErrors(w, err)
+		status := handleErrors(w, err)
+		recordLatency(latencyDecision, "", time.Since(start))
+		notifyDecision(&requestData, status, err)
+		logRequestDone(&requestData, status)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	log.Info().Msgf("[%s] Conditions met, responding with status 200", requestData.Indexer)
+	status := successStatus(cfg)
+	setReleaseHeaders(w, &requestData)
+	writeApproval(w, status, &requestData)
+	recordLatency(latencyDecision, "", time.Since(start))
+	notifyDecision(&requestData, status, nil)
+	log.Info().Msgf("[%s] Conditions met, responding with status %d", requestData.Indexer, status)
+	logRequestDone(&requestData, status)
+}
+
+// logRequestDone logs the final status of a request together with the
+// number of tracker API calls it made, so the effect of caching shows up
+// in the log.
+func logRequestDone(requestData *RequestData, status int) {
+	log.Info().
+		Str("request_id", requestData.requestID).
+		Int("status", status).
+		Int("api_calls", requestData.apiCalls).
+		Msgf("[%s] Request for torrent %d done", requestData.Indexer, requestData.TorrentID)
+}
+
+// successStatus returns the status code for approved releases, 200 unless
+// server.success_status is set.
+func successStatus(cfg *config.Config) int {
+	if cfg.Server.SuccessStatus == 0 {
+		return http.StatusOK
+	}
+	return cfg.Server.SuccessStatus
 }
 
 func validateRequest(r *http.Request, cfg *config.Config, requestData *RequestData) *validationError {
@@ -57,6 +256,11 @@ func validateRequest(r *http.Request, cfg *config.Config, requestData *RequestDa
 		return &validationError{err, http.StatusUnauthorized}
 	}
 
+	if err := verifyReplay(r, cfg.Authorization.ReplayWindow, time.Now()); err != nil {
+		log.Debug().Err(err).Msgf("Replay check failed for request from %s", r.RemoteAddr)
+		return &validationError{err, http.StatusUnauthorized}
+	}
+
 	if err := validateRequestMethod(r.Method); err != nil {
 		return &validationError{err, http.StatusBadRequest}
 	}
@@ -66,6 +270,13 @@ func validateRequest(r *http.Request, cfg *config.Config, requestData *RequestDa
 	}
 	defer r.Body.Close()
 
+	applyDefaultIndexer(requestData, cfg)
+	if requestData.MatchAnyID && requestData.TorrentID == 0 && len(requestData.TorrentIDs) > 0 {
+		// Enable the torrent filters, they run for each candidate later.
+		requestData.TorrentID = requestData.TorrentIDs[0]
+	}
+	requestData.Indexer = normalizeIndexer(requestData.Indexer)
+
 	if err := validateIndexer(requestData.Indexer); err != nil {
 		return &validationError{err, http.StatusBadRequest}
 	}
@@ -74,11 +285,15 @@ func validateRequest(r *http.Request, cfg *config.Config, requestData *RequestDa
 		return &validationError{err, http.StatusBadRequest}
 	}
 
+	if err := validateHookCount(requestData, cfg.Server.MaxHooks); err != nil {
+		return &validationError{err, http.StatusBadRequest}
+	}
+
 	return nil
 }
 
 func processRequest(requestData *RequestData) error {
-	apiBase, err := determineAPIBase(requestData.Indexer)
+	apiBase, err := requestAPIBase(requestData)
 	if err != nil {
 		return err
 	}
@@ -88,67 +303,174 @@ func processRequest(requestData *RequestData) error {
 		return err
 	}
 
+	if requestData.MatchAnyID {
+		return runHooksAnyID(requestData, apiBase)
+	}
 	return runHooks(requestData, apiBase)
 }
 
-func runHooks(requestData *RequestData, apiBase string) error {
-	if requestData.TorrentID != 0 && (requestData.MinSize != 0 || requestData.MaxSize != 0) {
-		if err := hookSize(requestData, apiBase); err != nil {
-			return errors.New(ErrSizeNotAllowed)
+// runHooks runs the enabled hooks in order and stops at the first rejection,
+// unless collect_all_reasons is set: then every hook runs and the later
+// rejections are attached to the first. Errors other than rejections always
+// stop at once.
+func runHooks(requestData *RequestData, apiBase string) (err error) {
+	defer func() {
+		if err != nil {
+			// Only approved releases count towards the quota.
+			releaseQuota(requestData)
 		}
-	}
+	}()
 
-	if requestData.TorrentID != 0 && requestData.Uploaders != "" {
-		if err := hookUploader(requestData, apiBase); err != nil {
-			return errors.New(ErrUploaderNotAllowed)
-		}
+	if score := config.GetConfig().Score; score.Enabled {
+		return scoreHooks(requestData, apiBase, score)
 	}
 
-	if requestData.TorrentID != 0 && requestData.RecordLabel != "" {
-		if err := hookRecordLabel(requestData, apiBase); err != nil {
-			return errors.New(ErrRecordLabelNotAllowed)
+	var first *rejectionError
+	for _, hook := range hookDefinitions {
+		if !hook.enabled(requestData) {
+			continue
 		}
-	}
 
-	if requestData.MinRatio != 0 {
-		if err := hookRatio(requestData, apiBase); err != nil {
-			return errors.New(ErrRatioBelowMinimum)
+		if err := hook.run(requestData, apiBase); err != nil {
+			var rejection *rejectionError
+			if !errors.As(err, &rejection) {
+				return fmt.Errorf("%s hook failed: %w", hook.name, err)
+			}
+
+			current := &rejectionError{hook: hook.name, reason: hook.reason, detail: rejection.detail}
+			if !requestData.CollectAllReasons {
+				return current
+			}
+			if first == nil {
+				first = current
+			} else {
+				first.also = append(first.also, current)
+			}
 		}
 	}
 
+	if first != nil {
+		return first
+	}
 	return nil
 }
 
+// setReleaseHeaders exposes details of the approved release as response
+// headers. Only torrent data already fetched by the hooks is used, so this
+// never causes an extra API call.
+func setReleaseHeaders(w http.ResponseWriter, requestData *RequestData) {
+	if requestData.fetchedTorrent == nil || requestData.fetchedTorrent.Response.Torrent == nil {
+		return
+	}
+
+	torrent := requestData.fetchedTorrent.Response.Torrent
+	w.Header().Set("X-Release-Size", strconv.FormatInt(torrent.Size, 10))
+	if torrent.Username != "" {
+		w.Header().Set("X-Release-Uploader", torrent.Username)
+	}
+	if torrent.Format != "" {
+		w.Header().Set("X-Release-Format", torrent.Format)
+	}
+}
+
 func writeHTTPError(w http.ResponseWriter, err error, statusCode int) {
+	var payloadErr *payloadError
+	if errors.As(err, &payloadErr) {
+		writePayloadError(w, payloadErr)
+		return
+	}
 	http.Error(w, err.Error(), statusCode)
 }
 
-func handleErrors(w http.ResponseWriter, err error) {
-	if err == nil {
-		return
+// setRejectHeaders sets X-Reject-Reason to the names of the rejecting hooks,
+// eg. "uploader" or "size,uploader" with collect_all_reasons, and
+// X-Reject-Detail to the response message.
+func setRejectHeaders(w http.ResponseWriter, rejection *rejectionError, message string) {
+	hooks := []string{rejection.hook}
+	for _, other := range rejection.also {
+		hooks = append(hooks, other.hook)
 	}
+	w.Header().Set("X-Reject-Reason", strings.Join(hooks, ","))
+	w.Header().Set("X-Reject-Detail", headerValue(message))
+}
 
-	switch err.Error() {
-	case ErrInvalidJSONResponse:
-		http.Error(w, ErrInvalidJSONResponse, http.StatusInternalServerError)
+// headerValue makes s safe to send as a header value, replacing the line
+// breaks and other control characters a custom message may contain.
+func headerValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
 
-	case ErrRecordLabelNotFound:
-		http.Error(w, ErrRecordLabelNotFound, http.StatusBadRequest)
+// rejectionMessage returns the response body for a rejection, using the
+// operator's message for the hook from the messages config section if set.
+// "{detail}" in a custom message is replaced with the rejection detail.
+// Collected rejections are joined with "; ".
+func rejectionMessage(rejection *rejectionError) string {
+	messages := []string{hookMessage(rejection)}
+	for _, other := range rejection.also {
+		messages = append(messages, hookMessage(other))
+	}
+	return strings.Join(messages, "; ")
+}
 
-	case ErrRecordLabelNotAllowed:
-		http.Error(w, ErrRecordLabelNotAllowed, http.StatusForbidden)
+func hookMessage(rejection *rejectionError) string {
+	message := config.GetConfig().Messages[rejection.hook]
+	if message == "" {
+		return rejection.message()
+	}
+	return strings.ReplaceAll(message, "{detail}", rejection.detail)
+}
 
-	case ErrUploaderNotAllowed:
-		http.Error(w, ErrUploaderNotAllowed, http.StatusForbidden)
+// rejectStatus returns the status code for a rejection, using the operator's
+// code for the hook from the status_codes config section if set.
+func rejectStatus(rejection *rejectionError) int {
+	if status, ok := config.GetConfig().StatusCodes[rejection.hook]; ok {
+		return status
+	}
+	if status, ok := rejectStatusCodes[rejection.reason]; ok {
+		return status
+	}
+	return http.StatusForbidden
+}
 
-	case ErrSizeNotAllowed:
-		http.Error(w, ErrSizeNotAllowed, http.StatusBadRequest)
+// handleErrors writes the response for err and returns its status code.
+func handleErrors(w http.ResponseWriter, err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
 
-	case ErrRatioBelowMinimum:
-		http.Error(w, ErrRatioBelowMinimum, http.StatusForbidden)
+	var rejection *rejectionError
+	if errors.As(err, &rejection) {
+		status := rejectStatus(rejection)
+		message := rejectionMessage(rejection)
+		server := config.GetConfig().Server
+		if server.RejectHeaders {
+			setRejectHeaders(w, rejection, message)
+		}
+		if server.QuietRejections {
+			// The body is left out, so keep the reason in our own log.
+			log.Info().Msgf("Rejected with status %d: %s", status, message)
+			w.WriteHeader(status)
+			return status
+		}
+		http.Error(w, message, status)
+		return status
+	}
 
-	default:
-		log.Error().Err(err).Msg("Unhandled error")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	log.Error().Err(err).Msg("Unhandled error")
+	var upstream *upstreamError
+	if config.GetConfig().API.ExposeUpstreamErrors && errors.As(err, &upstream) {
+		http.Error(w, upstream.clientMessage(), http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+	if strings.Contains(err.Error(), ErrInvalidJSONResponse) {
+		http.Error(w, ErrInvalidJSONResponse, http.StatusInternalServerError)
+		return http.StatusInternalServerError
 	}
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	return http.StatusInternalServerError
 }
@@ -3,70 +3,1035 @@ package api
 import (
 	"fmt"
 	"html"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/inhies/go-bytesize"
 	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
 )
 
-func hookUploader(requestData *RequestData, apiBase string) error {
+// matchedUsername returns the username the uploader filter checks: the
+// original uploader, or the last editor when match_on is "editor". Torrents
+// that were never edited, or whose tracker doesn't report the editor, fall
+// back to the original uploader.
+func matchedUsername(requestData *RequestData, torrent *TorrentData) string {
+	if requestData.MatchOn != config.MatchOnEditor {
+		return torrent.Username
+	}
+	if torrent.LastEditor == "" {
+		log.Trace().Msgf("[%s] No editor reported for torrent %d, matching the uploader", requestData.Indexer, requestData.TorrentID)
+		return torrent.Username
+	}
+	return torrent.LastEditor
+}
+
+func hookSchedule(requestData *RequestData, apiBase string) error {
+	cfg := config.GetConfig()
+	schedule := cfg.Schedule
+	if !cfg.ParsedSchedule.Allows(time.Now()) {
+		log.Debug().Msgf("[%s] Outside the allowed schedule [%s]", requestData.Indexer, strings.Join(schedule.AllowWindows, ", "))
+		return rejectWithDetail(ErrOutsideSchedule, strings.Join(schedule.AllowWindows, ", "))
+	}
+	return nil
+}
+
+func hookUploader(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	rawUsername := matchedUsername(requestData, torrentData.Response.Torrent)
+	username := normalizeName(rawUsername)
+	usernames := parseNameList(requestData.Uploaders)
+
+	log.Trace().Msgf("[%s] Requested uploaders [%s]: %s", requestData.Indexer, requestData.Mode, strings.Join(usernames, ", "))
+
+	if !uploaderAllowed(username, usernames, requestData.Mode, requestData.Glob) {
+		log.Debug().Msgf("[%s] Uploader (%s) is not allowed", requestData.Indexer, username)
+		if requestData.Mode == "whitelist" && !requestData.Glob {
+			// The hint looks at the names as typed and reported, since
+			// normalizeName drops the characters it points out.
+			if hint := uploaderMismatchHint(strings.ToLower(rawUsername), rawNameList(requestData.Uploaders)); hint != "" {
+				log.Info().Msgf("[%s] Uploader (%s) is not in the whitelist, %s", requestData.Indexer, username, hint)
+			}
+		}
+		return reject(ErrUploaderNotAllowed)
+	}
+	return nil
+}
+
+func hookRecordLabel(requestData *RequestData, apiBase string) error {
+	requestedRecordLabels := parseNameList(requestData.RecordLabel)
+	log.Trace().Msgf("[%s] Requested record labels: [%s]", requestData.Indexer, strings.Join(requestedRecordLabels, ", "))
+
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	recordLabel := torrentRecordLabel(torrentData)
+	name := torrentData.Response.Group.Name
+
+	if recordLabel == "" {
+		log.Debug().Msgf("[%s] No record label found for release: %s", requestData.Indexer, name)
+		return reject(ErrRecordLabelNotFound)
+	}
+
+	if !matchInList(recordLabel, requestedRecordLabels, requestData.Glob) {
+		log.Debug().Msgf("[%s] The record label '%s' is not included in the requested record labels: [%s]", requestData.Indexer, recordLabel, strings.Join(requestedRecordLabels, ", "))
+		return reject(ErrRecordLabelNotAllowed)
+	}
+
+	return nil
+}
+
+// hookLabelRules applies allow_labels and block_labels independently of the
+// record_labels list. A blocked label is rejected even if it is also allowed.
+func hookLabelRules(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	recordLabel := torrentRecordLabel(torrentData)
+	name := torrentData.Response.Group.Name
+
+	if len(requestData.BlockLabels) > 0 && recordLabel != "" {
+		blocked := parseNameList(requestData.BlockLabels)
+		if matchInList(recordLabel, blocked, requestData.Glob) {
+			log.Debug().Msgf("[%s] The record label '%s' of %s is blocked: [%s]", requestData.Indexer, recordLabel, name, strings.Join(blocked, ", "))
+			return rejectWithDetail(ErrRecordLabelNotAllowed, fmt.Sprintf("%s is blocked", recordLabel))
+		}
+	}
+
+	if len(requestData.AllowLabels) > 0 {
+		allowed := parseNameList(requestData.AllowLabels)
+		if recordLabel == "" {
+			log.Debug().Msgf("[%s] No record label found for release: %s", requestData.Indexer, name)
+			return rejectWithDetail(ErrRecordLabelNotAllowed, "release has no record label")
+		}
+		if !matchInList(recordLabel, allowed, requestData.Glob) {
+			log.Debug().Msgf("[%s] The record label '%s' of %s is not in the allowed labels: [%s]", requestData.Indexer, recordLabel, name, strings.Join(allowed, ", "))
+			return rejectWithDetail(ErrRecordLabelNotAllowed, fmt.Sprintf("%s is not allowed", recordLabel))
+		}
+	}
+
+	return nil
+}
+
+func hookCatalogue(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	catalogueNumber := releaseMetadata(torrentData)[config.MetadataCatalogueNumber]
+	if catalogueNumber == "" {
+		log.Trace().Msgf("[%s] Torrent %d has no catalogue number", requestData.Indexer, requestData.TorrentID)
+		return nil
+	}
+
+	if prefix := blockedCataloguePrefix(catalogueNumber, parseAndTrimList(requestData.BlockCatalogue)); prefix != "" {
+		log.Debug().Msgf("[%s] Catalogue number '%s' of torrent %d starts with blocked prefix '%s'", requestData.Indexer, catalogueNumber, requestData.TorrentID, prefix)
+		return rejectWithDetail(ErrCatalogueBlocked, fmt.Sprintf("%s starts with %s", catalogueNumber, prefix))
+	}
+
+	return nil
+}
+
+// releaseMBID returns the MusicBrainz ID of the torrent, falling back to the
+// one on the group, or "" if the tracker reports neither.
+func releaseMBID(torrentData *ResponseData) string {
+	if mbid := strings.TrimSpace(torrentData.Response.Torrent.MusicBrainzID); mbid != "" {
+		return strings.ToLower(mbid)
+	}
+	return strings.ToLower(strings.TrimSpace(torrentData.Response.Group.MusicBrainzID))
+}
+
+func hookMBID(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	mbid := releaseMBID(torrentData)
+	if mbid == "" {
+		log.Trace().Msgf("[%s] No MusicBrainz ID reported for torrent %d, skipping MBID check", requestData.Indexer, requestData.TorrentID)
+		return nil
+	}
+
+	if !stringInSlice(mbid, parseAndTrimList(requestData.AllowMBIDs)) {
+		log.Debug().Msgf("[%s] MusicBrainz ID %s of torrent %d is not in allow_mbids", requestData.Indexer, mbid, requestData.TorrentID)
+		return rejectWithDetail(ErrMBIDNotAllowed, mbid)
+	}
+
+	return nil
+}
+
+// releaseCountry returns the country of the torrent's edition, falling back
+// to the one on the group, or "" if the tracker reports neither.
+func releaseCountry(torrentData *ResponseData) string {
+	if country := strings.TrimSpace(torrentData.Response.Torrent.Country); country != "" {
+		return country
+	}
+	return strings.TrimSpace(torrentData.Response.Group.Country)
+}
+
+func hookCountry(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	country := releaseCountry(torrentData)
+	if country == "" {
+		log.Trace().Msgf("[%s] No country reported for torrent %d, skipping country check", requestData.Indexer, requestData.TorrentID)
+		return nil
+	}
+
+	if !stringInSlice(strings.ToLower(country), parseAndTrimList(requestData.AllowCountries)) {
+		log.Debug().Msgf("[%s] Country %s of torrent %d is not in allow_countries", requestData.Indexer, country, requestData.TorrentID)
+		return rejectWithDetail(ErrCountryNotAllowed, country)
+	}
+
+	return nil
+}
+
+// blockedCataloguePrefix returns the first of the lowercased prefixes that
+// catalogueNumber starts with, ignoring case, or "" if there is none.
+func blockedCataloguePrefix(catalogueNumber string, prefixes []string) string {
+	catalogueNumber = strings.ToLower(catalogueNumber)
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(catalogueNumber, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// torrentRecordLabel returns the normalized record label of the torrent's
+// edition, as compared against the label lists.
+func torrentRecordLabel(torrentData *ResponseData) string {
+	return normalizeName(torrentData.Response.Torrent.RecordLabel)
+}
+
+func hookSize(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	torrentSize := bytesize.ByteSize(torrentData.Response.Torrent.Size)
+
+	log.Trace().Msgf("[%s] Torrent size: %s, Requested size range: %s - %s", requestData.Indexer, torrentSize, requestData.MinSize, requestData.MaxSize)
+
+	if (requestData.MinSize != 0 && torrentSize < requestData.MinSize) ||
+		(requestData.MaxSize != 0 && torrentSize > requestData.MaxSize) {
+		log.Debug().Msgf("[%s] Torrent size %s is outside the requested size range: %s to %s", requestData.Indexer, torrentSize, requestData.MinSize, requestData.MaxSize)
+		return reject(ErrSizeNotAllowed)
+	}
+
+	return nil
+}
+
+func hookLeechers(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	leechers := torrentData.Response.Torrent.Leechers
+
+	log.Trace().Msgf("[%s] Torrent leechers: %d, Requested leechers range: %d - %d", requestData.Indexer, leechers, requestData.MinLeechers, requestData.MaxLeechers)
+
+	if (requestData.MinLeechers != 0 && leechers < requestData.MinLeechers) ||
+		(requestData.MaxLeechers != 0 && leechers > requestData.MaxLeechers) {
+		log.Debug().Msgf("[%s] Torrent leechers %d is outside the requested leechers range: %d to %d", requestData.Indexer, leechers, requestData.MinLeechers, requestData.MaxLeechers)
+		return reject(ErrLeechersNotAllowed)
+	}
+
+	return nil
+}
+
+// hookSeedersOrFreeleech passes freeleech torrents without looking at the
+// seeders, and otherwise requires MinSeedersOrFreeleech seeders.
+func hookSeedersOrFreeleech(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	torrent := torrentData.Response.Torrent
+	if torrent.isFreeleech() {
+		log.Trace().Msgf("[%s] Torrent %d is freeleech, skipping the seeders check", requestData.Indexer, requestData.TorrentID)
+		return nil
+	}
+
+	if torrent.Seeders < requestData.MinSeedersOrFreeleech {
+		log.Debug().Msgf("[%s] Torrent %d is not freeleech and has %d seeders, below the minimum of %d", requestData.Indexer, requestData.TorrentID, torrent.Seeders, requestData.MinSeedersOrFreeleech)
+		return rejectWithDetail(ErrSeedersNotFreeleech, fmt.Sprintf("%d seeders", torrent.Seeders))
+	}
+
+	log.Trace().Msgf("[%s] Torrent %d has %d seeders", requestData.Indexer, requestData.TorrentID, torrent.Seeders)
+	return nil
+}
+
+func hookArtists(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	artists := len(torrentData.Response.Group.MusicInfo.Artists)
+
+	log.Trace().Msgf("[%s] Release artists: %d, Requested artists range: %d - %d", requestData.Indexer, artists, requestData.MinArtists, requestData.MaxArtists)
+
+	if (requestData.MinArtists != 0 && artists < requestData.MinArtists) ||
+		(requestData.MaxArtists != 0 && artists > requestData.MaxArtists) {
+		log.Debug().Msgf("[%s] Release artist count %d is outside the requested artists range: %d to %d", requestData.Indexer, artists, requestData.MinArtists, requestData.MaxArtists)
+		return reject(ErrArtistsNotAllowed)
+	}
+
+	return nil
+}
+
+func hookTracks(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	files := parseFileList(torrentData.Response.Torrent.FileList)
+	if len(files) == 0 {
+		log.Debug().Msgf("[%s] No file list in response for torrent %d", requestData.Indexer, requestData.TorrentID)
+		return rejectWithDetail(ErrTracksNotAllowed, "file list not reported")
+	}
+
+	tracks := trackCount(files)
+	log.Trace().Msgf("[%s] Release tracks: %d, Requested tracks range: %d - %d", requestData.Indexer, tracks, requestData.MinTracks, requestData.MaxTracks)
+
+	if (requestData.MinTracks != 0 && tracks < requestData.MinTracks) ||
+		(requestData.MaxTracks != 0 && tracks > requestData.MaxTracks) {
+		log.Debug().Msgf("[%s] Release track count %d is outside the requested tracks range: %d to %d", requestData.Indexer, tracks, requestData.MinTracks, requestData.MaxTracks)
+		return reject(ErrTracksNotAllowed)
+	}
+
+	return nil
+}
+
+func hookFiles(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	// A missing count says nothing about the number of files, so the check is
+	// skipped rather than failing the release as having too many.
+	files := fileCount(torrentData.Response.Torrent)
+	if files == 0 {
+		log.Warn().Msgf("[%s] No file count or file list in response for torrent %d, skipping the maxfiles check", requestData.Indexer, requestData.TorrentID)
+		return nil
+	}
+
+	log.Trace().Msgf("[%s] Release files: %d, Requested max files: %d", requestData.Indexer, files, requestData.MaxFiles)
+
+	if files > requestData.MaxFiles {
+		log.Debug().Msgf("[%s] Release has %d files, more than the requested maximum of %d", requestData.Indexer, files, requestData.MaxFiles)
+		return rejectWithDetail(ErrTooManyFiles, fmt.Sprintf("%d files", files))
+	}
+
+	return nil
+}
+
+func hookBitrate(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	encoding := torrentData.Response.Torrent.Encoding
+	if isLosslessEncoding(encoding) {
+		log.Trace().Msgf("[%s] Encoding %s is lossless, skipping bitrate check", requestData.Indexer, encoding)
+		return nil
+	}
+
+	bitrate, ok := encodingBitrate(encoding)
+	if !ok {
+		log.Debug().Msgf("[%s] Unable to determine bitrate for encoding '%s'", requestData.Indexer, encoding)
+		if encoding == "" {
+			return rejectWithDetail(ErrBitrateBelowMinimum, "encoding not reported")
+		}
+		return rejectWithDetail(ErrBitrateBelowMinimum, fmt.Sprintf("unknown encoding '%s'", encoding))
+	}
+
+	log.Trace().Msgf("[%s] Encoding %s (~%d kbps), Requested minimum bitrate: %d kbps", requestData.Indexer, encoding, bitrate, requestData.MinBitrate)
+
+	if bitrate < requestData.MinBitrate {
+		log.Debug().Msgf("[%s] Bitrate %d kbps (%s) is below minbitrate %d kbps", requestData.Indexer, bitrate, encoding, requestData.MinBitrate)
+		return rejectWithDetail(ErrBitrateBelowMinimum, fmt.Sprintf("%s, ~%d kbps", encoding, bitrate))
+	}
+
+	return nil
+}
+
+// averageBitrate returns the average bitrate in kbps of size bytes played
+// over seconds.
+func averageBitrate(size int64, seconds int) int {
+	return int(size * 8 / int64(seconds) / 1000)
+}
+
+func hookAvgBitrate(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	torrent := torrentData.Response.Torrent
+	if torrent.Duration <= 0 {
+		log.Trace().Msgf("[%s] No duration reported for torrent %d, skipping average bitrate check", requestData.Indexer, requestData.TorrentID)
+		return nil
+	}
+
+	bitrate := averageBitrate(torrent.Size, torrent.Duration)
+	log.Trace().Msgf("[%s] Average bitrate %d kbps (%d bytes over %ds), Requested: %d - %d kbps", requestData.Indexer, bitrate, torrent.Size, torrent.Duration, requestData.MinAvgBitrate, requestData.MaxAvgBitrate)
+
+	if (requestData.MinAvgBitrate != 0 && bitrate < requestData.MinAvgBitrate) ||
+		(requestData.MaxAvgBitrate != 0 && bitrate > requestData.MaxAvgBitrate) {
+		log.Debug().Msgf("[%s] Average bitrate %d kbps of torrent %d is outside %d - %d kbps", requestData.Indexer, bitrate, requestData.TorrentID, requestData.MinAvgBitrate, requestData.MaxAvgBitrate)
+		return rejectWithDetail(ErrAvgBitrate, fmt.Sprintf("%d kbps", bitrate))
+	}
+
+	return nil
+}
+
+func hookLossless(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	encoding := torrentData.Response.Torrent.Encoding
+	if !isLosslessEncoding(encoding) {
+		log.Debug().Msgf("[%s] Encoding '%s' of torrent %d is not lossless", requestData.Indexer, encoding, requestData.TorrentID)
+		if encoding == "" {
+			return rejectWithDetail(ErrNotLossless, "encoding not reported")
+		}
+		return rejectWithDetail(ErrNotLossless, encoding)
+	}
+
+	return nil
+}
+
+func hookReported(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	reported := torrentData.Response.Torrent.Reported
+	if reported == nil {
+		log.Trace().Msgf("[%s] No reported field in response, treating torrent as not reported", requestData.Indexer)
+		return nil
+	}
+
+	if *reported {
+		log.Debug().Msgf("[%s] Torrent %d is reported", requestData.Indexer, requestData.TorrentID)
+		return reject(ErrTorrentReported)
+	}
+
+	return nil
+}
+
+func hookMetadata(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	values := releaseMetadata(torrentData)
+
+	for _, field := range requestData.RequireMetadata {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if values[field] == "" {
+			log.Debug().Msgf("[%s] Release is missing required metadata field: %s", requestData.Indexer, field)
+			return rejectWithDetail(ErrMetadataIncomplete, fmt.Sprintf("%s is missing", field))
+		}
+	}
+
+	log.Trace().Msgf("[%s] Release metadata is complete: %v", requestData.Indexer, values)
+	return nil
+}
+
+// releaseMetadata returns the catalogue number, year and record label of a
+// release, preferring the remaster (edition) values over the original group.
+func releaseMetadata(torrentData *ResponseData) map[string]string {
+	torrent := torrentData.Response.Torrent
+	group := torrentData.Response.Group
+
+	firstNonEmpty := func(values ...string) string {
+		for _, value := range values {
+			if value = strings.TrimSpace(html.UnescapeString(value)); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	year := ""
+	if torrent.RemasterYear != 0 {
+		year = strconv.Itoa(torrent.RemasterYear)
+	} else if group.Year != 0 {
+		year = strconv.Itoa(group.Year)
+	}
+
+	return map[string]string{
+		config.MetadataCatalogueNumber: firstNonEmpty(torrent.CatalogueNumber, group.CatalogueNumber),
+		config.MetadataYear:            year,
+		config.MetadataRecordLabel:     firstNonEmpty(torrent.RecordLabel, group.RecordLabel),
+	}
+}
+
+func hookVanityHouse(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	vanityHouse := torrentData.Response.Group.VanityHouse
+	name := torrentData.Response.Group.Name
+	if vanityHouse == nil {
+		log.Trace().Msgf("[%s] No vanity house field in response for %s, treating as official", requestData.Indexer, name)
+		return nil
+	}
+
+	if *vanityHouse {
+		log.Debug().Msgf("[%s] Release %s is a vanity house release", requestData.Indexer, name)
+		return reject(ErrVanityHouse)
+	}
+
+	log.Trace().Msgf("[%s] Release %s is not a vanity house release", requestData.Indexer, name)
+	return nil
+}
+
+// logVerification reports whether the torrent's log has been checked
+// against the log database. ok is false when the response carries neither
+// hasLogDB nor logChecksum, so the state can't be determined.
+func logVerification(torrent *TorrentData) (verified, ok bool) {
+	if !torrent.HasLog {
+		return false, true
+	}
+	if torrent.HasLogDB == nil && torrent.LogChecksum == nil {
+		return false, false
+	}
+	verified = true
+	if torrent.HasLogDB != nil {
+		verified = verified && *torrent.HasLogDB
+	}
+	if torrent.LogChecksum != nil {
+		verified = verified && *torrent.LogChecksum
+	}
+	return verified, true
+}
+
+func hookVerifiedLog(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	torrent := torrentData.Response.Torrent
+	verified, ok := logVerification(torrent)
+	if !ok {
+		log.Debug().Msgf("[%s] No log verification fields in response for torrent %d", requestData.Indexer, requestData.TorrentID)
+		return rejectWithDetail(ErrLogNotVerified, "log verification state not reported")
+	}
+
+	if !torrent.HasLog {
+		log.Debug().Msgf("[%s] Torrent %d has no log", requestData.Indexer, requestData.TorrentID)
+		return rejectWithDetail(ErrLogNotVerified, "release has no log")
+	}
+
+	if !verified {
+		log.Debug().Msgf("[%s] Log of torrent %d has not been checked against the log database", requestData.Indexer, requestData.TorrentID)
+		return reject(ErrLogNotVerified)
+	}
+
+	log.Trace().Msgf("[%s] Log of torrent %d is verified", requestData.Indexer, requestData.TorrentID)
+	return nil
+}
+
+// logcheckerRippers are the rippers whose logs the RED and OPS logcheckers
+// score. A log with a score was made with one of them, even when the tracker
+// doesn't say which.
+var logcheckerRippers = []string{"eac", "xld"}
+
+// logRipper returns the lowercased ripper named in the torrent's log, or ""
+// when the tracker doesn't report it.
+func logRipper(torrent *TorrentData) string {
+	ripper := strings.ToLower(strings.TrimSpace(torrent.Ripper))
+	switch ripper {
+	case "exact audio copy":
+		return "eac"
+	case "x lossless decoder":
+		return "xld"
+	}
+	return ripper
+}
+
+// ripperAllowed checks the ripper of the torrent's log against rippers. When
+// the tracker doesn't report the ripper, a scored log still proves it was
+// one of the logchecker rippers, so it passes if all of those are allowed.
+// The returned detail says why the log didn't pass.
+func ripperAllowed(torrent *TorrentData, rippers []string) (bool, string) {
+	if !torrent.HasLog {
+		return false, "release has no log"
+	}
+	if ripper := logRipper(torrent); ripper != "" {
+		if slices.Contains(rippers, ripper) {
+			return true, ""
+		}
+		return false, ripper
+	}
+	if torrent.LogScore <= 0 {
+		return false, "ripper not reported and log not scored"
+	}
+	for _, ripper := range logcheckerRippers {
+		if !slices.Contains(rippers, ripper) {
+			return false, "ripper not reported, a scored log may be from " + strings.Join(logcheckerRippers, " or ")
+		}
+	}
+	return true, ""
+}
+
+func hookRipper(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	rippers := parseAndTrimList(requestData.RequireRipper)
+	if allowed, detail := ripperAllowed(torrentData.Response.Torrent, rippers); !allowed {
+		log.Debug().Msgf("[%s] Log of torrent %d does not match the requested rippers [%s]: %s", requestData.Indexer, requestData.TorrentID, strings.Join(rippers, ", "), detail)
+		return rejectWithDetail(ErrRipperNotAllowed, detail)
+	}
+	return nil
+}
+
+// torrentNameKey reduces a release name to lowercase letters and digits
+// separated by single spaces, so formatting differences don't matter.
+func torrentNameKey(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(html.UnescapeString(name)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// torrentNamesMatch reports whether two release names are the same after
+// normalization, or one contains the other.
+func torrentNamesMatch(requested, actual string) bool {
+	requestedKey, actualKey := torrentNameKey(requested), torrentNameKey(actual)
+	if requestedKey == "" || actualKey == "" {
+		return requestedKey == actualKey
+	}
+	return strings.Contains(requestedKey, actualKey) || strings.Contains(actualKey, requestedKey)
+}
+
+func hookTorrentName(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	releaseName := html.UnescapeString(torrentData.Response.Torrent.ReleaseName)
+	if torrentNamesMatch(requestData.TorrentName, releaseName) {
+		log.Trace().Msgf("[%s] Torrent name matches release: %s", requestData.Indexer, releaseName)
+		return nil
+	}
+
+	if requestData.TorrentNameMode != config.TorrentNameReject {
+		log.Warn().Msgf("[%s] Torrent name '%s' does not match release '%s' (TorrentID: %d)", requestData.Indexer, requestData.TorrentName, releaseName, requestData.TorrentID)
+		return nil
+	}
+
+	log.Debug().Msgf("[%s] Torrent name '%s' does not match release '%s'", requestData.Indexer, requestData.TorrentName, releaseName)
+	return rejectWithDetail(ErrTorrentNameMismatch, fmt.Sprintf("tracker has '%s'", releaseName))
+}
+
+// cueLogMismatch describes why a CD rip has only one of log and cue, or
+// returns "" if both or neither are present. Other media are never flagged.
+func cueLogMismatch(torrent *TorrentData) string {
+	if !strings.EqualFold(torrent.Media, "CD") {
+		return ""
+	}
+	switch {
+	case torrent.HasLog && !torrent.HasCue:
+		return "log without cue"
+	case torrent.HasCue && !torrent.HasLog:
+		return "cue without log"
+	default:
+		return ""
+	}
+}
+
+func hookCueLog(requestData *RequestData, apiBase string) error {
 	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
 	if err != nil {
 		return err
 	}
 
-	username := strings.ToLower(torrentData.Response.Torrent.Username)
-	usernames := parseAndTrimList(requestData.Uploaders)
+	if mismatch := cueLogMismatch(torrentData.Response.Torrent); mismatch != "" {
+		log.Debug().Msgf("[%s] Torrent %d has a %s", requestData.Indexer, requestData.TorrentID, mismatch)
+		return rejectWithDetail(ErrCueLogInconsistent, mismatch)
+	}
 
-	log.Trace().Msgf("[%s] Requested uploaders [%s]: %s", requestData.Indexer, requestData.Mode, strings.Join(usernames, ", "))
+	log.Trace().Msgf("[%s] Cue and log of torrent %d are consistent or not applicable (%s)", requestData.Indexer, requestData.TorrentID, torrentData.Response.Torrent.Media)
+	return nil
+}
 
-	isListed := stringInSlice(username, usernames)
-	if (requestData.Mode == "blacklist" && isListed) || (requestData.Mode == "whitelist" && !isListed) {
-		log.Debug().Msgf("[%s] Uploader (%s) is not allowed", requestData.Indexer, username)
-		return fmt.Errorf("uploader is not allowed")
+// artworkSource returns how artwork was detected for the release: the group
+// cover image, an image file in the torrent, or "" if there is none.
+func artworkSource(torrentData *ResponseData) string {
+	if strings.TrimSpace(torrentData.Response.Group.WikiImage) != "" {
+		return "group image"
+	}
+
+	for _, file := range parseFileList(torrentData.Response.Torrent.FileList) {
+		if isImageFile(file.Name) {
+			return "image file " + file.Name
+		}
 	}
+	return ""
+}
+
+func hookArtwork(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	name := torrentData.Response.Group.Name
+	source := artworkSource(torrentData)
+	if source == "" {
+		log.Debug().Msgf("[%s] No group image or image files found for release: %s", requestData.Indexer, name)
+		return reject(ErrArtworkMissing)
+	}
+
+	log.Trace().Msgf("[%s] Artwork found for release %s: %s", requestData.Indexer, name, source)
 	return nil
 }
 
-func hookRecordLabel(requestData *RequestData, apiBase string) error {
-	requestedRecordLabels := parseAndTrimList(requestData.RecordLabel)
-	log.Trace().Msgf("[%s] Requested record labels: [%s]", requestData.Indexer, strings.Join(requestedRecordLabels, ", "))
+func hookDescription(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
 
+	description := strings.ToLower(html.UnescapeString(torrentData.Response.Torrent.Description))
+
+	if len(requestData.DescriptionExcludes) > 0 {
+		if keyword, found := firstKeyword(description, parseAndTrimList(requestData.DescriptionExcludes)); found {
+			log.Debug().Msgf("[%s] Torrent description contains excluded keyword '%s'", requestData.Indexer, keyword)
+			return rejectWithDetail(ErrDescriptionNotAllowed, fmt.Sprintf("contains %q", keyword))
+		}
+	}
+
+	if len(requestData.DescriptionContains) > 0 {
+		keywords := parseAndTrimList(requestData.DescriptionContains)
+		if _, found := firstKeyword(description, keywords); !found {
+			log.Debug().Msgf("[%s] Torrent description contains none of the keywords: [%s]", requestData.Indexer, strings.Join(keywords, ", "))
+			return rejectWithDetail(ErrDescriptionNotAllowed, "none of the required keywords found")
+		}
+	}
+
+	return nil
+}
+
+// releaseLineage returns the lowercased lineage of the torrent, or "" when the
+// tracker doesn't report one.
+func releaseLineage(torrentData *ResponseData) string {
+	return strings.ToLower(strings.TrimSpace(html.UnescapeString(string(torrentData.Response.Torrent.Lineage))))
+}
+
+func hookLineage(requestData *RequestData, apiBase string) error {
 	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
 	if err != nil {
 		return err
 	}
 
-	recordLabel := strings.ToLower(strings.TrimSpace(html.UnescapeString(torrentData.Response.Torrent.RecordLabel)))
-	name := torrentData.Response.Group.Name
+	lineage := releaseLineage(torrentData)
+	if lineage == "" {
+		log.Trace().Msgf("[%s] No lineage reported for torrent %d, skipping lineage check", requestData.Indexer, requestData.TorrentID)
+		return nil
+	}
 
-	if recordLabel == "" {
-		log.Debug().Msgf("[%s] No record label found for release: %s", requestData.Indexer, name)
-		return fmt.Errorf("record label not found")
+	if len(requestData.LineageExcludes) > 0 {
+		if keyword, found := firstKeyword(lineage, parseAndTrimList(requestData.LineageExcludes)); found {
+			log.Debug().Msgf("[%s] Release lineage contains excluded keyword '%s'", requestData.Indexer, keyword)
+			return rejectWithDetail(ErrLineageNotAllowed, fmt.Sprintf("contains %q", keyword))
+		}
 	}
 
-	if !stringInSlice(recordLabel, requestedRecordLabels) {
-		log.Debug().Msgf("[%s] The record label '%s' is not included in the requested record labels: [%s]", requestData.Indexer, recordLabel, strings.Join(requestedRecordLabels, ", "))
-		return fmt.Errorf("record label not allowed")
+	if len(requestData.LineageContains) > 0 {
+		keywords := parseAndTrimList(requestData.LineageContains)
+		if _, found := firstKeyword(lineage, keywords); !found {
+			log.Debug().Msgf("[%s] Release lineage contains none of the keywords: [%s]", requestData.Indexer, strings.Join(keywords, ", "))
+			return rejectWithDetail(ErrLineageNotAllowed, "none of the required keywords found")
+		}
 	}
 
 	return nil
 }
 
-func hookSize(requestData *RequestData, apiBase string) error {
+func hookNameSource(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	name := html.UnescapeString(torrentData.Response.Torrent.ReleaseName)
+	tokens := nameTokens(name)
+
+	if len(requestData.NameSourceDeny) > 0 {
+		if tag, found := firstSourceTag(tokens, parseAndTrimList(requestData.NameSourceDeny)); found {
+			log.Debug().Msgf("[%s] Release name '%s' contains denied source tag '%s'", requestData.Indexer, name, tag)
+			return rejectWithDetail(ErrNameSource, fmt.Sprintf("contains %q", tag))
+		}
+	}
+
+	if len(requestData.NameSourceAllow) > 0 {
+		tags := parseAndTrimList(requestData.NameSourceAllow)
+		if _, found := firstSourceTag(tokens, tags); !found {
+			log.Debug().Msgf("[%s] Release name '%s' contains none of the source tags: [%s]", requestData.Indexer, name, strings.Join(tags, ", "))
+			return rejectWithDetail(ErrNameSource, "none of the allowed source tags found")
+		}
+	}
+
+	return nil
+}
+
+// nameTokens splits a release name into lowercased tokens on everything but
+// letters and digits, so "[FLAC] (Vinyl-24bit)" gives flac, vinyl and 24bit.
+func nameTokens(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// firstSourceTag returns the first tag whose tokens appear in a row in
+// tokens, so a tag like "web-dl" matches "WEB DL" and "WEB.DL" but not "WEBDL".
+func firstSourceTag(tokens, tags []string) (string, bool) {
+	for _, tag := range tags {
+		tagTokens := nameTokens(tag)
+		if len(tagTokens) == 0 {
+			continue
+		}
+		for start := 0; start+len(tagTokens) <= len(tokens); start++ {
+			if slices.Equal(tokens[start:start+len(tagTokens)], tagTokens) {
+				return tag, true
+			}
+		}
+	}
+	return "", false
+}
+
+// firstKeyword returns the first non-empty keyword contained in text.
+func firstKeyword(text string, keywords []string) (string, bool) {
+	for _, keyword := range keywords {
+		if keyword != "" && strings.Contains(text, keyword) {
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+// opsFlagsApply reports whether ops_require_flags is checked for indexer.
+// The flags are fields of the OPS torrent object, so RED requests never read
+// them; the mock indexer stands in for either.
+func opsFlagsApply(indexer string) bool {
+	return indexer == "ops" || isMockIndexer(indexer)
+}
+
+// missingFlag returns the first of flags that isn't set on the torrent, with
+// a detail saying whether it is false or not reported at all, or "" when
+// every flag is set.
+func missingFlag(torrent *TorrentData, flags []string) (string, string) {
+	for _, flag := range flags {
+		if flag == "" {
+			continue
+		}
+		value, ok := torrent.flag(flag)
+		switch {
+		case !ok:
+			return flag, flag + " not reported"
+		case !value:
+			return flag, flag + " not set"
+		}
+	}
+	return "", ""
+}
+
+func hookOPSFlags(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	flags := parseAndTrimList(requestData.OPSRequireFlags)
+	if flag, detail := missingFlag(torrentData.Response.Torrent, flags); flag != "" {
+		log.Debug().Msgf("[%s] Torrent %d is missing required flag %s: %s", requestData.Indexer, requestData.TorrentID, flag, detail)
+		return rejectWithDetail(ErrIndexerFlag, detail)
+	}
+
+	log.Trace().Msgf("[%s] Torrent %d has all required flags: [%s]", requestData.Indexer, requestData.TorrentID, strings.Join(flags, ", "))
+	return nil
+}
+
+// hookFeatured only passes torrents flagged as featured. Neither RED nor OPS
+// currently sends the flag, so on those indexers every release is rejected
+// with a detail saying so rather than silently passing.
+func hookFeatured(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	featured := torrentData.Response.Torrent.Featured
+	if featured == nil {
+		log.Debug().Msgf("[%s] No featured flag in response for torrent %d", requestData.Indexer, requestData.TorrentID)
+		return rejectWithDetail(ErrNotFeatured, fmt.Sprintf("%s does not report featured releases", requestData.Indexer))
+	}
+
+	if !*featured {
+		log.Debug().Msgf("[%s] Torrent %d is not featured", requestData.Indexer, requestData.TorrentID)
+		return reject(ErrNotFeatured)
+	}
+
+	log.Trace().Msgf("[%s] Torrent %d is featured", requestData.Indexer, requestData.TorrentID)
+	return nil
+}
+
+func hookNeutralLeech(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	torrent := torrentData.Response.Torrent
+	neutral := torrent.isNeutralLeech()
+	log.Debug().Msgf("[%s] Torrent %d neutral leech: %t (freeTorrent: %d, isNeutralLeech: %t)", requestData.Indexer, requestData.TorrentID, neutral, torrent.FreeTorrent, bool(torrent.IsNeutralLeech))
+
+	if !neutral {
+		return reject(ErrNotNeutralLeech)
+	}
+	return nil
+}
+
+// tokenEligible reports whether spending a freeleech token on torrent makes
+// sense: it must not be freeleech or neutral leech already, and be at least
+// minSize. It returns why not otherwise.
+func tokenEligible(torrent *TorrentData, minSize bytesize.ByteSize) (bool, string) {
+	switch {
+	case torrent.isFreeleech():
+		return false, "already freeleech"
+	case torrent.isNeutralLeech():
+		return false, "already neutral leech"
+	case bytesize.ByteSize(torrent.Size) < minSize:
+		return false, fmt.Sprintf("%s is below %s", bytesize.ByteSize(torrent.Size), minSize)
+	default:
+		return true, ""
+	}
+}
+
+func hookTokenEligible(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	if eligible, why := tokenEligible(torrentData.Response.Torrent, requestData.TokenMinSize); !eligible {
+		log.Debug().Msgf("[%s] Torrent %d is not worth a freeleech token: %s", requestData.Indexer, requestData.TorrentID, why)
+		return rejectWithDetail(ErrNotTokenEligible, why)
+	}
+	return nil
+}
+
+func hookPreset(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	torrent := torrentData.Response.Torrent
+	presets := parseAndTrimList(requestData.Preset)
+
+	log.Trace().Msgf("[%s] Requested presets: [%s], Release: %s / %s / %s (log: %t %d%%, cue: %t)", requestData.Indexer, strings.Join(presets, ", "), torrent.Format, torrent.Encoding, torrent.Media, torrent.HasLog, torrent.LogScore, torrent.HasCue)
+
+	for _, name := range presets {
+		preset, ok := lookupPreset(name)
+		if ok && matchesPreset(torrent, preset) {
+			log.Trace().Msgf("[%s] Release matches preset %s", requestData.Indexer, name)
+			return nil
+		}
+	}
+
+	log.Debug().Msgf("[%s] Release %s / %s / %s does not match any of the requested presets: [%s]", requestData.Indexer, torrent.Format, torrent.Encoding, torrent.Media, strings.Join(presets, ", "))
+	return reject(ErrPresetNotMatched)
+}
+
+func hookFreeSpace(requestData *RequestData, apiBase string) error {
 	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
 	if err != nil {
 		return err
 	}
 
+	cfg := config.GetConfig()
+	downloadPath := cfg.SizeCheck.DownloadPath
+
+	free, err := freeDiskSpace(downloadPath)
+	if err != nil {
+		return fmt.Errorf("unable to check free space on %s: %w", downloadPath, err)
+	}
+
 	torrentSize := bytesize.ByteSize(torrentData.Response.Torrent.Size)
+	available := bytesize.ByteSize(0)
+	if bytesize.ByteSize(free) > cfg.ParsedSizes.MinFree {
+		available = bytesize.ByteSize(free) - cfg.ParsedSizes.MinFree
+	}
 
-	log.Trace().Msgf("[%s] Torrent size: %s, Requested size range: %s - %s", requestData.Indexer, torrentSize, requestData.MinSize, requestData.MaxSize)
+	log.Trace().Msgf("[%s] Torrent size: %s, Free space on %s: %s (%s reserved)", requestData.Indexer, torrentSize, downloadPath, bytesize.ByteSize(free), cfg.ParsedSizes.MinFree)
 
-	if (requestData.MinSize != 0 && torrentSize < requestData.MinSize) ||
-		(requestData.MaxSize != 0 && torrentSize > requestData.MaxSize) {
-		log.Debug().Msgf("[%s] Torrent size %s is outside the requested size range: %s to %s", requestData.Indexer, torrentSize, requestData.MinSize, requestData.MaxSize)
-		return fmt.Errorf("torrent size is outside the requested size range")
+	if torrentSize > available {
+		log.Debug().Msgf("[%s] Torrent size %s exceeds the usable free space %s on %s", requestData.Indexer, torrentSize, available, downloadPath)
+		return rejectWithDetail(ErrInsufficientDiskSpace, fmt.Sprintf("needs %s, %s available after keeping %s free", torrentSize, available, cfg.ParsedSizes.MinFree))
+	}
+
+	return nil
+}
+
+func hookQuota(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig()
+	maxSize := cfg.ParsedSizes.QuotaMaxSize
+	window := quotaWindow(cfg)
+	torrentSize := bytesize.ByteSize(torrentData.Response.Torrent.Size)
+	used, ok := reserveQuota(requestData, torrentSize, maxSize, window, time.Now())
+
+	log.Trace().Msgf("[%s] Torrent size: %s, Quota used: %s of %s per %s", requestData.Indexer, torrentSize, used, maxSize, window)
+
+	if !ok {
+		log.Debug().Msgf("[%s] Torrent size %s would exceed the quota, %s of %s used in the last %s", requestData.Indexer, torrentSize, used, maxSize, window)
+		return rejectWithDetail(ErrQuotaExceeded, fmt.Sprintf("%s of %s used in the last %s", used, maxSize, window))
 	}
 
 	return nil
@@ -75,14 +1040,35 @@ func hookSize(requestData *RequestData, apiBase string) error {
 func hookRatio(requestData *RequestData, apiBase string) error {
 	userID := getUserID(requestData)
 	minRatio := requestData.MinRatio
+	bracketed := requestData.TorrentID != 0 && len(requestData.ratioBrackets) > 0
 
-	if userID == 0 || minRatio == 0 {
-		if userID != 0 || minRatio != 0 {
+	if userID == 0 || (minRatio == 0 && !bracketed) {
+		if userID != 0 || minRatio != 0 || bracketed {
 			log.Warn().Msgf("[%s] Incomplete ratio check configuration: userID or minRatio is missing.", requestData.Indexer)
 		}
 		return nil
 	}
 
+	// Both the freeleech skip and the size brackets need the torrent. It is
+	// fetched once, before the user, so a skipped check costs no user lookup.
+	if bracketed || (requestData.SkipRatioOnFreeleech && requestData.TorrentID != 0) {
+		torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+		if err != nil {
+			return err
+		}
+		torrent := torrentData.Response.Torrent
+		if requestData.SkipRatioOnFreeleech && torrent.isFreeleech() {
+			log.Info().Msgf("[%s] Skipping ratio check, torrent %d is freeleech", requestData.Indexer, requestData.TorrentID)
+			return nil
+		}
+		if bracketed {
+			minRatio = bracketMinRatio(requestData.ratioBrackets, bytesize.ByteSize(torrent.Size), minRatio)
+			if minRatio == 0 {
+				return nil
+			}
+		}
+	}
+
 	userData, err := fetchResponseData(requestData, userID, "user", apiBase)
 	if err != nil {
 		return err
@@ -93,17 +1079,142 @@ func hookRatio(requestData *RequestData, apiBase string) error {
 
 	log.Trace().Msgf("[%s] MinRatio set to %.2f for %s", requestData.Indexer, minRatio, username)
 
-	if ratio < minRatio {
+	if ratioBelow(ratio, minRatio, config.GetConfig().Ratio.Epsilon) {
 		log.Debug().Msgf("[%s] Returned ratio %.2f is below minratio %.2f for %s", requestData.Indexer, ratio, minRatio, username)
-		return fmt.Errorf("returned ratio is below minimum requirement")
+		return reject(ErrRatioBelowMinimum)
+	}
+
+	return nil
+}
+
+// bracketMinRatio returns the minratio of the largest bracket that size
+// reaches, or fallback when it is smaller than every bracket. brackets must
+// be sorted by size, as config.ParseRatioBrackets returns them.
+func bracketMinRatio(brackets []config.ParsedRatioBracket, size bytesize.ByteSize, fallback float64) float64 {
+	minRatio := fallback
+	for _, bracket := range brackets {
+		if size < bracket.MinSize {
+			break
+		}
+		minRatio = bracket.MinRatio
+	}
+	return minRatio
+}
+
+// ratioBelow reports whether ratio is below minimum by more than epsilon, so
+// float rounding right at the threshold doesn't cause a rejection.
+func ratioBelow(ratio, minimum, epsilon float64) bool {
+	return ratio < minimum-epsilon
+}
+
+// projectedRatio returns the ratio after downloading size more bytes.
+func projectedRatio(uploaded, downloaded, size int64) float64 {
+	if downloaded+size <= 0 {
+		return math.Inf(1)
+	}
+	return float64(uploaded) / float64(downloaded+size)
+}
+
+func hookRequiredRatio(requestData *RequestData, apiBase string) error {
+	userID := getUserID(requestData)
+	if userID == 0 {
+		log.Warn().Msgf("[%s] Incomplete required ratio check configuration: userID is missing.", requestData.Indexer)
+		return nil
+	}
+
+	userData, err := fetchResponseData(requestData, userID, "user", apiBase)
+	if err != nil {
+		return err
+	}
+
+	stats := userData.Response.Stats
+	if stats.RequiredRatio == 0 {
+		log.Trace().Msgf("[%s] No required ratio for %s", requestData.Indexer, userData.Response.Username)
+		return nil
+	}
+
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	size := torrentData.Response.Torrent.Size
+	projected := projectedRatio(stats.Uploaded, stats.Downloaded, size)
+	log.Trace().Msgf("[%s] Ratio after downloading %s would be %.2f, required ratio is %.2f", requestData.Indexer, bytesize.ByteSize(size), projected, stats.RequiredRatio)
+
+	if ratioBelow(projected, stats.RequiredRatio, config.GetConfig().Ratio.Epsilon) {
+		log.Debug().Msgf("[%s] Downloading %s would drop the ratio of %s to %.2f, below the required %.2f", requestData.Indexer, bytesize.ByteSize(size), userData.Response.Username, projected, stats.RequiredRatio)
+		return rejectWithDetail(ErrRequiredRatio, fmt.Sprintf("%.2f < %.2f", projected, stats.RequiredRatio))
+	}
+
+	return nil
+}
+
+const (
+	actionSnatched = "snatched"
+	snatchedLimit  = 500 // Only this many of the most recent snatches are checked
+)
+
+// snatchedTorrent reports whether torrentID is in the user's snatched list.
+func snatchedTorrent(snatched *ResponseData, torrentID int) bool {
+	for _, torrent := range snatched.Response.Snatched {
+		if torrent.TorrentID == torrentID {
+			return true
+		}
+	}
+	return false
+}
+
+func hookSnatched(requestData *RequestData, apiBase string) error {
+	userID := getUserID(requestData)
+	if userID == 0 {
+		log.Warn().Msgf("[%s] Incomplete snatched check configuration: userID is missing.", requestData.Indexer)
+		return nil
+	}
+
+	snatched, err := fetchResponseData(requestData, userID, actionSnatched, apiBase)
+	if err != nil {
+		return err
+	}
+
+	if snatchedTorrent(snatched, requestData.TorrentID) {
+		log.Debug().Msgf("[%s] Torrent %d is already snatched", requestData.Indexer, requestData.TorrentID)
+		return reject(ErrAlreadySnatched)
+	}
+
+	log.Trace().Msgf("[%s] Torrent %d is not among the %d most recent snatches", requestData.Indexer, requestData.TorrentID, len(snatched.Response.Snatched))
+	return nil
+}
+
+func hookUploaded(requestData *RequestData, apiBase string) error {
+	userID := getUserID(requestData)
+	if userID == 0 {
+		log.Warn().Msgf("[%s] Incomplete upload check configuration: userID is missing.", requestData.Indexer)
+		return nil
+	}
+
+	userData, err := fetchResponseData(requestData, userID, "user", apiBase)
+	if err != nil {
+		return err
+	}
+
+	uploaded := bytesize.ByteSize(userData.Response.Stats.Uploaded)
+	downloaded := bytesize.ByteSize(userData.Response.Stats.Downloaded)
+	username := userData.Response.Username
+
+	log.Trace().Msgf("[%s] MinUploaded set to %s for %s (uploaded: %s, downloaded: %s)", requestData.Indexer, requestData.MinUploaded, username, uploaded, downloaded)
+
+	if uploaded < requestData.MinUploaded {
+		log.Debug().Msgf("[%s] Uploaded %s is below minuploaded %s for %s", requestData.Indexer, uploaded, requestData.MinUploaded, username)
+		return reject(ErrUploadedBelowMinimum)
 	}
 
 	return nil
 }
 
-func parseAndTrimList(list string) []string {
-	items := strings.Split(list, ",")
-	for i, item := range items {
+func parseAndTrimList(list listField) []string {
+	items := make([]string, len(list))
+	for i, item := range list {
 		items[i] = strings.ToLower(strings.TrimSpace(item))
 	}
 	return items
@@ -118,6 +1229,59 @@ func stringInSlice(str string, list []string) bool {
 	return false
 }
 
+// uploaderAllowed applies the blacklist/whitelist mode to the uploader.
+func uploaderAllowed(username string, usernames []string, mode string, glob bool) bool {
+	isListed := matchInList(username, usernames, glob)
+	return !((mode == "blacklist" && isListed) || (mode == "whitelist" && !isListed))
+}
+
+// matchInList reports whether str is in list, treating list entries as glob
+// patterns when glob is set.
+func matchInList(str string, list []string, glob bool) bool {
+	if !glob {
+		return stringInSlice(str, list)
+	}
+
+	for _, pattern := range list {
+		if globMatch(pattern, str) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches str against a pattern where '*' matches any run of
+// characters and '?' matches a single character. Unlike path.Match, '/' has no
+// special meaning, as record labels may contain it.
+func globMatch(pattern, str string) bool {
+	p, s := []rune(pattern), []rune(str)
+	pi, si := 0, 0
+	starIdx, matchIdx := -1, 0
+
+	for si < len(s) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == s[si]):
+			pi++
+			si++
+		case pi < len(p) && p[pi] == '*':
+			starIdx = pi
+			matchIdx = si
+			pi++
+		case starIdx != -1:
+			pi = starIdx + 1
+			matchIdx++
+			si = matchIdx
+		default:
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
 func getUserID(requestData *RequestData) int {
 	if requestData.Indexer == "ops" {
 		return requestData.OPSUserID
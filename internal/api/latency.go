@@ -0,0 +1,128 @@
+package api
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWindowSize is how many of the most recent samples the percentiles
+// are computed over.
+const latencyWindowSize = 1024
+
+// latencyWindow keeps the most recent durations of one stage in a ring.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int64 // Samples observed since startup, including those dropped from the ring
+}
+
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+	} else {
+		w.samples[w.next] = d
+		w.next = (w.next + 1) % latencyWindowSize
+	}
+	w.count++
+}
+
+// snapshot returns a sorted copy of the samples and the total count.
+func (w *latencyWindow) snapshot() ([]time.Duration, int64) {
+	w.mu.Lock()
+	samples := slices.Clone(w.samples)
+	count := w.count
+	w.mu.Unlock()
+
+	slices.Sort(samples)
+	return samples, count
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted, or 0 when
+// it is empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// Latency stages. A fetch covers one tracker API call from the moment it is
+// started, so the jitter delay and the wait on the rate limiter count
+// towards it; limiter_wait is that wait alone.
+const (
+	latencyDecision    = "decision"
+	latencyFetch       = "fetch"
+	latencyLimiterWait = "limiter_wait"
+)
+
+// latencyKey identifies the window of a stage, per indexer for the stages
+// that talk to a tracker.
+type latencyKey struct {
+	stage   string
+	indexer string
+}
+
+// latencyWindows is never written after init, so it is safe to read without
+// a lock.
+var latencyWindows = map[latencyKey]*latencyWindow{
+	{latencyDecision, ""}:            {},
+	{latencyFetch, "ops"}:            {},
+	{latencyFetch, "redacted"}:       {},
+	{latencyLimiterWait, "ops"}:      {},
+	{latencyLimiterWait, "redacted"}: {},
+}
+
+// recordLatency adds a sample to the window of stage and indexer. Indexers
+// without a window, such as mock, are ignored.
+func recordLatency(stage, indexer string, d time.Duration) {
+	if window, ok := latencyWindows[latencyKey{stage, indexer}]; ok {
+		window.observe(d)
+	}
+}
+
+// LatencyStatus is the latency of one stage, as reported by the stats
+// endpoint. Percentiles are in milliseconds over the most recent samples.
+type LatencyStatus struct {
+	Stage   string  `json:"stage"`
+	Indexer string  `json:"indexer,omitempty"`
+	Count   int64   `json:"count"` // Samples since startup
+	P50     float64 `json:"p50_ms"`
+	P95     float64 `json:"p95_ms"`
+	P99     float64 `json:"p99_ms"`
+}
+
+// LatencyStatuses returns the latency percentiles of every stage, sorted by
+// stage and indexer.
+func LatencyStatuses() []LatencyStatus {
+	statuses := make([]LatencyStatus, 0, len(latencyWindows))
+	for key, window := range latencyWindows {
+		samples, count := window.snapshot()
+		statuses = append(statuses, LatencyStatus{
+			Stage:   key.stage,
+			Indexer: key.indexer,
+			Count:   count,
+			P50:     milliseconds(percentile(samples, 50)),
+			P95:     milliseconds(percentile(samples, 95)),
+			P99:     milliseconds(percentile(samples, 99)),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Stage != statuses[j].Stage {
+			return statuses[i].Stage < statuses[j].Stage
+		}
+		return statuses[i].Indexer < statuses[j].Indexer
+	})
+	return statuses
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
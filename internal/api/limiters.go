@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -13,6 +15,20 @@ var (
 	orpheusLimiter  *rate.Limiter
 )
 
+// concurrencySlots holds a semaphore per indexer, so a slow tracker only
+// holds up calls to itself.
+var (
+	concurrencyLock  sync.Mutex
+	concurrencySlots = make(map[string]chan struct{})
+)
+
+// keyLimiters holds a limiter for each extra API key, so every key in a
+// red_apikeys chain gets the tracker's rate limit to itself.
+var (
+	keyLimitersLock sync.Mutex
+	keyLimiters     = make(map[string]*rate.Limiter)
+)
+
 func init() {
 	redactedLimiter = rate.NewLimiter(rate.Every(10*time.Second), 10)
 	orpheusLimiter = rate.NewLimiter(rate.Every(10*time.Second), 5)
@@ -30,3 +46,56 @@ func getLimiter(indexer string) (*rate.Limiter, error) {
 		return nil, err
 	}
 }
+
+// getKeyLimiter returns the limiter for calls made with apiKey. The primary
+// key shares the indexer limiter, every other key gets its own limiter with
+// the same rate.
+func getKeyLimiter(indexer, apiKey string, primary bool) (*rate.Limiter, error) {
+	limiter, err := getLimiter(indexer)
+	if err != nil || primary {
+		return limiter, err
+	}
+
+	keyLimitersLock.Lock()
+	defer keyLimitersLock.Unlock()
+
+	id := indexer + "\x00" + apiKey
+	keyLimiter, ok := keyLimiters[id]
+	if !ok {
+		keyLimiter = rate.NewLimiter(limiter.Limit(), limiter.Burst())
+		keyLimiters[id] = keyLimiter
+	}
+	return keyLimiter, nil
+}
+
+// acquireSlot waits for one of the limit concurrent API call slots of indexer
+// until ctx is done, and returns a function to release it. A limit of 0 or
+// less disables the limit.
+func acquireSlot(ctx context.Context, indexer string, limit int) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	slots := indexerSlots(indexer, limit)
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		log.Warn().Str("indexer", indexer).Msgf("All %d concurrent API call slots are busy", limit)
+		return nil, fmt.Errorf("waiting for a free API call slot for %s: %w", indexer, ctx.Err())
+	}
+}
+
+// indexerSlots returns the semaphore of indexer, replacing it when the limit
+// changed. Calls holding a slot of a replaced semaphore release it as usual.
+func indexerSlots(indexer string, limit int) chan struct{} {
+	concurrencyLock.Lock()
+	defer concurrencyLock.Unlock()
+
+	slots, ok := concurrencySlots[indexer]
+	if !ok || cap(slots) != limit {
+		slots = make(chan struct{}, limit)
+		concurrencySlots[indexer] = slots
+	}
+	return slots
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// limiterCounter counts the API calls of one indexer that the local rate
+// limiter held back since startup.
+type limiterCounter struct {
+	throttled atomic.Int64 // Calls that found no token and had to wait
+	rejected  atomic.Int64 // Calls that failed without a token
+}
+
+// limiterCounters is never written after init, so it is safe to read
+// without a lock.
+var limiterCounters = map[string]*limiterCounter{
+	"redacted": {},
+	"ops":      {},
+}
+
+var (
+	limiterLogStop chan struct{}
+	limiterLogDone chan struct{}
+)
+
+// recordThrottle counts a call of indexer that had to wait for a token, and
+// one that failed for lack of one when rejected is set.
+func recordThrottle(indexer string, rejected bool) {
+	counter, ok := limiterCounters[indexer]
+	if !ok {
+		return
+	}
+	counter.throttled.Add(1)
+	if rejected {
+		counter.rejected.Add(1)
+	}
+}
+
+// LimiterStatus is the state of an indexer's rate limiter, as reported by
+// the stats endpoint and the limiter log.
+type LimiterStatus struct {
+	Indexer   string  `json:"indexer"`
+	Tokens    float64 `json:"tokens"`    // Calls that can be made right now
+	Burst     int     `json:"burst"`     // Most tokens the limiter holds
+	Throttled int64   `json:"throttled"` // Calls that had to wait for a token since startup
+	Rejected  int64   `json:"rejected"`  // Calls that failed without a token since startup
+}
+
+// LimiterStatuses returns the rate limiter state of every indexer, sorted by
+// name. Extra API keys have limiters of their own, which are left out.
+func LimiterStatuses() []LimiterStatus {
+	statuses := make([]LimiterStatus, 0, len(limiterCounters))
+	for indexer, counter := range limiterCounters {
+		limiter, err := getLimiter(indexer)
+		if err != nil {
+			continue
+		}
+		statuses = append(statuses, LimiterStatus{
+			Indexer:   indexer,
+			Tokens:    limiter.Tokens(),
+			Burst:     limiter.Burst(),
+			Throttled: counter.throttled.Load(),
+			Rejected:  counter.rejected.Load(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Indexer < statuses[j].Indexer })
+	return statuses
+}
+
+// StartLimiterLog logs the rate limiter state of every indexer at debug
+// level every interval. A zero interval leaves the logging disabled.
+func StartLimiterLog(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	limiterLogStop = make(chan struct{})
+	limiterLogDone = make(chan struct{})
+	go runLimiterLog(interval, limiterLogStop, limiterLogDone)
+}
+
+// StopLimiterLog stops the logging started by StartLimiterLog.
+func StopLimiterLog() {
+	if limiterLogStop == nil {
+		return
+	}
+	close(limiterLogStop)
+	<-limiterLogDone
+	limiterLogStop = nil
+}
+
+func runLimiterLog(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, status := range LimiterStatuses() {
+				log.Debug().
+					Str("indexer", status.Indexer).
+					Float64("tokens", status.Tokens).
+					Int("burst", status.Burst).
+					Int64("throttled", status.Throttled).
+					Int64("rejected", status.Rejected).
+					Msg("Rate limiter state")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
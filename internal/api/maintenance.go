@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// maintenanceReason is the response body and reject reason while in
+// maintenance mode.
+const maintenanceReason = "maintenance"
+
+// maintenanceEnabled is the maintenance mode set through the maintenance
+// endpoint. It adds to server.maintenance in the config.
+var maintenanceEnabled atomic.Bool
+
+// inMaintenance reports whether requests should be turned away, either by
+// the config or by the maintenance endpoint.
+func inMaintenance(cfg *config.Config) bool {
+	return cfg.Server.Maintenance || maintenanceEnabled.Load()
+}
+
+// writeMaintenance answers a request with 503 while in maintenance mode,
+// before any tracker API call is made.
+func writeMaintenance(w http.ResponseWriter, cfg *config.Config) {
+	if cfg.Server.RejectHeaders {
+		w.Header().Set("X-Reject-Reason", maintenanceReason)
+	}
+	http.Error(w, maintenanceReason, http.StatusServiceUnavailable)
+}
+
+// MaintenanceRequest turns maintenance mode on or off. Without Enabled the
+// state is only reported.
+type MaintenanceRequest struct {
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// MaintenanceHandler reports or sets maintenance mode. Setting it here is
+// kept in memory until a restart, and can't turn off server.maintenance
+// from the config.
+func MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := config.GetConfig()
+	if !sourceAllowed(w, r, cfg) {
+		return
+	}
+
+	if err := verifyAPIKey(r.Header.Get("X-API-Token"), cfg.Authorization.APIToken); err != nil {
+		writeHTTPError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	if err := verifyReplay(r, cfg.Authorization.ReplayWindow, time.Now()); err != nil {
+		writeHTTPError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	if err := validateRequestMethod(r.Method); err != nil {
+		writeHTTPError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var request MaintenanceRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		writeHTTPError(w, fmt.Errorf("invalid JSON payload: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	if request.Enabled != nil {
+		maintenanceEnabled.Store(*request.Enabled)
+		log.Info().Msgf("Maintenance mode turned %s by %s", onOff(*request.Enabled), r.RemoteAddr)
+		if !*request.Enabled && cfg.Server.Maintenance {
+			log.Warn().Msg("Maintenance mode stays on, it is enabled in the config")
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"maintenance": inMaintenance(cfg)}); err != nil {
+		log.Error().Err(err).Msg("Failed to write maintenance response")
+	}
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
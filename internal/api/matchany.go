@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxTorrentIDs caps the candidates of a match_any_id request, since each
+// may cost a tracker API call.
+const maxTorrentIDs = 10
+
+// validateTorrentIDs checks torrent_ids, which are only used together with
+// match_any_id.
+func validateTorrentIDs(requestData *RequestData) error {
+	if len(requestData.TorrentIDs) == 0 {
+		if requestData.MatchAnyID {
+			return fmt.Errorf("match_any_id needs torrent_ids")
+		}
+		return nil
+	}
+	if !requestData.MatchAnyID {
+		return fmt.Errorf("torrent_ids needs match_any_id")
+	}
+	if len(requestData.TorrentIDs) > maxTorrentIDs {
+		return fmt.Errorf("torrent_ids has %d entries, the maximum is %d", len(requestData.TorrentIDs), maxTorrentIDs)
+	}
+	for _, id := range requestData.TorrentIDs {
+		if id <= 0 || id > 999_999_999 {
+			return fmt.Errorf("invalid torrent ID in torrent_ids: %d", id)
+		}
+	}
+	return nil
+}
+
+// torrentIDCandidates returns the IDs a match_any_id request tries, in
+// order: torrent_id if set, then torrent_ids, without duplicates.
+func torrentIDCandidates(requestData *RequestData) []int {
+	var candidates []int
+	if requestData.TorrentID != 0 {
+		candidates = append(candidates, requestData.TorrentID)
+	}
+	for _, id := range requestData.TorrentIDs {
+		if !slices.Contains(candidates, id) {
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates
+}
+
+// runHooksAnyID runs the hooks for each candidate torrent ID and stops at the
+// first that passes, leaving requestData.TorrentID set to it. When every
+// candidate is rejected, the rejection of the first is returned with the
+// others attached, each naming its torrent ID. A candidate the tracker
+// doesn't know is skipped; only when no candidate is known is that error
+// returned.
+func runHooksAnyID(requestData *RequestData, apiBase string) error {
+	var first *rejectionError
+	var notFound error
+	for _, id := range torrentIDCandidates(requestData) {
+		requestData.TorrentID = id
+		requestData.fetchedTorrent = nil
+
+		err := runHooks(requestData, apiBase)
+		if err == nil {
+			log.Debug().Msgf("[%s] Torrent %d passed, skipping the remaining candidates", requestData.Indexer, id)
+			return nil
+		}
+
+		if errors.Is(err, ErrNotFound) {
+			log.Debug().Msgf("[%s] Candidate torrent %d not found, skipping it: %v", requestData.Indexer, id, err)
+			notFound = err
+			continue
+		}
+
+		var rejection *rejectionError
+		if !errors.As(err, &rejection) {
+			return err
+		}
+		log.Debug().Msgf("[%s] Candidate torrent %d rejected: %s", requestData.Indexer, id, rejection.Error())
+
+		for _, r := range append([]*rejectionError{rejection}, rejection.also...) {
+			current := &rejectionError{hook: r.hook, reason: r.reason, detail: candidateDetail(id, r.detail)}
+			if first == nil {
+				first = current
+			} else {
+				first.also = append(first.also, current)
+			}
+		}
+	}
+	if first == nil {
+		return notFound
+	}
+	return first
+}
+
+func candidateDetail(id int, detail string) string {
+	if detail == "" {
+		return fmt.Sprintf("torrent %d", id)
+	}
+	return fmt.Sprintf("torrent %d, %s", id, detail)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// mockIndexer serves canned responses from fixture files instead of calling
+// a tracker. It is only accepted when mock.enabled is set in the config.
+const mockIndexer = "mock"
+
+func isMockIndexer(indexer string) bool {
+	return indexer == mockIndexer && config.GetConfig().Mock.Enabled
+}
+
+// loadMockResponse reads <fixtures_dir>/<action>_<id>.json, eg.
+// torrent_123.json or user_1.json. Mock responses are never cached, so edits
+// to a fixture show up on the next request.
+func loadMockResponse(id int, action string) (*ResponseData, error) {
+	fixture := filepath.Join(config.GetConfig().Mock.FixturesDir, fmt.Sprintf("%s_%d.json", action, id))
+
+	file, err := os.Open(fixture)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no mock fixture %s: %w", fixture, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading mock fixture %s: %w", fixture, err)
+	}
+	defer file.Close()
+
+	responseData := &ResponseData{}
+	if err := json.NewDecoder(file).Decode(responseData); err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %w", err)
+	}
+
+	if responseData.Status != "success" {
+		return nil, apiFailure(mockIndexer, responseData.Error)
+	}
+
+	if err := prepareResponseData(responseData, id, action, mockIndexer); err != nil {
+		return nil, err
+	}
+
+	log.Trace().Msgf("[%s] Loaded mock %s data from %s", mockIndexer, action, fixture)
+	return responseData, nil
+}
@@ -1,45 +1,519 @@
 package api
 
-import "github.com/inhies/go-bytesize"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/inhies/go-bytesize"
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
 
 type RequestData struct {
-	REDUserID   int               `json:"red_user_id,omitempty"`
-	OPSUserID   int               `json:"ops_user_id,omitempty"`
-	TorrentID   int               `json:"torrent_id,omitempty"`
-	REDKey      string            `json:"red_apikey,omitempty"`
-	OPSKey      string            `json:"ops_apikey,omitempty"`
-	MinRatio    float64           `json:"minratio,omitempty"`
-	MinSize     bytesize.ByteSize `json:"minsize,omitempty"`
-	MaxSize     bytesize.ByteSize `json:"maxsize,omitempty"`
-	Uploaders   string            `json:"uploaders,omitempty"`
-	RecordLabel string            `json:"record_labels,omitempty"`
-	Mode        string            `json:"mode,omitempty"`
-	Indexer     string            `json:"indexer"`
+	REDUserID             int               `json:"red_user_id,omitempty"`
+	OPSUserID             int               `json:"ops_user_id,omitempty"`
+	TorrentID             int               `json:"torrent_id,omitempty"`
+	TorrentIDs            []int             `json:"torrent_ids,omitempty"`  // Candidates for match_any_id
+	MatchAnyID            bool              `json:"match_any_id,omitempty"` // Approve if any of torrent_ids passes every filter
+	REDKey                string            `json:"red_apikey,omitempty"`
+	OPSKey                string            `json:"ops_apikey,omitempty"`
+	MinRatio              float64           `json:"minratio,omitempty"`
+	MinRatioBuffer        float64           `json:"min_ratio_buffer,omitempty"` // Translated to a minratio of 1.0 plus the buffer
+	MinUploaded           bytesize.ByteSize `json:"minuploaded,omitempty"`
+	MinSize               bytesize.ByteSize `json:"minsize,omitempty"`
+	MaxSize               bytesize.ByteSize `json:"maxsize,omitempty"`
+	MinLeechers           int               `json:"minleechers,omitempty"`
+	MaxLeechers           int               `json:"maxleechers,omitempty"`
+	MinArtists            int               `json:"minartists,omitempty"`
+	MaxArtists            int               `json:"maxartists,omitempty"`
+	MinTracks             int               `json:"mintracks,omitempty"`
+	MaxTracks             int               `json:"maxtracks,omitempty"`
+	MaxFiles              int               `json:"maxfiles,omitempty"`
+	MinBitrate            int               `json:"minbitrate,omitempty"`
+	MinAvgBitrate         int               `json:"min_avg_bitrate,omitempty"`
+	MaxAvgBitrate         int               `json:"max_avg_bitrate,omitempty"`
+	LosslessOnly          bool              `json:"lossless_only,omitempty"`
+	RejectReported        bool              `json:"reject_reported,omitempty"`
+	RejectVanityHouse     bool              `json:"reject_vanity_house,omitempty"`
+	RequireVerifiedLog    bool              `json:"require_verified_log,omitempty"`
+	RequireRipper         listField         `json:"require_ripper,omitempty"`
+	CueLogConsistent      bool              `json:"cue_log_consistent,omitempty"`
+	RequireArtwork        bool              `json:"require_artwork,omitempty"`
+	RequireFeatured       bool              `json:"require_featured,omitempty"`
+	SkipAlreadySnatched   bool              `json:"skip_already_snatched,omitempty"`
+	NeutralLeechOnly      bool              `json:"neutral_leech_only,omitempty"`
+	TokenEligible         bool              `json:"token_eligible,omitempty"`
+	TokenMinSize          bytesize.ByteSize `json:"token_min_size,omitempty"`
+	RespectRequiredRatio  bool              `json:"respect_required_ratio,omitempty"`
+	SkipRatioOnFreeleech  bool              `json:"skip_ratio_on_freeleech,omitempty"`
+	MinSeedersOrFreeleech int               `json:"min_seeders_or_freeleech,omitempty"`
+	Uploaders             listField         `json:"uploaders,omitempty"`
+	RecordLabel           listField         `json:"record_labels,omitempty"`
+	AllowLabels           listField         `json:"allow_labels,omitempty"`
+	BlockLabels           listField         `json:"block_labels,omitempty"`
+	BlockCatalogue        listField         `json:"block_catalogue_prefixes,omitempty"`
+	AllowMBIDs            listField         `json:"allow_mbids,omitempty"`
+	AllowCountries        listField         `json:"allow_countries,omitempty"`
+	NameSourceAllow       listField         `json:"name_source_allow,omitempty"`
+	NameSourceDeny        listField         `json:"name_source_deny,omitempty"`
+	DescriptionContains   listField         `json:"description_contains,omitempty"`
+	DescriptionExcludes   listField         `json:"description_excludes,omitempty"`
+	LineageContains       listField         `json:"lineage_contains,omitempty"`
+	LineageExcludes       listField         `json:"lineage_excludes,omitempty"`
+	OPSRequireFlags       listField         `json:"ops_require_flags,omitempty"`
+	TorrentName           string            `json:"torrentname,omitempty"`
+	TorrentNameMode       string            `json:"torrent_name_mode,omitempty"`
+	Mode                  string            `json:"mode,omitempty"`
+	MatchOn               string            `json:"match_on,omitempty"`
+	Glob                  bool              `json:"glob,omitempty"`
+	RequireMetadata       []string          `json:"require_complete_metadata,omitempty"`
+	TimeoutSeconds        int               `json:"timeout_seconds,omitempty"`
+	APIBase               string            `json:"api_base,omitempty"` // Replaces the indexer's API endpoint, needs api.allow_api_base_override
+	Preset                listField         `json:"preset,omitempty"`
+	CollectAllReasons     bool              `json:"collect_all_reasons,omitempty"`
+	IncludeRelease        bool              `json:"include_release,omitempty"` // Return the fetched release metadata as JSON on approval
+	Indexer               string            `json:"indexer"`
+
+	// fetchedTorrent holds the torrent data fetched while evaluating this
+	// request, if any hook needed it.
+	fetchedTorrent *ResponseData
+	// requestID identifies this request in logs and the decision webhook.
+	requestID string
+	// apiCalls counts the tracker API calls this request made, leaving out
+	// responses served from the cache, the ratio poller or mock fixtures.
+	apiCalls int
+	// quotaGrab is the size this request reserved in the quota, released
+	// again unless the request is approved.
+	quotaGrab *quotaGrab
+	// ratioBrackets pick the minratio by torrent size. They come from the
+	// config and are dropped when the request sends its own minratio.
+	ratioBrackets []config.ParsedRatioBracket
+}
+
+// requestFieldAliases maps common variants of request field names to the
+// canonical JSON key. Keys are matched case-insensitively.
+var requestFieldAliases = map[string]string{
+	"torrentid":       "torrent_id",
+	"reduserid":       "red_user_id",
+	"red_userid":      "red_user_id",
+	"opsuserid":       "ops_user_id",
+	"ops_userid":      "ops_user_id",
+	"redapikey":       "red_apikey",
+	"red_api_key":     "red_apikey",
+	"opsapikey":       "ops_apikey",
+	"ops_api_key":     "ops_apikey",
+	"min_ratio":       "minratio",
+	"min_uploaded":    "minuploaded",
+	"min_size":        "minsize",
+	"max_size":        "maxsize",
+	"min_leechers":    "minleechers",
+	"max_leechers":    "maxleechers",
+	"min_artists":     "minartists",
+	"max_artists":     "maxartists",
+	"min_tracks":      "mintracks",
+	"max_tracks":      "maxtracks",
+	"max_files":       "maxfiles",
+	"min_bitrate":     "minbitrate",
+	"timeout":         "timeout_seconds",
+	"presets":         "preset",
+	"verified_log":    "require_verified_log",
+	"torrent_name":    "torrentname",
+	"minratio_buffer": "min_ratio_buffer",
+	"musicbrainz_ids": "allow_mbids",
+	"countries":       "allow_countries",
+	"uploader":        "uploaders",
+	"recordlabels":    "record_labels",
+	"record_label":    "record_labels",
+	"recordlabel":     "record_labels",
+	"labels":          "record_labels",
+}
+
+// UnmarshalJSON decodes the request while accepting the aliases listed in
+// requestFieldAliases and the request_aliases config section. A canonical key
+// always wins over an alias for the same field.
+func (r *RequestData) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig()
+	configAliases := cfg.RequestAliases
+	normalized := make(map[string]json.RawMessage, len(raw))
+	for key, value := range raw {
+		canonical, ok := resolveRequestFieldAlias(strings.ToLower(key), configAliases)
+		if !ok {
+			normalized[key] = value
+			continue
+		}
+		if _, exists := raw[canonical]; exists {
+			log.Debug().Msgf("Ignoring request field alias '%s', '%s' is also set", key, canonical)
+			continue
+		}
+		log.Debug().Msgf("Request field alias '%s' used for '%s'", key, canonical)
+		normalized[canonical] = value
+	}
+
+	if cfg.Server.StrictRequest {
+		if err := checkUnknownFields(normalized); err != nil {
+			return err
+		}
+	}
+
+	for key := range listRequestFields {
+		value, ok := normalized[key]
+		if !ok {
+			continue
+		}
+		var list listField
+		if err := json.Unmarshal(value, &list); err != nil {
+			return &payloadError{Message: fmt.Sprintf("%s must be a string or an array of strings: %v", key, err), Field: key}
+		}
+	}
+
+	normalizedData, err := json.Marshal(normalized)
+	if err != nil {
+		return err
+	}
+
+	type requestDataAlias RequestData
+	if err := json.Unmarshal(normalizedData, (*requestDataAlias)(r)); err != nil {
+		return fieldError(normalized, err)
+	}
+
+	// min_ratio_buffer overrides a minratio from the config, but not one sent
+	// in the same request.
+	if _, ok := normalized["min_ratio_buffer"]; ok {
+		if _, ok := normalized["minratio"]; ok {
+			log.Debug().Msg("Both minratio and min_ratio_buffer are set, using minratio")
+		} else {
+			r.MinRatio = 1 + r.MinRatioBuffer
+		}
+	}
+	_, hasMinRatio := normalized["minratio"]
+	_, hasBuffer := normalized["min_ratio_buffer"]
+	if hasMinRatio || hasBuffer {
+		r.ratioBrackets = nil
+	}
+	return nil
+}
+
+// listRequestFields are the comma-separated request fields that may also be
+// sent as a JSON array of strings.
+var listRequestFields = map[string]bool{
+	"uploaders":                true,
+	"record_labels":            true,
+	"allow_labels":             true,
+	"block_labels":             true,
+	"block_catalogue_prefixes": true,
+	"allow_mbids":              true,
+	"allow_countries":          true,
+	"name_source_allow":        true,
+	"name_source_deny":         true,
+	"require_ripper":           true,
+	"description_contains":     true,
+	"description_excludes":     true,
+	"lineage_contains":         true,
+	"lineage_excludes":         true,
+	"ops_require_flags":        true,
+	"preset":                   true,
+}
+
+// listField is a list request field, sent either as a comma-separated string
+// or as a JSON array of strings. Array entries are kept whole, so they may
+// contain commas themselves.
+type listField []string
+
+func (l *listField) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []string
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		*l = items
+		return nil
+	}
+
+	var list string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = splitList(list)
+	return nil
+}
+
+// String returns the entries joined with commas, for logs and previews.
+func (l listField) String() string {
+	return strings.Join(l, ",")
+}
+
+// splitList splits a comma-separated list from a request or the config. An
+// empty string is an empty list.
+func splitList(list string) listField {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func resolveRequestFieldAlias(key string, configAliases map[string]string) (string, bool) {
+	if canonical, ok := configAliases[key]; ok {
+		return canonical, true
+	}
+	canonical, ok := requestFieldAliases[key]
+	return canonical, ok
 }
 
 type ResponseData struct {
-	Status   string `json:"status"`
-	Error    string `json:"error"`
-	Response struct {
-		Username string `json:"username"`
-		Stats    struct {
-			Ratio float64 `json:"ratio"`
-		} `json:"stats"`
-		Group struct {
-			Name      string `json:"name"`
-			MusicInfo struct {
-				Artists []struct {
-					ID   int    `json:"id"`
-					Name string `json:"name"`
-				} `json:"artists"`
-			} `json:"musicInfo"`
-		} `json:"group"`
-		Torrent *struct {
-			Username        string `json:"username"`
-			Size            int64  `json:"size"`
-			RecordLabel     string `json:"remasterRecordLabel"`
-			ReleaseName     string `json:"filePath"`
-			CatalogueNumber string `json:"remasterCatalogueNumber"`
-		} `json:"torrent"`
-	} `json:"response"`
+	Status   string       `json:"status"`
+	Error    string       `json:"error"`
+	Response ResponseBody `json:"response"`
+}
+
+type ResponseBody struct {
+	Username string `json:"username"`
+	Stats    struct {
+		Ratio         float64 `json:"ratio"`
+		Uploaded      int64   `json:"uploaded"`
+		Downloaded    int64   `json:"downloaded"`
+		RequiredRatio float64 `json:"requiredRatio"`
+	} `json:"stats"`
+	Group struct {
+		Name            string `json:"name"`
+		Year            int    `json:"year"`
+		RecordLabel     string `json:"recordLabel"`
+		CatalogueNumber string `json:"catalogueNumber"`
+		VanityHouse     *bool  `json:"vanityHouse"`
+		WikiImage       string `json:"wikiImage"`
+		MusicBrainzID   string `json:"musicBrainzId"`
+		Country         string `json:"country"`
+		MusicInfo       struct {
+			Artists []struct {
+				ID   int    `json:"id"`
+				Name string `json:"name"`
+			} `json:"artists"`
+		} `json:"musicInfo"`
+	} `json:"group"`
+	Torrent  *TorrentData  `json:"torrent"`
+	Torrents []TorrentData `json:"torrents"`
+	Snatched []struct {
+		GroupID   int `json:"groupId"`
+		TorrentID int `json:"torrentId"`
+	} `json:"snatched"`
+}
+
+type TorrentData struct {
+	ID              int    `json:"id"`
+	Username        string `json:"username"`   // The original uploader, kept when the torrent is edited
+	LastEditor      string `json:"lastEditor"` // Who last edited the torrent, if the tracker reports it
+	Size            int64  `json:"size"`
+	Leechers        int    `json:"leechers"`
+	Seeders         int    `json:"seeders"`
+	Format          string `json:"format"`
+	Encoding        string `json:"encoding"`
+	Media           string `json:"media"`
+	HasLog          bool   `json:"hasLog"`
+	LogScore        int    `json:"logScore"`
+	HasLogDB        *bool  `json:"hasLogDB"`
+	LogChecksum     *bool  `json:"logChecksum"`
+	Ripper          string `json:"ripper"` // Ripping software named in the log, if the tracker reports it
+	HasCue          bool   `json:"hasCue"`
+	Reported        *bool  `json:"reported"`
+	RecordLabel     string `json:"remasterRecordLabel"`
+	RemasterYear    int    `json:"remasterYear"`
+	ReleaseName     string `json:"filePath"`
+	InfoHash        string `json:"infoHash"`
+	Duration        int    `json:"duration"`        // Total playing time in seconds, 0 when the tracker doesn't report it
+	MusicBrainzID   string `json:"musicBrainzId"`   // MusicBrainz release ID, if the tracker reports one
+	Country         string `json:"remasterCountry"` // Country of this edition, if the tracker reports one
+	CatalogueNumber string `json:"remasterCatalogueNumber"`
+	FileList        string `json:"fileList"`
+	FileCount       int    `json:"fileCount"`
+	Description     string `json:"description"`
+
+	FreeTorrent         freeleechType `json:"freeTorrent"`
+	IsFreeleech         flexBool      `json:"isFreeleech"`
+	IsPersonalFreeleech flexBool      `json:"isPersonalFreeleech"`
+	IsNeutralLeech      flexBool      `json:"isNeutralLeech"`
+	Featured            *flexBool     `json:"featured"`
+	Lineage             lineageText   `json:"lineage"` // Recording source notes, if the tracker reports them
+
+	// fields holds every field of the torrent object as sent, for filters
+	// on indexer-specific fields this struct doesn't know.
+	fields map[string]json.RawMessage
+}
+
+func (t *TorrentData) UnmarshalJSON(data []byte) error {
+	type torrentDataAlias TorrentData
+	if err := json.Unmarshal(data, (*torrentDataAlias)(t)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &t.fields)
+}
+
+// flag reports the boolean field name of the torrent object, matched
+// ignoring case, and whether the tracker sent it at all. Values decode like
+// flexBool; a value that isn't a boolean counts as not sent.
+func (t *TorrentData) flag(name string) (value, ok bool) {
+	var raw json.RawMessage
+	found := false
+	for field, fieldValue := range t.fields {
+		if strings.EqualFold(field, name) {
+			raw, found = fieldValue, true
+			break
+		}
+	}
+	if !found {
+		return false, false
+	}
+
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return false, false
+	}
+	return parseFlexBool(raw)
+}
+
+// isFreeleech reports whether downloading the torrent doesn't count towards
+// the user's download amount.
+func (t *TorrentData) isFreeleech() bool {
+	return t.FreeTorrent == freeleechFree || bool(t.IsFreeleech) || bool(t.IsPersonalFreeleech)
+}
+
+// isNeutralLeech reports whether neither downloading nor uploading the
+// torrent counts towards the user's stats. Torrents without the flag are
+// not neutral leech.
+func (t *TorrentData) isNeutralLeech() bool {
+	return t.FreeTorrent == freeleechNeutral || bool(t.IsNeutralLeech)
+}
+
+// freeleechType is the freeTorrent value of a torrent. Depending on the
+// tracker it is sent as a boolean, a number or a numeric string. Any other
+// value is logged and decodes as freeleechNone rather than failing the whole
+// torrent response.
+type freeleechType int
+
+const (
+	freeleechNone freeleechType = iota
+	freeleechFree
+	freeleechNeutral
+)
+
+func (f *freeleechType) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(bytes.TrimSpace(data)), `"`)
+	switch value {
+	case "", "null", "false":
+		*f = freeleechNone
+	case "true":
+		*f = freeleechFree
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			log.Warn().Msgf("Unknown freeTorrent value %s, treating the torrent as not freeleech", data)
+			*f = freeleechNone
+			return nil
+		}
+		*f = freeleechType(n)
+	}
+	return nil
+}
+
+// lineageText is the lineage of a release. Trackers that capture it send a
+// string or a list of strings; anything else decodes as empty rather than
+// failing the whole torrent response.
+type lineageText string
+
+func (l *lineageText) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*l = lineageText(text)
+		return nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*l = lineageText(strings.Join(lines, "\n"))
+		return nil
+	}
+
+	*l = ""
+	return nil
+}
+
+// flexBool decodes a flag sent either as a JSON boolean or as "0"/"1". Any
+// other value is logged and decodes as false rather than failing the whole
+// torrent response.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	value, ok := parseFlexBool(data)
+	if !ok {
+		log.Warn().Msgf("Unknown boolean value %s, treating it as false", data)
+	}
+	*b = flexBool(value)
+	return nil
+}
+
+// parseFlexBool decodes data the way flexBool does, and reports whether it
+// was a value flexBool knows.
+func parseFlexBool(data []byte) (value, ok bool) {
+	switch strings.Trim(string(bytes.TrimSpace(data)), `"`) {
+	case "", "null", "false", "0":
+		return false, true
+	case "true", "1":
+		return true, true
+	}
+	return false, false
+}
+
+// UnmarshalJSON accepts the torrent payload both as a single object (torrent
+// action) and as an array (group actions), collecting arrays into Torrents.
+func (r *ResponseBody) UnmarshalJSON(data []byte) error {
+	type responseBodyAlias ResponseBody
+	aux := struct {
+		*responseBodyAlias
+		Torrent json.RawMessage `json:"torrent"`
+	}{responseBodyAlias: (*responseBodyAlias)(r)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	raw := bytes.TrimSpace(aux.Torrent)
+	switch {
+	case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+		r.Torrent = nil
+	case raw[0] == '[':
+		var torrents []TorrentData
+		if err := json.Unmarshal(raw, &torrents); err != nil {
+			return err
+		}
+		r.Torrents = append(r.Torrents, torrents...)
+	default:
+		var torrent TorrentData
+		if err := json.Unmarshal(raw, &torrent); err != nil {
+			return err
+		}
+		r.Torrent = &torrent
+	}
+
+	return nil
+}
+
+// selectTorrent points Torrent at the entry matching id when the response
+// only carried an array of torrents. Torrent stays nil when none matches.
+func (r *ResponseBody) selectTorrent(id int) {
+	if r.Torrent != nil || len(r.Torrents) == 0 {
+		return
+	}
+
+	for i := range r.Torrents {
+		if r.Torrents[i].ID == id {
+			r.Torrent = &r.Torrents[i]
+			return
+		}
+	}
 }
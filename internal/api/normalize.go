@@ -0,0 +1,66 @@
+package api
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// lookalikeReplacer maps characters that trackers and config files use
+// interchangeably to a single form, so "Ninja Tune" with a non-breaking
+// space or "Rock’n’Roll" with curly quotes still match a typed list entry.
+var lookalikeReplacer = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'", "´", "'", "`", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`,
+	"‐", "-", "‑", "-", "‒", "-", "–", "-", "—", "-", "−", "-",
+)
+
+// normalizeName prepares a label or username for comparison: HTML entities
+// are decoded, the text is NFC normalized so precomposed and combining
+// accents compare equal, lookalike quotes and dashes are mapped to ASCII,
+// invisible formatting characters are dropped, runs of whitespace (including
+// non-breaking spaces) become a single space, and the result is lowercased.
+func normalizeName(s string) string {
+	s = lookalikeReplacer.Replace(norm.NFC.String(html.UnescapeString(s)))
+
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Cf, r):
+			continue
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// rawNameList splits list like parseNameList but only lowercases the entries
+// and trims plain spaces, keeping the invisible and lookalike characters that
+// normalizeName drops so uploaderMismatchHint can point them out.
+func rawNameList(list listField) []string {
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = strings.ToLower(strings.Trim(item, " "))
+	}
+	return items
+}
+
+// parseNameList is parseAndTrimList for lists of labels and usernames, with
+// every entry passed through normalizeName.
+func parseNameList(list listField) []string {
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = normalizeName(item)
+	}
+	return items
+}
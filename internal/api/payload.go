@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// payloadError is a request body that could not be decoded. It is sent to
+// the client as JSON, naming the field or byte offset at fault when known.
+type payloadError struct {
+	Message string `json:"error"`
+	Field   string `json:"field,omitempty"`
+	Offset  int64  `json:"offset,omitempty"`
+}
+
+func (e *payloadError) Error() string {
+	return "invalid JSON payload: " + e.Message
+}
+
+// describePayloadError turns an error from decoding a request body into a
+// payloadError that says what is wrong in terms of the payload.
+func describePayloadError(err error) *payloadError {
+	var payloadErr *payloadError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &payloadErr):
+		return payloadErr
+	case errors.As(err, &syntaxErr):
+		return &payloadError{Message: fmt.Sprintf("%s at byte %d", syntaxErr, syntaxErr.Offset), Offset: syntaxErr.Offset}
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return &payloadError{Message: fmt.Sprintf("the payload must be a JSON object, got %s", typeErr.Value)}
+	case errors.Is(err, io.EOF):
+		return &payloadError{Message: "the request body is empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &payloadError{Message: "the request body ends before the JSON is complete"}
+	default:
+		return &payloadError{Message: err.Error()}
+	}
+}
+
+// fieldError names the request field err came from. encoding/json only does
+// that for type errors, so for other errors, such as an invalid size, each
+// field is decoded on its own until one fails.
+func fieldError(fields map[string]json.RawMessage, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &payloadError{
+			Message: fmt.Sprintf("%s must be %s, got %s", typeErr.Field, jsonKind(typeErr.Type), typeErr.Value),
+			Field:   typeErr.Field,
+		}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	type requestDataAlias RequestData
+	for _, key := range keys {
+		single, marshalErr := json.Marshal(map[string]json.RawMessage{key: fields[key]})
+		if marshalErr != nil {
+			continue
+		}
+		var scratch requestDataAlias
+		if fieldErr := json.Unmarshal(single, &scratch); fieldErr != nil {
+			return &payloadError{Message: fmt.Sprintf("%s: %v", key, fieldErr), Field: key}
+		}
+	}
+	return err
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// jsonKind describes the JSON value expected for a Go type.
+func jsonKind(t reflect.Type) string {
+	if t == nil {
+		return "a different type"
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return "a string"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "a " + t.String()
+	}
+}
+
+// writePayloadError writes a payloadError as a JSON 400.
+func writePayloadError(w http.ResponseWriter, payloadErr *payloadError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(payloadErr); err != nil {
+		log.Error().Err(err).Msg("Failed to write payload error response")
+	}
+}
+
+// requestFields lists the JSON keys of RequestData, lowercased, as
+// encoding/json matches keys case-insensitively.
+var requestFields = func() map[string]string {
+	fields := make(map[string]string)
+	t := reflect.TypeOf(RequestData{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[strings.ToLower(name)] = name
+		}
+	}
+	return fields
+}()
+
+// checkUnknownFields rejects the first key, in sorted order, that is not a
+// request field, naming the closest field when it looks like a typo.
+func checkUnknownFields(fields map[string]json.RawMessage) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, ok := requestFields[strings.ToLower(key)]; ok {
+			continue
+		}
+
+		message := fmt.Sprintf("unknown field %s", key)
+		known := make([]string, 0, len(requestFields))
+		for _, name := range requestFields {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		if closest, distance := closestEntry(strings.ToLower(key), known); distance >= 0 && distance <= maxSuggestDistance {
+			message += fmt.Sprintf(", did you mean %s?", closest)
+		}
+		return &payloadError{Message: message, Field: key}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// defaultPresets are always available. Presets in the config with the same
+// name replace them.
+var defaultPresets = map[string]config.Preset{
+	"perfect_flac_cd": {
+		Formats:     []string{"FLAC"},
+		Encodings:   []string{"Lossless", "24bit Lossless"},
+		Media:       []string{"CD"},
+		MinLogScore: 100,
+		RequireCue:  true,
+	},
+	"web_flac": {
+		Formats:   []string{"FLAC"},
+		Encodings: []string{"Lossless", "24bit Lossless"},
+		Media:     []string{"WEB"},
+	},
+	"v0_web": {
+		Formats:   []string{"MP3"},
+		Encodings: []string{"V0 (VBR)"},
+		Media:     []string{"WEB"},
+	},
+}
+
+// normalizePresetName lowercases a preset name and turns spaces and dashes
+// into underscores, so "Perfect FLAC CD" and "perfect-flac-cd" are the same.
+func normalizePresetName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+func lookupPreset(name string) (config.Preset, bool) {
+	name = normalizePresetName(name)
+	for configName, preset := range config.GetConfig().Presets {
+		if normalizePresetName(configName) == name {
+			return preset, true
+		}
+	}
+	preset, ok := defaultPresets[name]
+	return preset, ok
+}
+
+// matchesPreset reports whether the torrent satisfies every condition of the
+// preset. Empty lists in a preset match anything.
+func matchesPreset(torrent *TorrentData, preset config.Preset) bool {
+	matchesAny := func(value string, allowed []string) bool {
+		if len(allowed) == 0 {
+			return true
+		}
+		for _, candidate := range allowed {
+			if strings.EqualFold(strings.TrimSpace(candidate), strings.TrimSpace(value)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !matchesAny(torrent.Format, preset.Formats) ||
+		!matchesAny(torrent.Encoding, preset.Encodings) ||
+		!matchesAny(torrent.Media, preset.Media) {
+		return false
+	}
+
+	if preset.MinLogScore != 0 && (!torrent.HasLog || torrent.LogScore < preset.MinLogScore) {
+		return false
+	}
+
+	if preset.RequireCue && !torrent.HasCue {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// PreviewHookResult is the outcome of a single hook evaluated in dry-run.
+type PreviewHookResult struct {
+	Hook      string `json:"hook"`
+	Passed    bool   `json:"passed"`
+	Requested string `json:"requested"`
+	Actual    string `json:"actual,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PreviewResponse is the body returned by the preview endpoint.
+type PreviewResponse struct {
+	Indexer   string              `json:"indexer"`
+	TorrentID int                 `json:"torrent_id"`
+	Approved  bool                `json:"approved"`
+	Hooks     []PreviewHookResult `json:"hooks"`
+}
+
+// PreviewHandler runs every requested hook against a torrent without
+// short-circuiting, and reports a per-hook pass/fail breakdown.
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := config.GetConfig()
+	var requestData RequestData
+
+	if !sourceAllowed(w, r, cfg) {
+		return
+	}
+
+	if inMaintenance(cfg) {
+		writeMaintenance(w, cfg)
+		return
+	}
+
+	if err := validateRequest(r, cfg, &requestData); err != nil {
+		writeHTTPError(w, err.err, err.status)
+		return
+	}
+
+	log.Info().Msgf("Received preview request from %s", r.RemoteAddr)
+
+	apiBase, err := requestAPIBase(&requestData)
+	if err != nil {
+		writeHTTPError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	response := PreviewResponse{
+		Indexer:   requestData.Indexer,
+		TorrentID: requestData.TorrentID,
+		Approved:  true,
+		Hooks:     previewHooks(&requestData, apiBase),
+	}
+	for _, result := range response.Hooks {
+		if !result.Passed {
+			response.Approved = false
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().Err(err).Msg("Failed to write preview response")
+	}
+}
+
+func previewHooks(requestData *RequestData, apiBase string) []PreviewHookResult {
+	results := []PreviewHookResult{}
+
+	for _, hook := range hookDefinitions {
+		if !hook.enabled(requestData) {
+			continue
+		}
+
+		result := PreviewHookResult{
+			Hook:      hook.name,
+			Passed:    true,
+			Requested: hook.requested(requestData),
+		}
+
+		if err := hook.run(requestData, apiBase); err != nil {
+			result.Passed = false
+			var rejection *rejectionError
+			if errors.As(err, &rejection) {
+				result.Reason = rejectWithDetail(hook.reason, rejection.detail).Error()
+			} else {
+				result.Error = err.Error()
+			}
+		}
+		// A preview approves nothing, so it takes no share of the quota.
+		releaseQuota(requestData)
+
+		if actual, err := hook.actual(requestData, apiBase); err == nil {
+			result.Actual = actual
+		} else if result.Error == "" {
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
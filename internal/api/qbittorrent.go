@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+const qbittorrentTimeout = 10 * time.Second
+
+// qbittorrentTorrent is the part of a /api/v2/torrents/info entry we compare.
+type qbittorrentTorrent struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// qbittorrentClient talks to the qBittorrent Web API, logging in on first
+// use and again whenever the session expired.
+type qbittorrentClient struct {
+	settings config.QBittorrent
+	client   *http.Client
+}
+
+var (
+	qbittorrentLock    sync.Mutex
+	qbittorrentCurrent *qbittorrentClient
+)
+
+// getQBittorrentClient returns the client for the configured instance,
+// replacing it when the settings changed on a config reload.
+func getQBittorrentClient(settings config.QBittorrent) (*qbittorrentClient, error) {
+	qbittorrentLock.Lock()
+	defer qbittorrentLock.Unlock()
+
+	if qbittorrentCurrent != nil && qbittorrentCurrent.settings == settings {
+		return qbittorrentCurrent, nil
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	qbittorrentCurrent = &qbittorrentClient{
+		settings: settings,
+		client:   &http.Client{Jar: jar, Timeout: qbittorrentTimeout},
+	}
+	return qbittorrentCurrent, nil
+}
+
+func (c *qbittorrentClient) endpoint(path string) string {
+	return strings.TrimSuffix(c.settings.URL, "/") + path
+}
+
+func (c *qbittorrentClient) login(ctx context.Context) error {
+	form := url.Values{"username": {c.settings.Username}, "password": {c.settings.Password}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("/api/v2/auth/login"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// qBittorrent rejects logins without a matching Referer when CSRF protection is on.
+	req.Header.Set("Referer", c.settings.URL)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("qBittorrent login: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("qBittorrent login failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// torrents lists every torrent in the client, logging in when needed.
+func (c *qbittorrentClient) torrents(ctx context.Context) ([]qbittorrentTorrent, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint("/api/v2/torrents/info"), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("qBittorrent torrents: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusForbidden && attempt == 0 {
+			resp.Body.Close()
+			if err := c.login(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var torrents []qbittorrentTorrent
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("qBittorrent torrents: status %d", resp.StatusCode)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&torrents)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("qBittorrent torrents: %w", err)
+		}
+		return torrents, nil
+	}
+}
+
+// findQBittorrentDuplicate returns the name of the torrent in torrents with
+// the same info hash, or the same name ignoring case, or "" if none matches.
+func findQBittorrentDuplicate(torrents []qbittorrentTorrent, name, hash string) string {
+	for _, torrent := range torrents {
+		if hash != "" && strings.EqualFold(torrent.Hash, hash) {
+			return torrent.Name
+		}
+		if name != "" && strings.EqualFold(strings.TrimSpace(torrent.Name), name) {
+			return torrent.Name
+		}
+	}
+	return ""
+}
+
+func hookQBittorrent(requestData *RequestData, apiBase string) error {
+	torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+	if err != nil {
+		return err
+	}
+
+	client, err := getQBittorrentClient(config.GetConfig().Integrations.QBittorrent)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), qbittorrentTimeout)
+	defer cancel()
+
+	torrents, err := client.torrents(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to check qBittorrent for duplicates")
+		return err
+	}
+
+	torrent := torrentData.Response.Torrent
+	name := strings.TrimSpace(html.UnescapeString(torrent.ReleaseName))
+	if duplicate := findQBittorrentDuplicate(torrents, name, torrent.InfoHash); duplicate != "" {
+		log.Debug().Msgf("[%s] Torrent %d is already in qBittorrent as '%s'", requestData.Indexer, requestData.TorrentID, duplicate)
+		return rejectWithDetail(ErrAlreadyInClient, duplicate)
+	}
+
+	log.Trace().Msgf("[%s] Torrent %d is not in qBittorrent (%d torrents checked)", requestData.Indexer, requestData.TorrentID, len(torrents))
+	return nil
+}
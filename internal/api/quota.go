@@ -0,0 +1,96 @@
+package api
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/inhies/go-bytesize"
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+const defaultQuotaWindow = 24 * time.Hour
+
+// quotaGrab is the size of a release approved at a point in time.
+type quotaGrab struct {
+	at   time.Time
+	size int64
+}
+
+// quotaGrabs holds the approvals inside the current window, oldest first.
+// It lives in memory only, so a restart starts a fresh window.
+var (
+	quotaLock  sync.Mutex
+	quotaGrabs []*quotaGrab
+)
+
+func quotaWindow(cfg *config.Config) time.Duration {
+	if cfg.Quota.Window <= 0 {
+		return defaultQuotaWindow
+	}
+	return cfg.Quota.Window
+}
+
+// quotaUsed returns the total size approved in the window ending at now,
+// forgetting approvals that fell out of it.
+func quotaUsed(now time.Time, window time.Duration) bytesize.ByteSize {
+	quotaLock.Lock()
+	defer quotaLock.Unlock()
+	return pruneQuota(now, window)
+}
+
+// pruneQuota does the work of quotaUsed, the caller holds quotaLock.
+func pruneQuota(now time.Time, window time.Duration) bytesize.ByteSize {
+	cutoff := now.Add(-window)
+	expired := 0
+	for expired < len(quotaGrabs) && !quotaGrabs[expired].at.After(cutoff) {
+		expired++
+	}
+	quotaGrabs = quotaGrabs[expired:]
+
+	var used int64
+	for _, grab := range quotaGrabs {
+		used += grab.size
+	}
+	return bytesize.ByteSize(used)
+}
+
+// reserveQuota counts size towards the quota for requestData if it fits
+// under maxSize, checking and counting under one lock so concurrent requests
+// can't overshoot it. It returns the size used before this request. The
+// reservation stands until releaseQuota is called, which runHooks does for
+// every request that is not approved.
+func reserveQuota(requestData *RequestData, size, maxSize bytesize.ByteSize, window time.Duration, now time.Time) (bytesize.ByteSize, bool) {
+	releaseQuota(requestData)
+
+	quotaLock.Lock()
+	defer quotaLock.Unlock()
+
+	used := pruneQuota(now, window)
+	if used+size > maxSize {
+		return used, false
+	}
+
+	requestData.quotaGrab = &quotaGrab{at: now, size: int64(size)}
+	quotaGrabs = append(quotaGrabs, requestData.quotaGrab)
+	log.Trace().Msgf("[%s] Counted %s towards the size quota", requestData.Indexer, size)
+	return used, true
+}
+
+// releaseQuota takes back the reservation of requestData, if it has one.
+func releaseQuota(requestData *RequestData) {
+	if requestData.quotaGrab == nil {
+		return
+	}
+
+	quotaLock.Lock()
+	if i := slices.Index(quotaGrabs, requestData.quotaGrab); i >= 0 {
+		quotaGrabs = slices.Delete(quotaGrabs, i, i+1)
+	}
+	quotaLock.Unlock()
+
+	log.Trace().Msgf("[%s] Released %s from the size quota", requestData.Indexer, bytesize.ByteSize(requestData.quotaGrab.size))
+	requestData.quotaGrab = nil
+}
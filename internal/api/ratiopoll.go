@@ -0,0 +1,138 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// polledUser is the latest user data fetched by the ratio poller.
+type polledUser struct {
+	data    *ResponseData
+	fetched time.Time
+}
+
+var (
+	polledUsers     = make(map[string]polledUser)
+	polledUsersLock sync.RWMutex
+	// ratioPollInterval is the interval of the running poller, 0 while
+	// polling is off. Guarded by polledUsersLock.
+	ratioPollInterval time.Duration
+
+	ratioPollStop chan struct{}
+	ratioPollDone chan struct{}
+)
+
+func polledUserKey(indexer string, userID int) string {
+	return fmt.Sprintf("%s_%d", indexer, userID)
+}
+
+// StartRatioPoll fetches the configured users' stats every interval in the
+// background, so ratio filters don't need an API call per request. A zero
+// interval leaves polling disabled.
+func StartRatioPoll(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	setRatioPollInterval(interval)
+	ratioPollStop = make(chan struct{})
+	ratioPollDone = make(chan struct{})
+	go runRatioPoll(interval, ratioPollStop, ratioPollDone)
+
+	log.Info().Msgf("Polling user stats every %s", interval)
+}
+
+// StopRatioPoll stops the poller started by StartRatioPoll.
+func StopRatioPoll() {
+	if ratioPollStop == nil {
+		return
+	}
+	close(ratioPollStop)
+	<-ratioPollDone
+	ratioPollStop = nil
+	setRatioPollInterval(0)
+}
+
+func setRatioPollInterval(interval time.Duration) {
+	polledUsersLock.Lock()
+	defer polledUsersLock.Unlock()
+	ratioPollInterval = interval
+}
+
+func runRatioPoll(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pollUsers()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pollUsers fetches the user stats for every indexer with both an API key and
+// a user ID configured. A failed fetch keeps the previous stats until they
+// are too old to use.
+func pollUsers() {
+	cfg := config.GetConfig()
+	users := []struct {
+		indexer string
+		apiBase string
+		apiKey  string
+		userID  int
+	}{
+		{"redacted", apiBases["redacted"], cfg.IndexerKeys.REDKey, cfg.UserIDs.REDUserID},
+		{"ops", apiBases["ops"], cfg.IndexerKeys.OPSKey, cfg.UserIDs.OPSUserID},
+	}
+
+	for _, user := range users {
+		if user.apiKey == "" || user.userID == 0 {
+			continue
+		}
+
+		data, err := initiateAPIRequest(user.userID, "user", user.apiKey, user.apiBase, user.indexer, requestTimeout(&RequestData{Indexer: user.indexer}))
+		recordAPIResult(user.indexer, err)
+		if err != nil {
+			log.Error().Err(err).Msgf("[%s] Failed to poll user stats", user.indexer)
+			continue
+		}
+
+		storePolledUser(user.indexer, user.userID, data, time.Now())
+		log.Trace().Msgf("[%s] Polled user stats, ratio %.2f", user.indexer, data.Response.Stats.Ratio)
+	}
+}
+
+func storePolledUser(indexer string, userID int, data *ResponseData, now time.Time) {
+	polledUsersLock.Lock()
+	defer polledUsersLock.Unlock()
+	polledUsers[polledUserKey(indexer, userID)] = polledUser{data: data, fetched: now}
+}
+
+// loadPolledUser returns the polled stats for the user, unless the poller
+// isn't running or the last successful poll is more than two of its
+// intervals old. The interval is the one the poller started with, since a
+// changed poll_interval only applies after a restart.
+func loadPolledUser(indexer string, userID int, now time.Time) (*ResponseData, bool) {
+	polledUsersLock.RLock()
+	defer polledUsersLock.RUnlock()
+
+	if ratioPollInterval <= 0 {
+		return nil, false
+	}
+
+	polled, ok := polledUsers[polledUserKey(indexer, userID)]
+	if !ok || now.Sub(polled.fetched) > 2*ratioPollInterval {
+		return nil, false
+	}
+	return polled.data, true
+}
@@ -0,0 +1,833 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inhies/go-bytesize"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// hookDefinition describes a single filter hook: when it applies, how it is
+// evaluated, and how its requested and actual values are reported.
+type hookDefinition struct {
+	name      string
+	reason    string
+	gate      bool // Always a hard filter, never outvoted in scoring mode
+	enabled   func(requestData *RequestData) bool
+	run       func(requestData *RequestData, apiBase string) error
+	requested func(requestData *RequestData) string
+	actual    func(requestData *RequestData, apiBase string) (string, error)
+}
+
+// hookDefinitions lists every hook in the order runHooks evaluates them.
+var hookDefinitions = []hookDefinition{
+	{
+		name:   "schedule",
+		reason: ErrOutsideSchedule,
+		gate:   true,
+		enabled: func(requestData *RequestData) bool {
+			return len(config.GetConfig().Schedule.AllowWindows) != 0
+		},
+		run: hookSchedule,
+		requested: func(requestData *RequestData) string {
+			return strings.Join(config.GetConfig().Schedule.AllowWindows, ", ")
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			return config.GetConfig().ParsedSchedule.In(time.Now()).Format("15:04 MST"), nil
+		},
+	},
+	{
+		name:   "size",
+		reason: ErrSizeNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (requestData.MinSize != 0 || requestData.MaxSize != 0)
+		},
+		run: hookSize,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%s - %s", requestData.MinSize, requestData.MaxSize)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return bytesize.ByteSize(torrentData.Response.Torrent.Size).String(), nil
+		},
+	},
+	{
+		name:   "free_space",
+		reason: ErrInsufficientDiskSpace,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && config.GetConfig().SizeCheck.DownloadPath != ""
+		},
+		run: hookFreeSpace,
+		requested: func(requestData *RequestData) string {
+			cfg := config.GetConfig()
+			return fmt.Sprintf("%s free on %s", cfg.ParsedSizes.MinFree, cfg.SizeCheck.DownloadPath)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			free, err := freeDiskSpace(config.GetConfig().SizeCheck.DownloadPath)
+			if err != nil {
+				return "", err
+			}
+			return bytesize.ByteSize(free).String(), nil
+		},
+	},
+	{
+		name:   "quota",
+		reason: ErrQuotaExceeded,
+		gate:   true,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && config.GetConfig().ParsedSizes.QuotaMaxSize != 0
+		},
+		run: hookQuota,
+		requested: func(requestData *RequestData) string {
+			cfg := config.GetConfig()
+			return fmt.Sprintf("%s per %s", cfg.ParsedSizes.QuotaMaxSize, quotaWindow(cfg))
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			return fmt.Sprintf("%s used", quotaUsed(time.Now(), quotaWindow(config.GetConfig()))), nil
+		},
+	},
+	{
+		name:   "leechers",
+		reason: ErrLeechersNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (requestData.MinLeechers != 0 || requestData.MaxLeechers != 0)
+		},
+		run: hookLeechers,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%d - %d", requestData.MinLeechers, requestData.MaxLeechers)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return strconv.Itoa(torrentData.Response.Torrent.Leechers), nil
+		},
+	},
+	{
+		name:   "seeders_or_freeleech",
+		reason: ErrSeedersNotFreeleech,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.MinSeedersOrFreeleech != 0
+		},
+		run: hookSeedersOrFreeleech,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%d seeders or freeleech", requestData.MinSeedersOrFreeleech)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			torrent := torrentData.Response.Torrent
+			if torrent.isFreeleech() {
+				return "freeleech", nil
+			}
+			return fmt.Sprintf("%d seeders", torrent.Seeders), nil
+		},
+	},
+	{
+		name:   "artists",
+		reason: ErrArtistsNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (requestData.MinArtists != 0 || requestData.MaxArtists != 0)
+		},
+		run: hookArtists,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%d - %d", requestData.MinArtists, requestData.MaxArtists)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return strconv.Itoa(len(torrentData.Response.Group.MusicInfo.Artists)), nil
+		},
+	},
+	{
+		name:   "tracks",
+		reason: ErrTracksNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (requestData.MinTracks != 0 || requestData.MaxTracks != 0)
+		},
+		run: hookTracks,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%d - %d", requestData.MinTracks, requestData.MaxTracks)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			files := parseFileList(torrentData.Response.Torrent.FileList)
+			if len(files) == 0 {
+				return "unknown", nil
+			}
+			return strconv.Itoa(trackCount(files)), nil
+		},
+	},
+	{
+		name:   "files",
+		reason: ErrTooManyFiles,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.MaxFiles != 0
+		},
+		run: hookFiles,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("at most %d", requestData.MaxFiles)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			if files := fileCount(torrentData.Response.Torrent); files != 0 {
+				return strconv.Itoa(files), nil
+			}
+			return "unknown", nil
+		},
+	},
+	{
+		name:   "bitrate",
+		reason: ErrBitrateBelowMinimum,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.MinBitrate != 0
+		},
+		run: hookBitrate,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%d kbps", requestData.MinBitrate)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			encoding := torrentData.Response.Torrent.Encoding
+			if bitrate, ok := encodingBitrate(encoding); ok && !isLosslessEncoding(encoding) {
+				return fmt.Sprintf("%s (%d kbps)", encoding, bitrate), nil
+			}
+			return encoding, nil
+		},
+	},
+	{
+		name:   "avg_bitrate",
+		reason: ErrAvgBitrate,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (requestData.MinAvgBitrate != 0 || requestData.MaxAvgBitrate != 0)
+		},
+		run: hookAvgBitrate,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%d - %d kbps", requestData.MinAvgBitrate, requestData.MaxAvgBitrate)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			torrent := torrentData.Response.Torrent
+			if torrent.Duration <= 0 {
+				return "duration not reported", nil
+			}
+			return fmt.Sprintf("%d kbps", averageBitrate(torrent.Size, torrent.Duration)), nil
+		},
+	},
+	{
+		name:   "lossless",
+		reason: ErrNotLossless,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.LosslessOnly
+		},
+		run: hookLossless,
+		requested: func(requestData *RequestData) string {
+			return "Lossless or 24bit Lossless"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return torrentData.Response.Torrent.Encoding, nil
+		},
+	},
+	{
+		name:   "reported",
+		reason: ErrTorrentReported,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.RejectReported
+		},
+		run: hookReported,
+		requested: func(requestData *RequestData) string {
+			return "not reported"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			if reported := torrentData.Response.Torrent.Reported; reported != nil && *reported {
+				return "reported", nil
+			}
+			return "not reported", nil
+		},
+	},
+	{
+		name:   "metadata",
+		reason: ErrMetadataIncomplete,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.RequireMetadata) > 0
+		},
+		run: hookMetadata,
+		requested: func(requestData *RequestData) string {
+			return strings.Join(requestData.RequireMetadata, ", ")
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			values := releaseMetadata(torrentData)
+			return fmt.Sprintf("%s=%q, %s=%q, %s=%q",
+				config.MetadataCatalogueNumber, values[config.MetadataCatalogueNumber],
+				config.MetadataYear, values[config.MetadataYear],
+				config.MetadataRecordLabel, values[config.MetadataRecordLabel]), nil
+		},
+	},
+	{
+		name:   "vanity_house",
+		reason: ErrVanityHouse,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.RejectVanityHouse
+		},
+		run: hookVanityHouse,
+		requested: func(requestData *RequestData) string {
+			return "official"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			if vanityHouse := torrentData.Response.Group.VanityHouse; vanityHouse != nil && *vanityHouse {
+				return "vanity house", nil
+			}
+			return "official", nil
+		},
+	},
+	{
+		name:   "verified_log",
+		reason: ErrLogNotVerified,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.RequireVerifiedLog
+		},
+		run: hookVerifiedLog,
+		requested: func(requestData *RequestData) string {
+			return "verified log"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			torrent := torrentData.Response.Torrent
+			verified, ok := logVerification(torrent)
+			switch {
+			case !ok:
+				return "unknown", nil
+			case !torrent.HasLog:
+				return "no log", nil
+			case verified:
+				return "verified log", nil
+			default:
+				return "unverified log", nil
+			}
+		},
+	},
+	{
+		name:   "ripper",
+		reason: ErrRipperNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.RequireRipper) > 0
+		},
+		run: hookRipper,
+		requested: func(requestData *RequestData) string {
+			return requestData.RequireRipper.String()
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			torrent := torrentData.Response.Torrent
+			switch ripper := logRipper(torrent); {
+			case !torrent.HasLog:
+				return "no log", nil
+			case ripper != "":
+				return ripper, nil
+			default:
+				return fmt.Sprintf("not reported, log score %d", torrent.LogScore), nil
+			}
+		},
+	},
+	{
+		name:   "cue_log",
+		reason: ErrCueLogInconsistent,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.CueLogConsistent
+		},
+		run: hookCueLog,
+		requested: func(requestData *RequestData) string {
+			return "log and cue, or neither"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			torrent := torrentData.Response.Torrent
+			if mismatch := cueLogMismatch(torrent); mismatch != "" {
+				return mismatch, nil
+			}
+			if !strings.EqualFold(torrent.Media, "CD") {
+				return torrent.Media, nil
+			}
+			return "log and cue, or neither", nil
+		},
+	},
+	{
+		name:   "artwork",
+		reason: ErrArtworkMissing,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.RequireArtwork
+		},
+		run: hookArtwork,
+		requested: func(requestData *RequestData) string {
+			return "artwork"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			if source := artworkSource(torrentData); source != "" {
+				return source, nil
+			}
+			return "no artwork", nil
+		},
+	},
+	{
+		name:   "description",
+		reason: ErrDescriptionNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (len(requestData.DescriptionContains) > 0 || len(requestData.DescriptionExcludes) > 0)
+		},
+		run: hookDescription,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("contains: %s, excludes: %s", requestData.DescriptionContains, requestData.DescriptionExcludes)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(html.UnescapeString(torrentData.Response.Torrent.Description)), nil
+		},
+	},
+	{
+		name:   "lineage",
+		reason: ErrLineageNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (len(requestData.LineageContains) > 0 || len(requestData.LineageExcludes) > 0)
+		},
+		run: hookLineage,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("contains: %s, excludes: %s", requestData.LineageContains, requestData.LineageExcludes)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return releaseLineage(torrentData), nil
+		},
+	},
+	{
+		name:   "name_source",
+		reason: ErrNameSource,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (len(requestData.NameSourceAllow) > 0 || len(requestData.NameSourceDeny) > 0)
+		},
+		run: hookNameSource,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("allow: %s, deny: %s", requestData.NameSourceAllow, requestData.NameSourceDeny)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return strings.Join(nameTokens(html.UnescapeString(torrentData.Response.Torrent.ReleaseName)), " "), nil
+		},
+	},
+	{
+		name:   "torrent_name",
+		reason: ErrTorrentNameMismatch,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.TorrentName != ""
+		},
+		run: hookTorrentName,
+		requested: func(requestData *RequestData) string {
+			return requestData.TorrentName
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return html.UnescapeString(torrentData.Response.Torrent.ReleaseName), nil
+		},
+	},
+	{
+		name:   "ops_flags",
+		reason: ErrIndexerFlag,
+		gate:   true,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.OPSRequireFlags) > 0 && opsFlagsApply(requestData.Indexer)
+		},
+		run: hookOPSFlags,
+		requested: func(requestData *RequestData) string {
+			return requestData.OPSRequireFlags.String()
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			if flag, detail := missingFlag(torrentData.Response.Torrent, parseAndTrimList(requestData.OPSRequireFlags)); flag != "" {
+				return detail, nil
+			}
+			return "all set", nil
+		},
+	},
+	{
+		name:   "featured",
+		reason: ErrNotFeatured,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.RequireFeatured
+		},
+		run: hookFeatured,
+		requested: func(requestData *RequestData) string {
+			return "featured"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			switch featured := torrentData.Response.Torrent.Featured; {
+			case featured == nil:
+				return "unknown", nil
+			case bool(*featured):
+				return "featured", nil
+			default:
+				return "not featured", nil
+			}
+		},
+	},
+	{
+		name:   "neutral_leech",
+		reason: ErrNotNeutralLeech,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.NeutralLeechOnly
+		},
+		run: hookNeutralLeech,
+		requested: func(requestData *RequestData) string {
+			return "neutral leech"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			if torrentData.Response.Torrent.isNeutralLeech() {
+				return "neutral leech", nil
+			}
+			return "not neutral leech", nil
+		},
+	},
+	{
+		name:   "token_eligible",
+		reason: ErrNotTokenEligible,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.TokenEligible
+		},
+		run: hookTokenEligible,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("not freeleech, at least %s", requestData.TokenMinSize)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			if eligible, why := tokenEligible(torrentData.Response.Torrent, requestData.TokenMinSize); !eligible {
+				return why, nil
+			}
+			return "eligible", nil
+		},
+	},
+	{
+		name:   "preset",
+		reason: ErrPresetNotMatched,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.Preset) > 0
+		},
+		run: hookPreset,
+		requested: func(requestData *RequestData) string {
+			return requestData.Preset.String()
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			torrent := torrentData.Response.Torrent
+			return fmt.Sprintf("%s / %s / %s", torrent.Format, torrent.Encoding, torrent.Media), nil
+		},
+	},
+	{
+		name:   "uploader",
+		reason: ErrUploaderNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.Uploaders) > 0
+		},
+		run: hookUploader,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("%s [%s]", requestData.Uploaders, requestData.Mode)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return matchedUsername(requestData, torrentData.Response.Torrent), nil
+		},
+	},
+	{
+		name:   "record_label",
+		reason: ErrRecordLabelNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.RecordLabel) > 0
+		},
+		run: hookRecordLabel,
+		requested: func(requestData *RequestData) string {
+			return requestData.RecordLabel.String()
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(html.UnescapeString(torrentData.Response.Torrent.RecordLabel)), nil
+		},
+	},
+	{
+		name:   "label_rules",
+		reason: ErrRecordLabelNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && (len(requestData.AllowLabels) > 0 || len(requestData.BlockLabels) > 0)
+		},
+		run: hookLabelRules,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("allow: %s, block: %s", requestData.AllowLabels, requestData.BlockLabels)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(html.UnescapeString(torrentData.Response.Torrent.RecordLabel)), nil
+		},
+	},
+	{
+		name:   "catalogue",
+		reason: ErrCatalogueBlocked,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.BlockCatalogue) > 0
+		},
+		run: hookCatalogue,
+		requested: func(requestData *RequestData) string {
+			return fmt.Sprintf("block: %s", requestData.BlockCatalogue)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return releaseMetadata(torrentData)[config.MetadataCatalogueNumber], nil
+		},
+	},
+	{
+		name:   "mbid",
+		reason: ErrMBIDNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.AllowMBIDs) > 0
+		},
+		run: hookMBID,
+		requested: func(requestData *RequestData) string {
+			return requestData.AllowMBIDs.String()
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return releaseMBID(torrentData), nil
+		},
+	},
+	{
+		name:   "country",
+		reason: ErrCountryNotAllowed,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && len(requestData.AllowCountries) > 0
+		},
+		run: hookCountry,
+		requested: func(requestData *RequestData) string {
+			return requestData.AllowCountries.String()
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return releaseCountry(torrentData), nil
+		},
+	},
+	{
+		name:   "ratio",
+		reason: ErrRatioBelowMinimum,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.MinRatio != 0 || (requestData.TorrentID != 0 && len(requestData.ratioBrackets) > 0)
+		},
+		run: hookRatio,
+		requested: func(requestData *RequestData) string {
+			if requestData.TorrentID != 0 && len(requestData.ratioBrackets) > 0 {
+				return "by torrent size"
+			}
+			return fmt.Sprintf("%.2f", requestData.MinRatio)
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			userID := getUserID(requestData)
+			if userID == 0 {
+				return "", fmt.Errorf("no user ID configured for %s", requestData.Indexer)
+			}
+			userData, err := fetchResponseData(requestData, userID, "user", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%.2f", userData.Response.Stats.Ratio), nil
+		},
+	},
+	{
+		name:   "required_ratio",
+		reason: ErrRequiredRatio,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.RespectRequiredRatio
+		},
+		run: hookRequiredRatio,
+		requested: func(requestData *RequestData) string {
+			return "required ratio"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			userID := getUserID(requestData)
+			if userID == 0 {
+				return "", fmt.Errorf("no user ID configured for %s", requestData.Indexer)
+			}
+			userData, err := fetchResponseData(requestData, userID, "user", apiBase)
+			if err != nil {
+				return "", err
+			}
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			stats := userData.Response.Stats
+			projected := projectedRatio(stats.Uploaded, stats.Downloaded, torrentData.Response.Torrent.Size)
+			return fmt.Sprintf("%.2f after download (required %.2f)", projected, stats.RequiredRatio), nil
+		},
+	},
+	{
+		name:   "snatched",
+		reason: ErrAlreadySnatched,
+		gate:   true,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && requestData.SkipAlreadySnatched
+		},
+		run: hookSnatched,
+		requested: func(requestData *RequestData) string {
+			return "not snatched"
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			userID := getUserID(requestData)
+			if userID == 0 {
+				return "", fmt.Errorf("no user ID configured for %s", requestData.Indexer)
+			}
+			snatched, err := fetchResponseData(requestData, userID, actionSnatched, apiBase)
+			if err != nil {
+				return "", err
+			}
+			if snatchedTorrent(snatched, requestData.TorrentID) {
+				return "snatched", nil
+			}
+			return "not snatched", nil
+		},
+	},
+	{
+		name:   "uploaded",
+		reason: ErrUploadedBelowMinimum,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.MinUploaded != 0
+		},
+		run: hookUploaded,
+		requested: func(requestData *RequestData) string {
+			return requestData.MinUploaded.String()
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			userID := getUserID(requestData)
+			if userID == 0 {
+				return "", fmt.Errorf("no user ID configured for %s", requestData.Indexer)
+			}
+			userData, err := fetchResponseData(requestData, userID, "user", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return bytesize.ByteSize(userData.Response.Stats.Uploaded).String(), nil
+		},
+	},
+	{
+		name:   "qbittorrent",
+		reason: ErrAlreadyInClient,
+		gate:   true,
+		enabled: func(requestData *RequestData) bool {
+			return requestData.TorrentID != 0 && config.GetConfig().Integrations.QBittorrent.URL != ""
+		},
+		run: hookQBittorrent,
+		requested: func(requestData *RequestData) string {
+			return "not in " + config.GetConfig().Integrations.QBittorrent.URL
+		},
+		actual: func(requestData *RequestData, apiBase string) (string, error) {
+			torrentData, err := fetchResponseData(requestData, requestData.TorrentID, "torrent", apiBase)
+			if err != nil {
+				return "", err
+			}
+			return html.UnescapeString(torrentData.Response.Torrent.ReleaseName), nil
+		},
+	},
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// releaseSummary is the release metadata returned on approval with
+// include_release. Fields the tracker didn't send are left out.
+type releaseSummary struct {
+	Name     string `json:"name,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Format   string `json:"format,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Media    string `json:"media,omitempty"`
+	Uploader string `json:"uploader,omitempty"`
+	Year     int    `json:"year,omitempty"`
+	Label    string `json:"label,omitempty"`
+}
+
+// approvalBody is the JSON body of an approved request with match_any_id or
+// include_release. Release is nil when no filter fetched the torrent.
+type approvalBody struct {
+	TorrentID int             `json:"torrent_id"`
+	Release   *releaseSummary `json:"release,omitempty"`
+}
+
+// fetchedRelease summarizes the torrent fetched while evaluating the
+// request. It never fetches anything itself, so it returns nil when no hook
+// needed the torrent.
+func fetchedRelease(requestData *RequestData) *releaseSummary {
+	if requestData.fetchedTorrent == nil || requestData.fetchedTorrent.Response.Torrent == nil {
+		return nil
+	}
+
+	torrentData := requestData.fetchedTorrent
+	torrent := torrentData.Response.Torrent
+	metadata := releaseMetadata(torrentData)
+	year, _ := strconv.Atoi(metadata[config.MetadataYear])
+
+	return &releaseSummary{
+		Name:     strings.TrimSpace(html.UnescapeString(torrent.ReleaseName)),
+		Size:     torrent.Size,
+		Format:   torrent.Format,
+		Encoding: torrent.Encoding,
+		Media:    torrent.Media,
+		Uploader: torrent.Username,
+		Year:     year,
+		Label:    metadata[config.MetadataRecordLabel],
+	}
+}
+
+// writeApproval writes the response of an approved request: the bare status
+// code, or a JSON body naming the torrent with match_any_id or
+// include_release. A 204 success status never gets a body.
+func writeApproval(w http.ResponseWriter, status int, requestData *RequestData) {
+	if (!requestData.MatchAnyID && !requestData.IncludeRelease) || status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+
+	body := approvalBody{TorrentID: requestData.TorrentID}
+	if requestData.IncludeRelease {
+		body.Release = fetchedRelease(requestData)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error().Err(err).Msg("Failed to write approval response")
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxNonceLength       = 128
+	nonceCleanupInterval = time.Minute
+)
+
+var (
+	errMissingReplayHeaders = errors.New("X-Timestamp and X-Nonce headers are required")
+	errStaleTimestamp       = errors.New("request timestamp is outside the replay window")
+	errReplayedNonce        = errors.New("request nonce was already used")
+)
+
+// seenNonces remembers the nonces used within the replay window, keyed by
+// nonce with the time they expire.
+var (
+	seenNoncesLock sync.Mutex
+	seenNonces     = make(map[string]time.Time)
+)
+
+func init() {
+	go startNonceCleanup()
+}
+
+// verifyReplay rejects requests whose X-Timestamp (unix seconds) is more than
+// window away from now, or whose X-Nonce was already used within the window.
+// A zero window disables the check.
+func verifyReplay(r *http.Request, window time.Duration, now time.Time) error {
+	if window <= 0 {
+		return nil
+	}
+
+	timestampHeader, nonce := r.Header.Get("X-Timestamp"), r.Header.Get("X-Nonce")
+	if timestampHeader == "" || nonce == "" {
+		return errMissingReplayHeaders
+	}
+	if len(nonce) > maxNonceLength {
+		return fmt.Errorf("X-Nonce is longer than %d characters", maxNonceLength)
+	}
+
+	seconds, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid X-Timestamp: %w", err)
+	}
+	timestamp := time.Unix(seconds, 0)
+	if timestamp.Before(now.Add(-window)) || timestamp.After(now.Add(window)) {
+		return errStaleTimestamp
+	}
+
+	seenNoncesLock.Lock()
+	defer seenNoncesLock.Unlock()
+
+	// Expired nonces are swept by startNonceCleanup, until then they are
+	// skipped here.
+	if expires, ok := seenNonces[nonce]; ok && !now.After(expires) {
+		return errReplayedNonce
+	}
+	// A nonce must outlive every timestamp it could be sent with.
+	seenNonces[nonce] = now.Add(2 * window)
+	return nil
+}
+
+func startNonceCleanup() {
+	ticker := time.NewTicker(nonceCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removeExpiredNonces(time.Now())
+		case <-done:
+			return
+		}
+	}
+}
+
+func removeExpiredNonces(now time.Time) {
+	seenNoncesLock.Lock()
+	defer seenNoncesLock.Unlock()
+
+	for nonce, expires := range seenNonces {
+		if now.After(expires) {
+			delete(seenNonces, nonce)
+		}
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"fmt"
 	"html"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/inhies/go-bytesize"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/time/rate"
+
+	"github.com/s0up4200/redactedhook/internal/config"
 )
 
 const (
@@ -19,6 +24,13 @@ const (
 	APIEndpointBaseOrpheus  = "https://orpheus.network/ajax.php"
 )
 
+// apiBases maps each tracker indexer to its API endpoint. Tests point it at
+// a local server.
+var apiBases = map[string]string{
+	"redacted": APIEndpointBaseRedacted,
+	"ops":      APIEndpointBaseOrpheus,
+}
+
 type HTTPClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
@@ -26,18 +38,78 @@ type HTTPClient interface {
 type APIClient struct {
 	client  HTTPClient
 	limiter *rate.Limiter
+	timeout time.Duration
+}
+
+const (
+	defaultMaxResponseSize = 16 * bytesize.MB
+	defaultRequestTimeout  = 10 * time.Second
+	maxRequestTimeout      = 30 * time.Second
+)
+
+var errResponseTooLarge = errors.New("response too large")
+
+// errEmptyResponse is a 200 with an empty body or an empty JSON object,
+// which trackers occasionally send under load. It is retried once after
+// emptyResponseRetryDelay.
+var errEmptyResponse = errors.New("empty response")
+
+var emptyResponseRetryDelay = time.Second
+
+// Sentinel errors wrapped by failed API calls, so callers can branch on the
+// cause with errors.Is regardless of which layer added context.
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrNotFound    = errors.New("not found")
+)
+
+// limitedBodyReader streams a response body and fails with
+// errResponseTooLarge once more than remaining bytes would be read.
+type limitedBodyReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedBodyReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		var probe [1]byte
+		if n, err := l.reader.Read(probe[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, errResponseTooLarge
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+func maxResponseSize() bytesize.ByteSize {
+	if size := config.GetConfig().ParsedSizes.MaxResponseSize; size > 0 {
+		return size
+	}
+	return defaultMaxResponseSize
 }
 
 func makeRequest(endpoint, apiKey string, client *APIClient, indexer string, target interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), client.timeout)
 	defer cancel()
 
-	if err := client.limiter.Wait(ctx); err != nil {
-		log.Warn().
-			Str("indexer", indexer).
-			Err(err).
-			Msg("Rate limit exceeded")
-		return fmt.Errorf("rate limit exceeded for %s: %w", indexer, err)
+	if err := waitJitter(ctx, config.GetConfig().API.Jitter); err != nil {
+		return fmt.Errorf("jitter delay interrupted for %s: %w", indexer, err)
+	}
+
+	release, err := acquireSlot(ctx, indexer, config.GetConfig().API.MaxConcurrentPerIndexer)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := acquireRateLimit(ctx, client.limiter, indexer, config.GetConfig().API.RateLimitMode); err != nil {
+		return err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
@@ -47,32 +119,45 @@ func makeRequest(endpoint, apiKey string, client *APIClient, indexer string, tar
 			Str("endpoint", endpoint).
 			Err(err).
 			Msg("Error creating HTTP request")
-		return err
+		return fmt.Errorf("error creating request for %s: %w", indexer, err)
 	}
-	req.Header.Set("Authorization", apiKey)
+	req.Header.Set("Authorization", authorizationValue(apiKey))
 
 	resp, err := client.client.Do(req)
 	if err != nil {
-		log.Error().Err(err).Msg("Error executing HTTP request")
-		return err
+		log.Error().Str("indexer", indexer).Err(err).Msg("Error executing HTTP request")
+		return fmt.Errorf("error executing request for %s: %w", indexer, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		errMsg := fmt.Sprintf("HTTP error: %d from %s", resp.StatusCode, endpoint)
-		log.Error().Msg(errMsg)
-		return errors.New(errMsg)
-	}
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Error().Err(err).Msg("Error reading response body")
-		return err
+		log.Error().Str("indexer", indexer).Msg(errMsg)
+		upstream := &upstreamError{indexer: indexer, status: resp.StatusCode, message: upstreamMessage(resp.Body)}
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			upstream.err = fmt.Errorf("%s: %w", errMsg, ErrRateLimited)
+		case http.StatusNotFound:
+			upstream.err = fmt.Errorf("%s: %w", errMsg, ErrNotFound)
+		default:
+			upstream.err = errors.New(errMsg)
+		}
+		return upstream
 	}
 
-	if err := json.Unmarshal(respBody, target); err != nil {
-		log.Error().Err(err).Msg("Invalid JSON response")
-		return fmt.Errorf("invalid JSON response: %w", err)
+	maxSize := maxResponseSize()
+	body := &limitedBodyReader{reader: resp.Body, remaining: int64(maxSize)}
+	if err := json.NewDecoder(body).Decode(target); err != nil {
+		if errors.Is(err, io.EOF) {
+			log.Warn().Str("indexer", indexer).Msg("Empty response body")
+			return fmt.Errorf("%w from %s", errEmptyResponse, indexer)
+		}
+		if errors.Is(err, errResponseTooLarge) {
+			log.Error().Str("indexer", indexer).Msgf("Response exceeds the maximum size of %s", maxSize)
+			return fmt.Errorf("response from %s exceeds the maximum size of %s: %w", indexer, maxSize, err)
+		}
+		log.Error().Str("indexer", indexer).Err(err).Msg("Invalid JSON response")
+		return fmt.Errorf("invalid JSON response from %s: %w", indexer, err)
 	}
 
 	responseData, ok := target.(*ResponseData)
@@ -81,54 +166,273 @@ func makeRequest(endpoint, apiKey string, client *APIClient, indexer string, tar
 		return fmt.Errorf("invalid target type")
 	}
 
+	if responseData.Status == "" && responseData.Error == "" {
+		log.Warn().Str("indexer", indexer).Msg("Response without a status")
+		return fmt.Errorf("%w from %s", errEmptyResponse, indexer)
+	}
 	if responseData.Status != "success" {
-		return fmt.Errorf("API error from %s: %s", indexer, responseData.Error)
+		return apiFailure(indexer, responseData.Error)
 	}
 
 	return nil
 }
 
-func initiateAPIRequest(id int, action, apiKey, apiBase, indexer string) (*ResponseData, error) {
+// upstreamError is a failed tracker API call. It keeps the tracker's status
+// and message so expose_upstream_errors can pass them on to the client.
+type upstreamError struct {
+	indexer string
+	status  int    // HTTP status from the tracker
+	message string // The tracker's error message, if it sent one
+	err     error
+}
+
+func (e *upstreamError) Error() string { return e.err.Error() }
+func (e *upstreamError) Unwrap() error { return e.err }
+
+// clientMessage is the response body for the error when upstream errors are
+// exposed, eg. "redacted returned 200: bad id parameter".
+func (e *upstreamError) clientMessage() string {
+	if e.message == "" {
+		return fmt.Sprintf("%s returned %d", e.indexer, e.status)
+	}
+	return fmt.Sprintf("%s returned %d: %s", e.indexer, e.status, e.message)
+}
+
+// upstreamMessage returns the error message from the body of a failed
+// tracker response: the "error" field if it is JSON, else the start of the body.
+func upstreamMessage(body io.Reader) string {
+	raw, _ := io.ReadAll(io.LimitReader(body, 1024))
+	var failure struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(raw, &failure) == nil && failure.Error != "" {
+		return failure.Error
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// apiFailure builds the error for a response with a non-success status,
+// wrapping ErrNotFound or ErrRateLimited when the tracker's message says so.
+func apiFailure(indexer, message string) error {
+	upstream := &upstreamError{indexer: indexer, status: http.StatusOK, message: message}
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "bad id"), strings.Contains(lower, "not found"):
+		upstream.err = fmt.Errorf("API error from %s: %s: %w", indexer, message, ErrNotFound)
+	case strings.Contains(lower, "rate limit"):
+		upstream.err = fmt.Errorf("API error from %s: %s: %w", indexer, message, ErrRateLimited)
+	default:
+		upstream.err = fmt.Errorf("API error from %s: %s", indexer, message)
+	}
+	return upstream
+}
+
+// acquireRateLimit takes a token from limiter. In reject mode it fails at
+// once when none is available, otherwise it waits for one until ctx is done.
+func acquireRateLimit(ctx context.Context, limiter *rate.Limiter, indexer, mode string) error {
+	if mode == config.RateLimitReject {
+		if !limiter.Allow() {
+			recordThrottle(indexer, true)
+			log.Warn().Str("indexer", indexer).Msg("Rate limit exceeded, rejecting API call")
+			return fmt.Errorf("%w by local limiter for %s", ErrRateLimited, indexer)
+		}
+		return nil
+	}
+
+	throttled := limiter.Tokens() < 1
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	recordLatency(latencyLimiterWait, indexer, time.Since(start))
+	if throttled || err != nil {
+		recordThrottle(indexer, err != nil)
+	}
+	if err != nil {
+		log.Warn().
+			Str("indexer", indexer).
+			Err(err).
+			Msg("Rate limit exceeded")
+		return fmt.Errorf("%w by local limiter for %s: %w", ErrRateLimited, indexer, err)
+	}
+	return nil
+}
+
+// waitJitter sleeps for a random duration in [0, maxDelay) to spread bursts
+// of upstream calls, returning early if ctx is done. A zero maxDelay disables it.
+func waitJitter(ctx context.Context, maxDelay time.Duration) error {
+	if maxDelay <= 0 {
+		return nil
+	}
+
+	delay := rand.N(maxDelay)
+	log.Trace().Msgf("Delaying API request by %s", delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// apiEndpoint builds the ajax.php URL for action and id. The snatched action
+// is the user_torrents API, limited to the user's most recent snatches.
+func apiEndpoint(apiBase, action string, id int) string {
+	if action == actionSnatched {
+		return fmt.Sprintf("%s?action=user_torrents&id=%d&type=snatched&limit=%d", apiBase, id, snatchedLimit)
+	}
+	return fmt.Sprintf("%s?action=%s&id=%d", apiBase, action, id)
+}
+
+func initiateAPIRequest(id int, action, apiKey, apiBase, indexer string, timeout time.Duration) (*ResponseData, error) {
 	limiter, err := getLimiter(indexer)
 	if err != nil {
 		return nil, fmt.Errorf("could not get rate limiter for indexer: %s, %w", indexer, err)
 	}
+	responseData, _, err := requestWithLimiter(id, action, apiKey, apiBase, indexer, timeout, limiter)
+	return responseData, err
+}
+
+// requestWithLimiter makes the API call, retrying an empty response once. It
+// returns how many calls reached the tracker, leaving out those refused by
+// the local limiter.
+func requestWithLimiter(id int, action, apiKey, apiBase, indexer string, timeout time.Duration, limiter *rate.Limiter) (*ResponseData, int, error) {
+	start := time.Now()
+	defer func() { recordLatency(latencyFetch, indexer, time.Since(start)) }()
+
+	// Bounds the wait before the retry, each call has a timeout of its own.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
 	client := &APIClient{
 		client:  http.DefaultClient,
 		limiter: limiter,
+		timeout: timeout,
 	}
 
-	endpoint := fmt.Sprintf("%s?action=%s&id=%d", apiBase, action, id)
+	endpoint := apiEndpoint(apiBase, action, id)
+	calls := 0
 	responseData := &ResponseData{}
-	if err := makeRequest(endpoint, apiKey, client, indexer, responseData); err != nil {
-		return nil, err
+	err := makeRequest(endpoint, apiKey, client, indexer, responseData)
+	if !limitedLocally(err) {
+		calls++
+	}
+	if errors.Is(err, errEmptyResponse) {
+		log.Warn().Str("indexer", indexer).Msgf("Empty response for %s %d, retrying once in %s", action, id, emptyResponseRetryDelay)
+		if err := waitRetry(ctx, emptyResponseRetryDelay); err != nil {
+			return nil, calls, fmt.Errorf("waiting to retry the empty response for %s %d: %w", action, id, err)
+		}
+		responseData = &ResponseData{}
+		err = makeRequest(endpoint, apiKey, client, indexer, responseData)
+		if !limitedLocally(err) {
+			calls++
+		}
+	}
+	if err != nil {
+		return nil, calls, err
 	}
 
-	if action == "torrent" && responseData.Response.Torrent != nil {
-		releaseName := html.UnescapeString(responseData.Response.Torrent.ReleaseName)
-		uploader := responseData.Response.Torrent.Username
-		log.Debug().Msgf("[%s] Checking release: %s - (Uploader: %s) (TorrentID: %d)", indexer, releaseName, uploader, id)
+	if err := prepareResponseData(responseData, id, action, indexer); err != nil {
+		return nil, calls, err
 	}
 
-	return responseData, nil
+	return responseData, calls, nil
+}
+
+// waitRetry waits for delay, or until ctx is done.
+func waitRetry(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// prepareResponseData resolves the requested torrent when the response
+// carried several, and logs the release being checked.
+func prepareResponseData(responseData *ResponseData, id int, action, indexer string) error {
+	if action != "torrent" {
+		return nil
+	}
+
+	responseData.Response.selectTorrent(id)
+	if responseData.Response.Torrent == nil {
+		return fmt.Errorf("no torrent data for ID %d in response from %s: %w", id, indexer, ErrNotFound)
+	}
+
+	releaseName := html.UnescapeString(responseData.Response.Torrent.ReleaseName)
+	uploader := responseData.Response.Torrent.Username
+	log.Debug().Msgf("[%s] Checking release: %s - (Uploader: %s) (TorrentID: %d)", indexer, releaseName, uploader, id)
+	return nil
 }
 
-// fetchResponseData fetches response data from an API, checks the cache first, and caches the response data for future use.
+// fetchResponseData returns the response data for id and remembers the
+// requested torrent on requestData for use after the hooks have run.
 func fetchResponseData(requestData *RequestData, id int, action, apiBase string) (*ResponseData, error) {
-	cacheKey := fmt.Sprintf("%s_%s_ID_%d", requestData.Indexer, action, id)
+	responseData, err := loadResponseData(requestData, id, action, apiBase)
+	if err != nil {
+		return nil, err
+	}
+
+	if action == "torrent" && id == requestData.TorrentID {
+		requestData.fetchedTorrent = responseData
+	}
+	return responseData, nil
+}
+
+// loadResponseData fetches response data from an API, checks the cache first, and caches the response data for future use.
+func loadResponseData(requestData *RequestData, id int, action, apiBase string) (*ResponseData, error) {
+	if isMockIndexer(requestData.Indexer) {
+		responseData, err := loadMockResponse(id, action)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %s data for ID %d from %s: %w", action, id, requestData.Indexer, err)
+		}
+		return responseData, nil
+	}
+
+	if action == "user" {
+		if polledData, found := loadPolledUser(requestData.Indexer, id, time.Now()); found {
+			log.Trace().Msgf("[%s] Using polled user stats for user %d", requestData.Indexer, id)
+			return polledData, nil
+		}
+	}
+
+	keyPrefix := requestData.Indexer
+	if requestData.APIBase != "" {
+		// Keep responses from an overridden endpoint apart from the real
+		// tracker's. The override goes in the middle, so clearCache still
+		// matches the key by indexer prefix and torrent suffix.
+		keyPrefix += "_" + requestData.APIBase
+	}
+	cacheKey := fmt.Sprintf("%s_%s_ID_%d", keyPrefix, action, id)
 	if cachedData, found := checkCache(cacheKey, requestData.Indexer); found {
 		return cachedData, nil
 	}
 
-	apiKey, err := getAPIKey(requestData)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout(requestData))
+	recentData, err := spaceLiveFetch(ctx, cacheKey, requestData.Indexer, config.GetConfig().API.MinRefetchInterval)
+	cancel()
 	if err != nil {
 		return nil, err
 	}
+	if recentData != nil {
+		return recentData, nil
+	}
 
-	responseData, err := initiateAPIRequest(id, action, apiKey, apiBase, requestData.Indexer)
+	apiKeys, err := getAPIKeys(requestData)
 	if err != nil {
-		wrappedErr := fmt.Errorf("error fetching %s data for ID %d: %w", action, id, err)
+		return nil, err
+	}
+
+	responseData, err := requestWithKeys(requestData, id, action, apiKeys, apiBase)
+	if err != nil {
+		wrappedErr := fmt.Errorf("error fetching %s data for ID %d from %s: %w", action, id, requestData.Indexer, err)
 		log.Error().Err(wrappedErr).Msg("Data fetching")
 		return nil, wrappedErr
 	}
@@ -137,15 +441,43 @@ func fetchResponseData(requestData *RequestData, id int, action, apiBase string)
 	return responseData, nil
 }
 
+// requestTimeout returns the timeout for a single tracker API call. A
+// per-request timeout_seconds overrides api.timeout, clamped to
+// maxRequestTimeout so a request can't outlive the server's write timeout.
+func requestTimeout(requestData *RequestData) time.Duration {
+	timeout := config.GetConfig().API.Timeout
+	if requestData.TimeoutSeconds > 0 {
+		timeout = time.Duration(requestData.TimeoutSeconds) * time.Second
+	}
+
+	if timeout <= 0 {
+		return defaultRequestTimeout
+	}
+	if timeout > maxRequestTimeout {
+		log.Debug().Msgf("[%s] Timeout %s exceeds the maximum, clamping to %s", requestData.Indexer, timeout, maxRequestTimeout)
+		return maxRequestTimeout
+	}
+	return timeout
+}
+
+// requestAPIBase returns the api_base override of the request, validated by
+// validateAPIBaseOverride, or else the indexer's endpoint.
+func requestAPIBase(requestData *RequestData) (string, error) {
+	if requestData.APIBase != "" {
+		log.Debug().Msgf("[%s] Using api_base override %s", requestData.Indexer, requestData.APIBase)
+		return requestData.APIBase, nil
+	}
+	return determineAPIBase(requestData.Indexer)
+}
+
 func determineAPIBase(indexer string) (string, error) {
-	switch indexer {
-	case "redacted":
-		return APIEndpointBaseRedacted, nil
-	case "ops":
-		return APIEndpointBaseOrpheus, nil
-	default:
-		return "", fmt.Errorf("invalid indexer: %s", indexer)
+	if indexer == mockIndexer {
+		return config.GetConfig().Mock.FixturesDir, nil
+	}
+	if apiBase, ok := apiBases[indexer]; ok {
+		return apiBase, nil
 	}
+	return "", fmt.Errorf("invalid indexer: %s", indexer)
 }
 
 func getAPIKey(requestData *RequestData) (string, error) {
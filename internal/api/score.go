@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+// scoreHookName is the hook name of score rejections, for [messages] and
+// [status_codes].
+const scoreHookName = "score"
+
+// hookWeight returns the points a passing hook is worth, 1 unless the score
+// config sets a weight for it.
+func hookWeight(score config.Score, hook string) float64 {
+	if weight, ok := score.Weights[hook]; ok {
+		return weight
+	}
+	return 1
+}
+
+// scoreHooks runs every enabled hook and approves the release when the
+// weights of the passing hooks add up to the threshold. Gate hooks run first
+// as hard filters and are not scored, so a full quota or a grab outside the
+// schedule can't be outvoted. Errors other than rejections stop at once, as
+// in runHooks.
+func scoreHooks(requestData *RequestData, apiBase string, score config.Score) error {
+	for _, hook := range hookDefinitions {
+		if !hook.gate || !hook.enabled(requestData) {
+			continue
+		}
+
+		if err := hook.run(requestData, apiBase); err != nil {
+			var rejection *rejectionError
+			if !errors.As(err, &rejection) {
+				return fmt.Errorf("%s hook failed: %w", hook.name, err)
+			}
+			return &rejectionError{hook: hook.name, reason: hook.reason, detail: rejection.detail}
+		}
+	}
+
+	var total, possible float64
+	var failed []string
+	for _, hook := range hookDefinitions {
+		if hook.gate || !hook.enabled(requestData) {
+			continue
+		}
+
+		weight := hookWeight(score, hook.name)
+		possible += weight
+
+		err := hook.run(requestData, apiBase)
+		var rejection *rejectionError
+		switch {
+		case err == nil:
+			total += weight
+		case errors.As(err, &rejection):
+			failed = append(failed, hook.name)
+		default:
+			return fmt.Errorf("%s hook failed: %w", hook.name, err)
+		}
+	}
+
+	log.Debug().Msgf("[%s] Torrent %d scored %s of %s, threshold %s", requestData.Indexer, requestData.TorrentID, formatPoints(total), formatPoints(possible), formatPoints(score.Threshold))
+	if total >= score.Threshold {
+		return nil
+	}
+
+	detail := fmt.Sprintf("scored %s of %s, needs %s", formatPoints(total), formatPoints(possible), formatPoints(score.Threshold))
+	if len(failed) > 0 {
+		detail += fmt.Sprintf(" (failed: %s)", strings.Join(failed, ", "))
+	}
+	return &rejectionError{hook: scoreHookName, reason: ErrScoreTooLow, detail: detail}
+}
+
+func formatPoints(points float64) string {
+	return strconv.FormatFloat(points, 'f', -1, 64)
+}
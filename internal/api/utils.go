@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
 )
 
 func setAuthorizationHeader(reqHeader *http.Header, requestData *RequestData) error {
@@ -15,19 +18,32 @@ func setAuthorizationHeader(reqHeader *http.Header, requestData *RequestData) er
 		apiKey = requestData.REDKey
 	case "ops":
 		apiKey = requestData.OPSKey
+	case mockIndexer:
+		return nil
 	default:
 		err := fmt.Errorf("invalid indexer: %s", requestData.Indexer)
 		log.Error().Err(err).Msg("Failed to set authorization header")
 		return err
 	}
-	reqHeader.Set("Authorization", apiKey)
+	reqHeader.Set("Authorization", authorizationValue(apiKey))
 	return nil
 }
 
+// authorizationValue is the Authorization header value for apiKey, with the
+// scheme from api.auth_scheme in front of it, eg. "token <key>". Without a
+// scheme the bare key is sent.
+func authorizationValue(apiKey string) string {
+	scheme := strings.TrimSpace(config.GetConfig().API.AuthScheme)
+	if scheme == "" {
+		return apiKey
+	}
+	return scheme + " " + apiKey
+}
+
 func decodeJSONPayload(r *http.Request, requestData *RequestData) error {
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
-		return fmt.Errorf("invalid JSON payload: %w", err)
+		return describePayloadError(err)
 	}
 	return nil
 }
@@ -1,14 +1,22 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
 )
 
+// mbidRegex matches a lowercased MusicBrainz ID, which is a UUID.
+var mbidRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
 func verifyAPIKey(headerAPIKey, expectedAPIKey string) error {
 	if expectedAPIKey == "" || headerAPIKey != expectedAPIKey {
 		return fmt.Errorf("invalid or missing API key")
@@ -23,22 +31,128 @@ func validateRequestMethod(method string) error {
 	return nil
 }
 
+// ValidateConfig checks the parts of the config that name filters, which the
+// config package can't check on its own as the filters are defined here.
+func ValidateConfig(cfg *config.Config) error {
+	validationErrors := validateStatusCodeHooks(cfg.StatusCodes)
+
+	weighted := make([]string, 0, len(cfg.Score.Weights))
+	for name := range cfg.Score.Weights {
+		weighted = append(weighted, name)
+	}
+	sort.Strings(weighted)
+	for _, name := range weighted {
+		hook, ok := findHook(name)
+		switch {
+		case !ok:
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid score weight for '%s', no such filter", name))
+		case hook.gate:
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid score weight for '%s', it is always a hard filter and never scored", name))
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.New(strings.Join(validationErrors, "; "))
+	}
+	return nil
+}
+
+// validateStatusCodeHooks checks that every key of [status_codes] names a
+// filter, and that no custom code is the default code of a filter that keeps
+// it, which would make the two indistinguishable.
+func validateStatusCodeHooks(statusCodes map[string]int) []string {
+	type hookStatus struct {
+		name   string
+		status int
+	}
+	defaults := []hookStatus{{scoreHookName, rejectStatusCodes[ErrScoreTooLow]}}
+	for _, hook := range hookDefinitions {
+		defaults = append(defaults, hookStatus{hook.name, rejectStatusCodes[hook.reason]})
+	}
+
+	names := make([]string, 0, len(statusCodes))
+	for name := range statusCodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var validationErrors []string
+	for _, name := range names {
+		if _, ok := findHook(name); !ok && name != scoreHookName {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid status code for '%s', no such filter", name))
+			continue
+		}
+		status := statusCodes[name]
+		for _, other := range defaults {
+			if _, remapped := statusCodes[other.name]; !remapped && other.status == status {
+				validationErrors = append(validationErrors, fmt.Sprintf("Invalid status code %d for '%s', it is already the default code of '%s'", status, name, other.name))
+				break
+			}
+		}
+	}
+	return validationErrors
+}
+
+// findHook returns the hook named name.
+func findHook(name string) (hookDefinition, bool) {
+	for _, hook := range hookDefinitions {
+		if hook.name == name {
+			return hook, true
+		}
+	}
+	return hookDefinition{}, false
+}
+
+// enabledHooks returns the names of the hooks the request enables, including
+// those enabled through config fallbacks.
+func enabledHooks(requestData *RequestData) []string {
+	var names []string
+	for _, hook := range hookDefinitions {
+		if hook.enabled(requestData) {
+			names = append(names, hook.name)
+		}
+	}
+	return names
+}
+
+// validateHookCount rejects requests enabling more than maxHooks hooks, as
+// each one may cost a tracker API call. A maxHooks of 0 disables the limit.
+func validateHookCount(requestData *RequestData, maxHooks int) error {
+	if maxHooks <= 0 {
+		return nil
+	}
+
+	hooks := enabledHooks(requestData)
+	if len(hooks) > maxHooks {
+		log.Warn().Msgf("[%s] Request enables %d filters, more than the maximum of %d: [%s]", requestData.Indexer, len(hooks), maxHooks, strings.Join(hooks, ", "))
+		return fmt.Errorf("request enables %d filters, the maximum is %d", len(hooks), maxHooks)
+	}
+	return nil
+}
+
 func validateRequestData(requestData *RequestData) error {
 	safeCharacterRegex := regexp.MustCompile(`^[\p{L}\p{N}\s&,-]+$`)
+	if requestData.Glob {
+		safeCharacterRegex = regexp.MustCompile(`^[\p{L}\p{N}\s&,*?-]+$`)
+	}
 
 	if err := validateIndexer(requestData.Indexer); err != nil {
 		log.Debug().Err(err).Msg("Validation error")
 		return err
 	}
 
-	if requestData.Indexer == "redacted" && requestData.REDKey == "" {
-		log.Debug().Msg("Missing RED API key")
-		return fmt.Errorf("RED API key is required for Redacted indexer")
+	if err := checkIndexerConfigured(requestData); err != nil {
+		return err
 	}
 
-	if requestData.Indexer == "ops" && requestData.OPSKey == "" {
-		log.Debug().Msg("Missing OPS API key")
-		return fmt.Errorf("OPS API key is required for Orpheus indexer")
+	if err := validateAPIBaseOverride(requestData, config.GetConfig().API.AllowAPIBaseOverride); err != nil {
+		log.Debug().Err(err).Msg("Validation error")
+		return err
+	}
+
+	if err := validateTorrentIDs(requestData); err != nil {
+		log.Debug().Err(err).Msg("Validation error")
+		return err
 	}
 
 	if requestData.TorrentID > 999_999_999 {
@@ -56,26 +170,121 @@ func validateRequestData(requestData *RequestData) error {
 		return fmt.Errorf("OPSKey is too long")
 	}
 
+	if requestData.MinRatioBuffer <= -1 {
+		log.Debug().Msg("min_ratio_buffer must be above -1")
+		return fmt.Errorf("min_ratio_buffer must be above -1")
+	}
+
 	if requestData.MinRatio < 0 || requestData.MinRatio > 999.999 {
 		log.Debug().Msg("minRatio must be between 0 and 999.999")
 		return fmt.Errorf("minRatio must be between 0 and 999.999")
 	}
 
 	if requestData.MaxSize > 0 && requestData.MinSize > requestData.MaxSize {
-		log.Debug().Msg("minSize cannot be greater than maxSize")
-		return fmt.Errorf("minSize cannot be greater than maxSize")
+		// Either bound may come from the config, so name both values.
+		log.Debug().Msgf("minSize %s cannot be greater than maxSize %s", requestData.MinSize, requestData.MaxSize)
+		return fmt.Errorf("minsize %s cannot be greater than maxsize %s, no torrent could pass", requestData.MinSize, requestData.MaxSize)
+	}
+
+	if requestData.MinLeechers < 0 || requestData.MaxLeechers < 0 {
+		log.Debug().Msg("minLeechers and maxLeechers cannot be negative")
+		return fmt.Errorf("minLeechers and maxLeechers cannot be negative")
+	}
+
+	if requestData.MaxLeechers > 0 && requestData.MinLeechers > requestData.MaxLeechers {
+		log.Debug().Msg("minLeechers cannot be greater than maxLeechers")
+		return fmt.Errorf("minLeechers cannot be greater than maxLeechers")
+	}
+
+	if requestData.MinArtists < 0 || requestData.MaxArtists < 0 {
+		log.Debug().Msg("minArtists and maxArtists cannot be negative")
+		return fmt.Errorf("minArtists and maxArtists cannot be negative")
+	}
+
+	if requestData.MaxArtists > 0 && requestData.MinArtists > requestData.MaxArtists {
+		log.Debug().Msg("minArtists cannot be greater than maxArtists")
+		return fmt.Errorf("minArtists cannot be greater than maxArtists")
+	}
+
+	if requestData.MinTracks < 0 || requestData.MaxTracks < 0 {
+		log.Debug().Msg("minTracks and maxTracks cannot be negative")
+		return fmt.Errorf("minTracks and maxTracks cannot be negative")
+	}
+
+	if requestData.MaxTracks > 0 && requestData.MinTracks > requestData.MaxTracks {
+		log.Debug().Msg("minTracks cannot be greater than maxTracks")
+		return fmt.Errorf("minTracks cannot be greater than maxTracks")
+	}
+
+	if requestData.MaxFiles < 0 {
+		log.Debug().Msg("maxFiles cannot be negative")
+		return fmt.Errorf("maxFiles cannot be negative")
+	}
+
+	if requestData.MinBitrate < 0 || requestData.MinBitrate > 9999 {
+		log.Debug().Msg("minBitrate must be between 0 and 9999")
+		return fmt.Errorf("minBitrate must be between 0 and 9999")
+	}
+
+	if requestData.MinAvgBitrate < 0 || requestData.MaxAvgBitrate < 0 {
+		log.Debug().Msg("min_avg_bitrate and max_avg_bitrate cannot be negative")
+		return fmt.Errorf("min_avg_bitrate and max_avg_bitrate cannot be negative")
+	}
+
+	if requestData.MaxAvgBitrate > 0 && requestData.MinAvgBitrate > requestData.MaxAvgBitrate {
+		log.Debug().Msg("min_avg_bitrate cannot be greater than max_avg_bitrate")
+		return fmt.Errorf("min_avg_bitrate cannot be greater than max_avg_bitrate")
+	}
+
+	if requestData.TimeoutSeconds < 0 {
+		log.Debug().Msg("timeout_seconds cannot be negative")
+		return fmt.Errorf("timeout_seconds cannot be negative")
+	}
+
+	for _, field := range requestData.RequireMetadata {
+		if !config.IsMetadataField(field) {
+			log.Debug().Str("field", field).Msg("Invalid metadata field")
+			return fmt.Errorf("require_complete_metadata must only contain %s, got '%s'", strings.Join(config.MetadataFields, ", "), field)
+		}
+	}
+
+	if len(requestData.Preset) > 0 {
+		for _, name := range parseAndTrimList(requestData.Preset) {
+			if _, ok := lookupPreset(name); !ok {
+				log.Debug().Str("preset", name).Msg("Unknown preset")
+				return fmt.Errorf("unknown preset: %s", name)
+			}
+		}
+	}
+
+	if requestData.TorrentNameMode != "" && requestData.TorrentNameMode != config.TorrentNameWarn && requestData.TorrentNameMode != config.TorrentNameReject {
+		log.Debug().Str("torrent_name_mode", requestData.TorrentNameMode).Msg("Invalid torrent name mode")
+		return fmt.Errorf("torrent_name_mode must be either '%s' or '%s', got '%s'", config.TorrentNameWarn, config.TorrentNameReject, requestData.TorrentNameMode)
 	}
 
-	if requestData.Uploaders != "" {
+	if requestData.MatchOn != "" && requestData.MatchOn != config.MatchOnUploader && requestData.MatchOn != config.MatchOnEditor {
+		log.Debug().Str("match_on", requestData.MatchOn).Msg("Invalid uploader match_on")
+		return fmt.Errorf("match_on must be either '%s' or '%s', got '%s'", config.MatchOnUploader, config.MatchOnEditor, requestData.MatchOn)
+	}
+
+	if len(requestData.Uploaders) > 0 {
 		if requestData.Mode != "whitelist" && requestData.Mode != "blacklist" {
 			log.Debug().Str("mode", requestData.Mode).Msg("Invalid mode")
 			return fmt.Errorf("mode must be either 'whitelist' or 'blacklist', got '%s'", requestData.Mode)
 		}
 	}
 
-	if requestData.RecordLabel != "" {
-		labels := strings.Split(requestData.RecordLabel, ",")
-		for _, label := range labels {
+	if len(requestData.AllowMBIDs) > 0 {
+		for _, mbid := range parseAndTrimList(requestData.AllowMBIDs) {
+			if !mbidRegex.MatchString(mbid) {
+				log.Debug().Str("mbid", mbid).Msg("Invalid MusicBrainz ID")
+				return fmt.Errorf("allow_mbids must only contain MusicBrainz IDs, got '%s'", mbid)
+			}
+		}
+	}
+
+	if len(requestData.RecordLabel) > 0 {
+		for _, label := range requestData.RecordLabel {
 			trimmedLabel := strings.TrimSpace(label)
 			if !safeCharacterRegex.MatchString(trimmedLabel) {
 				log.Debug().Msg("Invalid record label format")
@@ -87,8 +296,70 @@ func validateRequestData(requestData *RequestData) error {
 	return nil
 }
 
+// normalizeIndexer lowercases the indexer, so "Redacted" or "OPS" sent by
+// autobrr match the indexer names.
+func normalizeIndexer(indexer string) string {
+	return strings.ToLower(strings.TrimSpace(indexer))
+}
+
+// validateAPIBaseOverride checks the api_base of the request, if any. The
+// override is refused unless allowed in the config, since it makes the
+// server send the tracker API key to any URL a caller names.
+func validateAPIBaseOverride(requestData *RequestData, allowed bool) error {
+	if requestData.APIBase == "" {
+		return nil
+	}
+	if !allowed {
+		return fmt.Errorf("api_base is not allowed, enable allow_api_base_override in the [api] config section")
+	}
+	if requestData.Indexer == mockIndexer {
+		return fmt.Errorf("api_base cannot be used with the mock indexer")
+	}
+
+	base, err := url.Parse(requestData.APIBase)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return fmt.Errorf("invalid api_base '%s', must be an http or https URL", requestData.APIBase)
+	}
+	return nil
+}
+
+// checkIndexerConfigured rejects requests for an indexer without an API key
+// in the config or the request, naming the indexers that do have one. This
+// catches requests autobrr sent with the wrong indexer before any API call,
+// where they would fail as a confusing tracker error.
+func checkIndexerConfigured(requestData *RequestData) error {
+	keys := []struct {
+		indexer string
+		name    string
+		key     string
+	}{
+		{"redacted", "RED", requestData.REDKey},
+		{"ops", "OPS", requestData.OPSKey},
+	}
+
+	var configured []string
+	missing := ""
+	for _, k := range keys {
+		switch {
+		case k.key != "":
+			configured = append(configured, k.name)
+		case k.indexer == requestData.Indexer:
+			missing = k.name
+		}
+	}
+	if missing == "" {
+		return nil
+	}
+
+	log.Warn().Msgf("Request for %s, but no %s API key is configured (configured: %s)", requestData.Indexer, missing, strings.Join(configured, ", "))
+	if len(configured) == 0 {
+		return fmt.Errorf("%s is not configured on this instance: no API key in the config or request", missing)
+	}
+	return fmt.Errorf("%s is not configured on this instance: no API key in the config or request, only %s is", missing, strings.Join(configured, " and "))
+}
+
 func validateIndexer(indexer string) error {
-	if indexer != "ops" && indexer != "redacted" {
+	if indexer != "ops" && indexer != "redacted" && !isMockIndexer(indexer) {
 		if indexer == "" {
 			return fmt.Errorf("no indexer provided")
 		}
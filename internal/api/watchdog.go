@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/s0up4200/redactedhook/internal/config"
+)
+
+const (
+	errorRateWindow      = time.Minute
+	errorRateThreshold   = 0.5
+	errorRateMinRequests = 4 // Fewer calls in a window are too few to judge
+)
+
+// apiCallCounter counts the tracker API calls of one indexer during the
+// current watchdog window.
+type apiCallCounter struct {
+	total    atomic.Int64
+	failed   atomic.Int64
+	alerting atomic.Bool
+
+	// lastSuccess and lastError are unix nanoseconds, 0 until the first call.
+	lastSuccess atomic.Int64
+	lastError   atomic.Int64
+}
+
+// apiCallCounters is never written after init, so it is safe to read
+// without a lock.
+var apiCallCounters = map[string]*apiCallCounter{
+	"redacted": {},
+	"ops":      {},
+}
+
+func init() {
+	go startErrorWatchdog()
+}
+
+// recordAPIResult counts a tracker API call towards the error rate of
+// indexer. Cache hits are not API calls and should not be recorded.
+func recordAPIResult(indexer string, err error) {
+	counter, ok := apiCallCounters[indexer]
+	if !ok {
+		return
+	}
+
+	counter.total.Add(1)
+	if indexerFailure(err) {
+		counter.failed.Add(1)
+		counter.lastError.Store(time.Now().UnixNano())
+		return
+	}
+	counter.lastSuccess.Store(time.Now().UnixNano())
+}
+
+// indexerFailure reports whether err says the indexer is unwell: the call
+// didn't get through, the tracker failed with a 5xx, or it refused our key
+// with a 401. Other answers, such as an unknown torrent ID or a rate limit,
+// come from a tracker that is up.
+func indexerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var upstream *upstreamError
+	if !errors.As(err, &upstream) {
+		return true
+	}
+	return upstream.status >= http.StatusInternalServerError || upstream.status == http.StatusUnauthorized
+}
+
+// IndexerStatus is the tracker API health of one indexer.
+type IndexerStatus struct {
+	Indexer     string     `json:"indexer"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   *time.Time `json:"last_error,omitempty"`
+	Degraded    bool       `json:"degraded"`
+}
+
+// IndexerStatuses returns the API health of every indexer, sorted by name,
+// judged against api.degraded_after.
+func IndexerStatuses(now time.Time) []IndexerStatus {
+	window := config.GetConfig().API.DegradedAfter
+	statuses := make([]IndexerStatus, 0, len(apiCallCounters))
+	for indexer, counter := range apiCallCounters {
+		statuses = append(statuses, counter.status(indexer, now, window))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Indexer < statuses[j].Indexer })
+	return statuses
+}
+
+// status reports the indexer as degraded when its last call failed and no
+// call succeeded within window. An indexer without failed calls is never
+// degraded, however long it has been idle, and a zero window disables it.
+func (c *apiCallCounter) status(indexer string, now time.Time, window time.Duration) IndexerStatus {
+	status := IndexerStatus{Indexer: indexer}
+	lastSuccess, lastError := c.lastSuccess.Load(), c.lastError.Load()
+	if lastSuccess != 0 {
+		t := time.Unix(0, lastSuccess).UTC()
+		status.LastSuccess = &t
+	}
+	if lastError != 0 {
+		t := time.Unix(0, lastError).UTC()
+		status.LastError = &t
+	}
+
+	status.Degraded = window > 0 && lastError > lastSuccess &&
+		(lastSuccess == 0 || now.Sub(time.Unix(0, lastSuccess)) > window)
+	return status
+}
+
+func startErrorWatchdog() {
+	ticker := time.NewTicker(errorRateWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			checkErrorRates()
+		case <-done:
+			return
+		}
+	}
+}
+
+// checkErrorRates logs a warning for every indexer whose API error rate
+// over the last window crossed errorRateThreshold, and resets the counters.
+func checkErrorRates() {
+	for indexer, counter := range apiCallCounters {
+		total := counter.total.Swap(0)
+		failed := counter.failed.Swap(0)
+
+		if total < errorRateMinRequests {
+			continue
+		}
+
+		rate := float64(failed) / float64(total)
+		if rate > errorRateThreshold {
+			counter.alerting.Store(true)
+			log.Warn().
+				Str("indexer", indexer).
+				Int64("failed", failed).
+				Int64("total", total).
+				Msgf("%.0f%% of API calls failed in the last %s, the tracker may be down or the API key invalid", rate*100, errorRateWindow)
+			continue
+		}
+
+		if counter.alerting.Swap(false) {
+			log.Info().Str("indexer", indexer).Msgf("API error rate recovered to %.0f%%", rate*100)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -14,23 +15,93 @@ const (
 	defaultLogLevel       = "trace"
 )
 
+// GetConfig returns the active config snapshot. Hold on to the returned
+// pointer for the duration of a request to see a consistent config.
 func GetConfig() *Config {
-	return &config
+	return current.Load()
+}
+
+// RedactedString returns the effective config as a single line of JSON with
+// API keys and tokens masked down to their last 4 characters.
+func (c Config) RedactedString() string {
+	c.Authorization.APIToken = maskSecret(c.Authorization.APIToken)
+	c.IndexerKeys.REDKey = maskSecret(c.IndexerKeys.REDKey)
+	c.IndexerKeys.OPSKey = maskSecret(c.IndexerKeys.OPSKey)
+	redKeys := make([]string, len(c.IndexerKeys.REDKeys))
+	for i, key := range c.IndexerKeys.REDKeys {
+		redKeys[i] = maskSecret(key)
+	}
+	c.IndexerKeys.REDKeys = redKeys
+	c.Integrations.QBittorrent.Password = maskSecret(c.Integrations.QBittorrent.Password)
+
+	out, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("<unable to render config: %v>", err)
+	}
+	return string(out)
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
 }
 
 func CreateConfigFile() string {
 	config := `[server]
 host = "127.0.0.1" # Server host
 port = 42135       # Server port
+#default_indexer = "redacted" # indexer to use when a request does not set one, redacted or ops
+#max_hooks = 0 # max number of filters a single request may enable, requests over it get a 400. 0 is unlimited
+#success_status = 200 # status code for approved releases, eg. 204 for pipelines expecting No Content. Must be 2xx
+#collect_all_reasons = false # run every filter and list all rejection reasons instead of stopping at the first
+#strict_request = false # reject requests with unknown fields with a 400, instead of ignoring them
+#reject_headers = true # set X-Reject-Reason and X-Reject-Detail headers on rejected releases
+#quiet_rejections = false # answer rejected releases with the status code and an empty body, the reason is still logged
+#include_release = false # answer approved releases with the release metadata the filters fetched as JSON
+#maintenance = false # answer every hook request with 503 without checking it, eg. during tracker maintenance. Applied on save
+#allowed_ips = [] # IPs or CIDRs allowed to call /hook, /hook/preview, /maintenance and /cache/clear, eg. ["127.0.0.1", "172.16.0.0/12"]. Others get a 403. Empty allows all
+#trusted_proxies = [] # reverse proxies whose X-Forwarded-For header names the client IP for allowed_ips
 
 [authorization]
 api_token = "ch4ng3this" # generate with "redactedhook generate-apitoken"
+#replay_window = "0s" # require X-Timestamp and X-Nonce headers within this window, eg. "5m". 0s disables
 # the api_token needs to be set as a header for the webhook to work
 # eg. Header: X-API-Token=aaa129cd1d66ed6fa567da2d07a5dd0e
 
+[api]
+#timeout = "10s" # timeout for each tracker API call, max 30s
+#jitter = "500ms" # max random delay before each tracker API call, spreads bursts of announces. 0 disables
+#max_response_size = "16MB" # responses larger than this are rejected, guards against huge group responses
+#ratelimit_mode = "wait" # "wait" queues calls over the rate limit until the timeout, "reject" fails them at once
+#max_concurrent_per_indexer = 0 # max API calls in flight per indexer, so a slow tracker doesn't hold up the other. 0 is unlimited
+#expose_upstream_errors = false # include the tracker's error status and message in 500 responses, may leak details about your keys
+#auth_scheme = "" # scheme in front of the API key in the Authorization header, eg. "token" or "Bearer". Empty sends the bare key
+#degraded_after = "1h" # report an indexer as degraded on /healthz and /stats when its calls fail without a success for this long. 0s disables
+#allow_api_base_override = false # honor api_base in requests, eg. to test against a staging tracker. Sends your API key to that URL, keep off in production
+#limiter_log_interval = "0s" # log tokens left and throttled calls per indexer this often at debug level, eg. "1m". 0s disables, read at startup
+#min_refetch_interval = "0s" # least time between live fetches of the same torrent, eg. "30s", against clients repeating a lookup. 0s disables
+
+[decision_webhook]
+#url = "" # POST every decision as JSON to this URL, eg. for your own logging
+#timeout = "5s"
+
+[analytics]
+#sqlite_path = "" # store every decision in this SQLite database, read at startup
+
+[integrations.qbittorrent]
+#url = "" # eg. "http://localhost:8080", reject releases that are already in this qBittorrent instance
+#username = ""
+#password = ""
+
 [indexer_keys]
 #red_apikey = "" # generate in user settings, needs torrent and user privileges
 #ops_apikey = "" # generate in user settings, needs torrent and user privileges
+#red_apikeys = [] # more RED keys, tried in order when a key is rate limited or rejected. See the README before sharing keys
 
 [userid]
 #red_user_id = 0 # from /user.php?id=xxx
@@ -38,20 +109,129 @@ api_token = "ch4ng3this" # generate with "redactedhook generate-apitoken"
 
 [ratio]
 #minratio = 0.6 # reject releases if you are below this ratio
+#minuploaded = "500 GiB" # reject releases if you have uploaded less than this in total
+#respect_required_ratio = false # reject releases that would drop you below your required ratio
+#skip_ratio_on_freeleech = false # skip the minratio check for freeleech torrents
+#epsilon = 0.000001 # tolerance for ratio comparisons, so eg. a returned 0.9999999 still passes minratio = 1.0
+#poll_interval = "0s" # fetch your user stats in the background this often, eg. "10m", instead of on every request. Read at startup
+#[[ratio.brackets]] # minratio by torrent size, used instead of minratio when the request sets none
+#min_size = "0B"    # the bracket applies to torrents of at least this size, the largest matching bracket wins
+#minratio = 0.6
+#[[ratio.brackets]]
+#min_size = "5GB"
+#minratio = 1.0
 
 [sizecheck]
 #minsize = "100MB" # minimum size for checking, e.g., "10MB"
 #maxsize = "500MB" # maximum size for checking, e.g., "1GB"
+#download_path = "/data/torrents" # reject torrents larger than the free space on this path
+#min_free = "10GB"                # free space to always keep on download_path
+
+[quota]
+#max_size = "50GiB" # max total size of approved releases per window, further releases are rejected
+#window = "24h"     # rolling window for max_size
+
+[schedule]
+#allow_windows = ["08:00-17:00", "22:00-02:00"] # only approve grabs in these daily windows, a window may run past midnight
+#timezone = "" # eg. "Europe/Oslo", defaults to the server's local time
+
+[score]
+#enabled = false # approve releases by points instead of requiring every filter to pass
+#threshold = 3   # points needed for approval, above 0. Every passing filter adds its weight
+#[score.weights] # points per filter name, as in [messages]. Filters not listed are worth 1
+#uploader = 2
+#size = 1
+
+[leechers]
+#minleechers = 1  # minimum number of leechers on the torrent
+#maxleechers = 50 # maximum number of leechers on the torrent
+
+[seeders]
+#min_seeders_or_freeleech = 3 # require this many seeders, unless the torrent is freeleech
+
+[artists]
+#minartists = 1 # minimum number of artists credited on the release
+#maxartists = 3 # maximum number of artists, useful for skipping compilations
+
+[tracks]
+#mintracks = 5  # minimum number of audio files in the torrent, useful for skipping singles
+#maxtracks = 30 # maximum number of audio files in the torrent
+#maxfiles = 50  # maximum number of files of any kind, against packs bundling unrelated files
+
+[bitrate]
+#minbitrate = 245 # reject lossy releases below this nominal bitrate in kbps, lossless always passes
+#min_avg_bitrate = 0 # reject releases whose size / duration is below this many kbps, skipped if the tracker doesn't report the duration
+#max_avg_bitrate = 0 # reject releases whose size / duration is above this many kbps
+#lossless_only = false # only allow Lossless and 24bit Lossless releases
+
+#[bitrate.encodings] # override or extend the nominal bitrate of an encoding
+#"V0 (VBR)" = 245
+#"APS (VBR)" = 215
+
+[filters]
+#reject_reported = false # reject torrents that are reported and pending removal
+#reject_vanity_house = false # only allow official releases, reject vanity house groups
+#require_verified_log = false # only allow releases whose log was checked against the log database
+#require_ripper = "" # rippers the log must be made with, eg. "EAC,XLD". Falls back to the log score when the tracker does not report the ripper
+#cue_log_consistent = false # reject CD rips with a log but no cue, or a cue but no log
+#require_artwork = false # only allow releases with cover art
+#require_featured = false # only allow releases flagged as featured, for indexers that report it
+#skip_already_snatched = false # reject torrents you already snatched, costs an extra API call per request
+#neutral_leech_only = false # only allow neutral leech torrents, where neither upload nor download counts
+#glob = false            # treat uploaders and record_labels entries as glob patterns, eg. "RED*,*Bot"
+#require_complete_metadata = ["catalogue_number", "year", "record_label"] # reject releases missing any of these
+#preset = "perfect_flac_cd,web_flac" # comma separated list of presets, the release must match at least one
+#description_contains = "" # comma separated keywords, the torrent description must contain at least one
+#description_excludes = "promo,advance" # comma separated keywords, the torrent description must contain none
+#lineage_contains = "" # comma separated keywords, the release lineage must contain at least one. Skipped if the tracker doesn't report a lineage
+#lineage_excludes = "" # comma separated keywords, the release lineage must contain none, eg. "unknown lineage"
+#ops_require_flags = "" # OPS only: boolean fields of the torrent that must be true, eg. "scene". Ignored for RED requests
+#torrent_name_mode = "warn" # "warn" logs a torrentname that differs from the release on the tracker, "reject" rejects it
+#allow_mbids = "" # only allow releases with one of these MusicBrainz IDs, skipped if the tracker doesn't report one
+#allow_countries = "" # only allow releases from one of these countries, eg. "Japan". Skipped if the tracker doesn't report one
+#name_source_allow = "" # source tags, eg. "Vinyl,SACD", the release name must contain at least one
+#name_source_deny = ""  # source tags the release name must contain none of, checked before name_source_allow
+#token_eligible = false # only allow torrents worth a freeleech token: not freeleech already, and at least token_min_size
+#token_min_size = ""    # eg. "1GB", smallest torrent worth spending a token on
+
+#[presets.vinyl_24bit] # define your own presets, or redefine a built-in one
+#formats = ["FLAC"]
+#encodings = ["24bit Lossless"]
+#media = ["Vinyl"]
+#min_log_score = 0
+#require_cue = false
 
 [uploaders]
 #uploaders = "greatest-uploader" # comma separated list of uploaders to allow
 #mode = "whitelist" # whitelist or blacklist
+#match_on = "uploader" # "uploader" checks the original uploader, "editor" who last edited the torrent
 
 [record_labels]
 #record_labels = "" # comma separated list of record labels to filter for
+#allow_labels = ""  # release must be on one of these labels
+#block_labels = ""  # release must not be on any of these labels, checked before allow_labels
+#block_catalogue_prefixes = "" # reject releases whose catalogue number starts with any of these, eg. "BOOT,LIVE-"
+
+[request_aliases]
+# Extra request field names to accept, mapped to the canonical field name.
+# Common variants such as "min_ratio" or "torrentId" are already accepted.
+#minimum_ratio = "minratio"
+
+[messages]
+# Custom response bodies for rejections, keyed by filter name, shown in autobrr.
+# "{detail}" is replaced with the rejection details, such as the missing field.
+#ratio = "Ratio too low"
+#metadata = "Incomplete metadata: {detail}"
+
+[status_codes]
+# Custom status codes for rejections, keyed by filter name, for proxies that mangle
+# the default 226 and up codes. Must be unique, a 2xx or 402-499.
+#ratio = 460
+#uploader = 461
 
 [logs]
 loglevel = "trace"               # trace, debug, info
+#output = "stdout"               # stdout, file or syslog (journald on systemd hosts)
 logtofile = false                # Set to true to enable logging to a file
 logfilepath = "redactedhook.log" # Path to the log file
 maxsize = 10                     # Max file size in MB
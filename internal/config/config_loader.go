@@ -3,8 +3,16 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/inhies/go-bytesize"
@@ -14,114 +22,615 @@ import (
 
 const EnvPrefix = "REDACTEDHOOK__"
 
+// extraConfigFiles are the config files merged over the base config file, in
+// order, when --config lists more than one file. Reloads rewrite it, so it is
+// guarded by reloadLock.
+var extraConfigFiles []string
+
+// configPaths are the entries of --config as given, and configDirs the
+// directories among them. The directories are rescanned on every reload so
+// files added to or removed from them are picked up.
+var (
+	configPaths []string
+	configDirs  []string
+)
+
+// InitConfig loads the config from configPath, a single file or a
+// comma-separated list of files where later files override earlier ones. A
+// directory in the list stands for the *.toml files in it, in name order.
 func InitConfig(configPath string) {
-	configFile := determineConfigFile(configPath)
-	setupViper(configFile)
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	var configFile string
+	configPaths = SplitConfigPaths(configPath)
+	configDirs = nil
+	for _, path := range configPaths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			configDirs = append(configDirs, path)
+		}
+	}
+
+	files, err := ExpandConfigPaths(configPaths)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error reading config directory")
+	}
+	if len(files) > 0 {
+		configFile = files[0]
+		extraConfigFiles = files[1:]
+	} else {
+		extraConfigFiles = nil
+	}
+	configFile = determineConfigFile(configFile)
+
+	if _, err := os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
+		log.Info().Msgf("Config file %s not found, using environment variables and defaults only", configFile)
+		if len(extraConfigFiles) > 0 {
+			log.Warn().Msgf("Ignoring additional config files without a base config: %s", strings.Join(extraConfigFiles, ", "))
+		}
+		setupViper("")
+		readAndUnmarshalConfig()
+		return
+	}
+
+	setupViper(configFile, extraConfigFiles...)
 	readAndUnmarshalConfig()
 	watchConfigChanges()
 }
 
-func setupViper(configFile string) {
+// setupViper registers defaults and environment handling, then reads
+// configFile and merges extraFiles over it. An empty configFile skips
+// reading files entirely.
+func setupViper(configFile string, extraFiles ...string) {
+	viper.SetDefault("server.host", "127.0.0.1")
+	viper.SetDefault("authorization.replay_window", "0s")
+	viper.SetDefault("server.port", 42135)
+	viper.SetDefault("server.max_hooks", 0)
+	viper.SetDefault("server.collect_all_reasons", false)
+	viper.SetDefault("server.strict_request", false)
+	viper.SetDefault("server.reject_headers", true)
+	viper.SetDefault("server.quiet_rejections", false)
+	viper.SetDefault("server.include_release", false)
+	viper.SetDefault("server.maintenance", false)
+	viper.SetDefault("server.allowed_ips", []string{})
+	viper.SetDefault("server.trusted_proxies", []string{})
+	viper.SetDefault("server.success_status", http.StatusOK)
+	viper.SetDefault("logs.loglevel", "info")
+	viper.SetDefault("logs.output", "")
+	viper.SetDefault("logs.logfilepath", "redactedhook.log")
+	viper.SetDefault("logs.maxsize", 100)
+	viper.SetDefault("logs.maxbackups", 3)
+	viper.SetDefault("logs.maxage", 28)
+	viper.SetDefault("api.timeout", "10s")
+	viper.SetDefault("api.jitter", "0s")
+	viper.SetDefault("api.ratelimit_mode", RateLimitWait)
+	viper.SetDefault("api.max_concurrent_per_indexer", 0)
+	viper.SetDefault("api.expose_upstream_errors", false)
+	viper.SetDefault("api.auth_scheme", "")
+	viper.SetDefault("api.allow_api_base_override", false)
+	viper.SetDefault("api.limiter_log_interval", "0s")
+	viper.SetDefault("api.min_refetch_interval", "0s")
+	viper.SetDefault("api.degraded_after", "1h")
+	viper.SetDefault("decision_webhook.url", "")
+	viper.SetDefault("decision_webhook.timeout", "5s")
+	viper.SetDefault("analytics.sqlite_path", "")
+	viper.SetDefault("integrations.qbittorrent.url", "")
+	viper.SetDefault("integrations.qbittorrent.username", "")
+	viper.SetDefault("integrations.qbittorrent.password", "")
+	viper.SetDefault("api.max_response_size", "16MB")
+	viper.SetDefault("mock.enabled", false)
+	viper.SetDefault("mock.fixtures_dir", "fixtures")
 	viper.SetDefault("userid.red_user_id", 0)
 	viper.SetDefault("userid.ops_user_id", 0)
 	viper.SetDefault("ratio.minratio", 0)
+	viper.SetDefault("ratio.minuploaded", "")
+	viper.SetDefault("ratio.respect_required_ratio", false)
+	viper.SetDefault("ratio.skip_ratio_on_freeleech", false)
+	viper.SetDefault("ratio.epsilon", DefaultRatioEpsilon)
+	viper.SetDefault("ratio.poll_interval", "0s")
 	viper.SetDefault("sizecheck.minsize", "")
 	viper.SetDefault("sizecheck.maxsize", "")
+	viper.SetDefault("sizecheck.download_path", "")
+	viper.SetDefault("sizecheck.min_free", "")
+	viper.SetDefault("quota.max_size", "")
+	viper.SetDefault("quota.window", "24h")
+	viper.SetDefault("schedule.allow_windows", []string{})
+	viper.SetDefault("indexer_keys.red_apikeys", []string{})
+	viper.SetDefault("schedule.timezone", "")
+	viper.SetDefault("score.enabled", false)
+	viper.SetDefault("score.threshold", 0)
+	viper.SetDefault("leechers.minleechers", 0)
+	viper.SetDefault("leechers.maxleechers", 0)
+	viper.SetDefault("seeders.min_seeders_or_freeleech", 0)
+	viper.SetDefault("artists.minartists", 0)
+	viper.SetDefault("artists.maxartists", 0)
+	viper.SetDefault("tracks.mintracks", 0)
+	viper.SetDefault("tracks.maxtracks", 0)
+	viper.SetDefault("tracks.maxfiles", 0)
+	viper.SetDefault("bitrate.minbitrate", 0)
+	viper.SetDefault("bitrate.min_avg_bitrate", 0)
+	viper.SetDefault("bitrate.max_avg_bitrate", 0)
+	viper.SetDefault("bitrate.lossless_only", false)
+	viper.SetDefault("filters.reject_reported", false)
+	viper.SetDefault("filters.reject_vanity_house", false)
+	viper.SetDefault("filters.require_verified_log", false)
+	viper.SetDefault("filters.require_ripper", "")
+	viper.SetDefault("filters.cue_log_consistent", false)
+	viper.SetDefault("filters.require_artwork", false)
+	viper.SetDefault("filters.require_featured", false)
+	viper.SetDefault("filters.skip_already_snatched", false)
+	viper.SetDefault("filters.neutral_leech_only", false)
+	viper.SetDefault("filters.glob", false)
+	viper.SetDefault("filters.preset", "")
+	viper.SetDefault("filters.description_contains", "")
+	viper.SetDefault("filters.description_excludes", "")
+	viper.SetDefault("filters.lineage_contains", "")
+	viper.SetDefault("filters.lineage_excludes", "")
+	viper.SetDefault("filters.ops_require_flags", "")
+	viper.SetDefault("filters.torrent_name_mode", TorrentNameWarn)
+	viper.SetDefault("filters.allow_mbids", "")
+	viper.SetDefault("filters.allow_countries", "")
+	viper.SetDefault("filters.name_source_allow", "")
+	viper.SetDefault("filters.name_source_deny", "")
+	viper.SetDefault("filters.token_eligible", false)
+	viper.SetDefault("filters.token_min_size", "")
+	viper.SetDefault("filters.require_complete_metadata", []string{})
 	viper.SetDefault("uploaders.uploaders", "")
 	viper.SetDefault("uploaders.mode", "")
+	viper.SetDefault("uploaders.match_on", MatchOnUploader)
 	viper.SetDefault("record_labels.record_labels", "")
+	viper.SetDefault("record_labels.allow_labels", "")
+	viper.SetDefault("record_labels.block_labels", "")
+	viper.SetDefault("record_labels.block_catalogue_prefixes", "")
 
 	viper.SetConfigType("toml")
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix(EnvPrefix[:len(EnvPrefix)-2])
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AllowEmptyEnv(true)
+
+	if configFile == "" {
+		return
+	}
 	viper.SetConfigFile(configFile)
 
+	if err := readConfigFiles(configFile, extraFiles...); err != nil {
+		log.Fatal().Err(err).Msg("Error reading config file")
+	}
+}
+
+// readConfigFiles reads the base config file, merges extraFiles over it in
+// order and, when REDACTEDHOOK__PROFILE is set, merges config.<profile>.toml
+// from the base file's directory last. Environment variables are expanded in
+// every file.
+func readConfigFiles(configFile string, extraFiles ...string) error {
 	configContent, err := os.ReadFile(configFile)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error reading config file")
+		return err
 	}
 
-	expandedConfig := os.ExpandEnv(string(configContent))
+	if err := viper.ReadConfig(strings.NewReader(os.ExpandEnv(string(configContent)))); err != nil {
+		return err
+	}
 
-	if err := viper.ReadConfig(strings.NewReader(expandedConfig)); err != nil {
-		log.Fatal().Err(err).Msg("Error reading config file")
+	for _, extraFile := range extraFiles {
+		extraContent, err := os.ReadFile(extraFile)
+		if err != nil {
+			return err
+		}
+		if err := viper.MergeConfig(strings.NewReader(os.ExpandEnv(string(extraContent)))); err != nil {
+			return fmt.Errorf("%s: %w", extraFile, err)
+		}
+		log.Debug().Msgf("Config file merged: %s", extraFile)
+	}
+
+	profile := os.Getenv(EnvPrefix + "PROFILE")
+	if profile == "" {
+		return nil
 	}
+
+	profileFile := profileConfigFile(configFile, profile)
+	profileContent, err := os.ReadFile(profileFile)
+	if err != nil {
+		return fmt.Errorf("profile %q: %w", profile, err)
+	}
+
+	if err := viper.MergeConfig(strings.NewReader(os.ExpandEnv(string(profileContent)))); err != nil {
+		return fmt.Errorf("profile %q: %w", profile, err)
+	}
+
+	log.Debug().Msgf("Config profile %s merged from %s", profile, profileFile)
+	return nil
+}
+
+func profileConfigFile(configFile, profile string) string {
+	ext := filepath.Ext(configFile)
+	base := strings.TrimSuffix(filepath.Base(configFile), ext)
+	return filepath.Join(filepath.Dir(configFile), fmt.Sprintf("%s.%s%s", base, profile, ext))
 }
 
 func readAndUnmarshalConfig() {
-	if err := viper.Unmarshal(&config); err != nil {
+	newConfig, err := unmarshalConfig(GetConfig())
+	if err != nil {
 		log.Error().Err(err).Msg("Unable to unmarshal config")
-	} else {
-		parseSizeCheck()
-		log.Debug().Msgf("Config file read: %s", viper.ConfigFileUsed())
-		configureLogger()
+		return
+	}
+
+	current.Store(newConfig)
+	if configFile := viper.ConfigFileUsed(); configFile != "" {
+		log.Debug().Msgf("Config file read: %s", configFile)
 	}
+	configureLogger()
 }
 
-func parseSizeCheck() {
-	minSizeStr := viper.GetString("sizecheck.minsize")
-	if minSizeStr == "" {
-		config.ParsedSizes.MinSize = 0
-	} else {
-		if minSize, err := bytesize.Parse(minSizeStr); err != nil {
-			log.Error().Err(err).Msg("Invalid format for MinSize; unable to parse")
-		} else {
-			config.ParsedSizes.MinSize = minSize
-		}
+// unmarshalConfig decodes the current viper state into a new Config, leaving
+// the active snapshot untouched. Sizes that fail to parse keep their value
+// from previous.
+func unmarshalConfig(previous *Config) (*Config, error) {
+	newConfig := &Config{}
+	if err := viper.Unmarshal(newConfig); err != nil {
+		return nil, err
 	}
 
-	maxSizeStr := viper.GetString("sizecheck.maxsize")
-	if maxSizeStr == "" {
-		config.ParsedSizes.MaxSize = 0
-	} else {
-		if maxSize, err := bytesize.Parse(maxSizeStr); err != nil {
-			log.Error().Err(err).Msg("Invalid format for MaxSize; unable to parse")
-		} else {
-			config.ParsedSizes.MaxSize = maxSize
-		}
+	parseSizeCheck(newConfig, previous)
+
+	brackets, err := ParseRatioBrackets(newConfig.Ratio.Brackets)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid ratio brackets; keeping the previous ones")
+		brackets = previous.RatioBrackets
+	}
+	newConfig.RatioBrackets = brackets
+
+	if newConfig.ParsedSchedule, err = ParseSchedule(newConfig.Schedule); err != nil {
+		log.Error().Err(err).Msg("Invalid schedule; keeping the previous one")
+		newConfig.ParsedSchedule = previous.ParsedSchedule
+	}
+
+	if newConfig.AllowedIPs, err = ParseIPPrefixes(newConfig.Server.AllowedIPs); err != nil {
+		log.Error().Err(err).Msg("Invalid allowed_ips; keeping the previous ones")
+		newConfig.AllowedIPs = previous.AllowedIPs
+	}
+	if newConfig.TrustedProxies, err = ParseIPPrefixes(newConfig.Server.TrustedProxies); err != nil {
+		log.Error().Err(err).Msg("Invalid trusted_proxies; keeping the previous ones")
+		newConfig.TrustedProxies = previous.TrustedProxies
+	}
+
+	applyEnvironment(newConfig)
+	return newConfig, nil
+}
+
+// applyEnvironment applies the REDACTEDHOOK__* overrides to cfg. It runs on
+// every unmarshal, so the overrides survive reloads of the config files.
+func applyEnvironment(cfg *Config) {
+	cfg.Server.Host = envString("HOST", cfg.Server.Host)
+	cfg.Server.Port = envInt("PORT", cfg.Server.Port)
+
+	cfg.Authorization.APIToken = envString("API_TOKEN", cfg.Authorization.APIToken)
+	cfg.IndexerKeys.REDKey = envString("RED_APIKEY", cfg.IndexerKeys.REDKey)
+	cfg.IndexerKeys.OPSKey = envString("OPS_APIKEY", cfg.IndexerKeys.OPSKey)
+
+	cfg.Logs.LogLevel = envString("LOGS_LOGLEVEL", cfg.Logs.LogLevel)
+	cfg.Logs.Output = envString("LOGS_OUTPUT", cfg.Logs.Output)
+	cfg.Logs.LogToFile = envBool("LOGS_LOGTOFILE", cfg.Logs.LogToFile)
+	cfg.Logs.LogFilePath = envString("LOGS_LOGFILEPATH", cfg.Logs.LogFilePath)
+	cfg.Logs.MaxSize = envInt("LOGS_MAXSIZE", cfg.Logs.MaxSize)
+	cfg.Logs.MaxBackups = envInt("LOGS_MAXBACKUPS", cfg.Logs.MaxBackups)
+	cfg.Logs.MaxAge = envInt("LOGS_MAXAGE", cfg.Logs.MaxAge)
+	cfg.Logs.Compress = envBool("LOGS_COMPRESS", cfg.Logs.Compress)
+}
+
+func envString(key, current string) string {
+	if value, exists := os.LookupEnv(EnvPrefix + key); exists {
+		return value
+	}
+	return current
+}
+
+func envInt(key string, current int) int {
+	value, exists := os.LookupEnv(EnvPrefix + key)
+	if !exists {
+		return current
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Warn().Msgf("Invalid %s value: %s", key, value)
+		return current
+	}
+	return n
+}
+
+func envBool(key string, current bool) bool {
+	if value, exists := os.LookupEnv(EnvPrefix + key); exists {
+		return value == "true"
+	}
+	return current
+}
+
+func parseSizeCheck(newConfig, previous *Config) {
+	newConfig.ParsedSizes.MinSize = parseByteSizeSetting("sizecheck.minsize", "MinSize", previous.ParsedSizes.MinSize)
+	newConfig.ParsedSizes.MaxSize = parseByteSizeSetting("sizecheck.maxsize", "MaxSize", previous.ParsedSizes.MaxSize)
+	newConfig.ParsedSizes.MinUploaded = parseByteSizeSetting("ratio.minuploaded", "MinUploaded", previous.ParsedSizes.MinUploaded)
+	newConfig.ParsedSizes.MinFree = parseByteSizeSetting("sizecheck.min_free", "MinFree", previous.ParsedSizes.MinFree)
+	newConfig.ParsedSizes.TokenMinSize = parseByteSizeSetting("filters.token_min_size", "TokenMinSize", previous.ParsedSizes.TokenMinSize)
+	newConfig.ParsedSizes.QuotaMaxSize = parseByteSizeSetting("quota.max_size", "QuotaMaxSize", previous.ParsedSizes.QuotaMaxSize)
+	newConfig.ParsedSizes.MaxResponseSize = parseByteSizeSetting("api.max_response_size", "MaxResponseSize", previous.ParsedSizes.MaxResponseSize)
+}
+
+// parseByteSizeSetting parses the size stored under key, keeping the current
+// value if it cannot be parsed.
+func parseByteSizeSetting(key, name string, current bytesize.ByteSize) bytesize.ByteSize {
+	sizeStr := viper.GetString(key)
+	if sizeStr == "" {
+		return 0
+	}
+
+	size, err := ParseByteSize(sizeStr)
+	if err != nil {
+		log.Error().Err(err).Msgf("Invalid format for %s; unable to parse", name)
+		return current
 	}
+	return size
 }
 
+// ParseByteSize parses sizes like "100MB" or "500 GiB". Sizes are always
+// binary, so IEC suffixes (KiB, MiB, GiB, ...) are accepted as aliases.
+func ParseByteSize(s string) (bytesize.ByteSize, error) {
+	trimmed := strings.TrimSpace(s)
+	if len(trimmed) > 3 && strings.EqualFold(trimmed[len(trimmed)-2:], "ib") {
+		trimmed = trimmed[:len(trimmed)-2] + "B"
+	}
+	return bytesize.Parse(trimmed)
+}
+
+// reloadDebounce is how long a config change waits for further changes
+// before the config is reloaded. One save in an editor often fires several
+// events, on both watchers.
+const reloadDebounce = 100 * time.Millisecond
+
+// reloadLock serializes reloads, as viper can't read the config from two
+// goroutines at once. reloadTimer is the pending debounced reload, guarded by
+// reloadTimerLock.
+var (
+	reloadLock      sync.Mutex
+	reloadTimerLock sync.Mutex
+	reloadTimer     *time.Timer
+)
+
 func watchConfigChanges() {
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
+		scheduleConfigChange(e)
+	})
+
+	if len(extraConfigFiles) > 0 || len(configDirs) > 0 {
+		go watchExtraConfigFiles(extraConfigFiles, configDirs)
+	}
+}
+
+// watchExtraConfigFiles reloads the config when one of files changes, or when
+// a .toml file is added to, changed in or removed from one of dirs. Like
+// viper, it watches the parent directories so files replaced by editors or
+// Kubernetes config maps are picked up too.
+func watchExtraConfigFiles(files, dirs []string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to watch additional config files")
+		return
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool, len(files))
+	for _, file := range files {
+		file = filepath.Clean(file)
+		watched[file] = true
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			log.Error().Err(err).Msgf("Failed to watch config file %s", file)
+		}
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			log.Error().Err(err).Msgf("Failed to watch config directory %s", dir)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Clean(event.Name)
+			switch {
+			case isConfigDir(dirs, filepath.Dir(name)) && filepath.Ext(name) == ".toml":
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+					scheduleConfigChange(event)
+				}
+			case watched[name] && event.Op&(fsnotify.Write|fsnotify.Create) != 0:
+				scheduleConfigChange(event)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("Error watching additional config files")
+		}
+	}
+}
+
+// scheduleConfigChange reloads the config once no further change came in for
+// reloadDebounce, so a burst of events causes a single reload.
+func scheduleConfigChange(e fsnotify.Event) {
+	reloadTimerLock.Lock()
+	defer reloadTimerLock.Unlock()
+
+	if reloadTimer != nil {
+		reloadTimer.Stop()
+	}
+	reloadTimer = time.AfterFunc(reloadDebounce, func() {
 		handleConfigChange(e)
 	})
 }
 
 func handleConfigChange(e fsnotify.Event) {
-	oldConfig := config
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	oldConfig := GetConfig()
 
-	if err := viper.ReadInConfig(); err != nil {
+	if len(configDirs) > 0 {
+		rescanConfigDirs()
+	}
+	if err := readConfigFiles(viper.ConfigFileUsed(), extraConfigFiles...); err != nil {
 		log.Error().Err(err).Msg("Error reading config")
 		return
 	}
-	if err := viper.Unmarshal(&config); err != nil {
+	newConfig, err := unmarshalConfig(oldConfig)
+	if err != nil {
 		log.Error().Err(err).Msg("Error unmarshalling config")
 		return
 	}
 
-	parseSizeCheck()
-	logConfigChanges(oldConfig, config)
+	current.Store(newConfig)
+	logConfigChanges(*oldConfig, *newConfig)
 
-	if oldConfig.Logs.LogLevel != config.Logs.LogLevel {
+	if oldConfig.Logs.LogLevel != newConfig.Logs.LogLevel || logOutput(oldConfig.Logs) != logOutput(newConfig.Logs) {
 		configureLogger()
 	}
 	log.Debug().Msgf("Config file updated: %s", e.Name)
 }
 
+// rescanConfigDirs expands --config again so the files merged over the base
+// config follow the current contents of the config directories. The base
+// config file stays the one read at startup while it exists. When it is
+// removed, the first remaining file takes its place. The caller holds
+// reloadLock.
+func rescanConfigDirs() {
+	files, err := ExpandConfigPaths(configPaths)
+	if err != nil {
+		log.Error().Err(err).Msg("Error rescanning config directories")
+		return
+	}
+
+	base := viper.ConfigFileUsed()
+	if _, err := os.Stat(base); err != nil {
+		for _, file := range files {
+			if _, err := os.Stat(file); err == nil {
+				log.Warn().Msgf("Base config file %s is gone, using %s instead", base, file)
+				base = file
+				viper.SetConfigFile(base)
+				break
+			}
+		}
+	}
+
+	extra := make([]string, 0, len(files))
+	for _, file := range files {
+		if file != base {
+			extra = append(extra, file)
+		}
+	}
+	extraConfigFiles = extra
+}
+
 func logConfigChanges(oldConfig, newConfig Config) {
+	if oldConfig.Authorization.ReplayWindow != newConfig.Authorization.ReplayWindow {
+		log.Debug().Msgf("Replay window changed from %s to %s", oldConfig.Authorization.ReplayWindow, newConfig.Authorization.ReplayWindow)
+	}
 	if oldConfig.Server.Host != newConfig.Server.Host {
 		log.Debug().Msgf("Server host changed from %s to %s", oldConfig.Server.Host, newConfig.Server.Host)
 	}
+	if oldConfig.Server.SuccessStatus != newConfig.Server.SuccessStatus {
+		log.Debug().Msgf("Success status changed from %d to %d", oldConfig.Server.SuccessStatus, newConfig.Server.SuccessStatus)
+	}
+	if oldConfig.Server.DefaultIndexer != newConfig.Server.DefaultIndexer {
+		log.Debug().Msgf("Default indexer changed from %s to %s", oldConfig.Server.DefaultIndexer, newConfig.Server.DefaultIndexer)
+	}
+	if oldConfig.Server.MaxHooks != newConfig.Server.MaxHooks {
+		log.Debug().Msgf("Max hooks changed from %d to %d", oldConfig.Server.MaxHooks, newConfig.Server.MaxHooks)
+	}
+	if oldConfig.Server.CollectAllReasons != newConfig.Server.CollectAllReasons {
+		log.Debug().Msgf("CollectAllReasons changed from %t to %t", oldConfig.Server.CollectAllReasons, newConfig.Server.CollectAllReasons)
+	}
+	if oldConfig.Server.StrictRequest != newConfig.Server.StrictRequest {
+		log.Debug().Msgf("StrictRequest changed from %t to %t", oldConfig.Server.StrictRequest, newConfig.Server.StrictRequest)
+	}
+	if oldConfig.Server.RejectHeaders != newConfig.Server.RejectHeaders {
+		log.Debug().Msgf("RejectHeaders changed from %t to %t", oldConfig.Server.RejectHeaders, newConfig.Server.RejectHeaders)
+	}
+	if oldConfig.Server.QuietRejections != newConfig.Server.QuietRejections {
+		log.Debug().Msgf("QuietRejections changed from %t to %t", oldConfig.Server.QuietRejections, newConfig.Server.QuietRejections)
+	}
+	if oldConfig.Server.IncludeRelease != newConfig.Server.IncludeRelease {
+		log.Debug().Msgf("IncludeRelease changed from %t to %t", oldConfig.Server.IncludeRelease, newConfig.Server.IncludeRelease)
+	}
+	if oldConfig.Server.Maintenance != newConfig.Server.Maintenance {
+		log.Info().Msgf("Maintenance mode changed from %t to %t", oldConfig.Server.Maintenance, newConfig.Server.Maintenance)
+	}
+	if !slices.Equal(oldConfig.AllowedIPs, newConfig.AllowedIPs) {
+		log.Info().Msgf("Allowed IPs changed from %v to %v", oldConfig.AllowedIPs, newConfig.AllowedIPs)
+	}
+	if !slices.Equal(oldConfig.TrustedProxies, newConfig.TrustedProxies) {
+		log.Debug().Msgf("Trusted proxies changed from %v to %v", oldConfig.TrustedProxies, newConfig.TrustedProxies)
+	}
+	if oldConfig.API.Timeout != newConfig.API.Timeout {
+		log.Debug().Msgf("API timeout changed from %s to %s", oldConfig.API.Timeout, newConfig.API.Timeout)
+	}
+	if oldConfig.API.Jitter != newConfig.API.Jitter {
+		log.Debug().Msgf("API jitter changed from %s to %s", oldConfig.API.Jitter, newConfig.API.Jitter)
+	}
+	if oldConfig.ParsedSizes.MaxResponseSize != newConfig.ParsedSizes.MaxResponseSize {
+		log.Debug().Msgf("API max response size changed from %s to %s", oldConfig.ParsedSizes.MaxResponseSize, newConfig.ParsedSizes.MaxResponseSize)
+	}
+	if oldConfig.DecisionWebhook.URL != newConfig.DecisionWebhook.URL {
+		log.Debug().Msg("Decision webhook URL changed")
+	}
+	if oldConfig.DecisionWebhook.Timeout != newConfig.DecisionWebhook.Timeout {
+		log.Debug().Msgf("Decision webhook timeout changed from %s to %s", oldConfig.DecisionWebhook.Timeout, newConfig.DecisionWebhook.Timeout)
+	}
+	if oldConfig.Integrations.QBittorrent != newConfig.Integrations.QBittorrent {
+		log.Debug().Msg("qBittorrent integration settings changed")
+	}
+
+	if oldConfig.API.MaxConcurrentPerIndexer != newConfig.API.MaxConcurrentPerIndexer {
+		log.Debug().Msgf("Max concurrent API calls per indexer changed from %d to %d", oldConfig.API.MaxConcurrentPerIndexer, newConfig.API.MaxConcurrentPerIndexer)
+	}
+	if oldConfig.API.ExposeUpstreamErrors != newConfig.API.ExposeUpstreamErrors {
+		log.Debug().Msgf("ExposeUpstreamErrors changed from %t to %t", oldConfig.API.ExposeUpstreamErrors, newConfig.API.ExposeUpstreamErrors)
+	}
+	if oldConfig.API.AuthScheme != newConfig.API.AuthScheme {
+		log.Debug().Msgf("Auth scheme changed from %q to %q", oldConfig.API.AuthScheme, newConfig.API.AuthScheme)
+	}
+	if oldConfig.API.DegradedAfter != newConfig.API.DegradedAfter {
+		log.Debug().Msgf("Degraded after changed from %s to %s", oldConfig.API.DegradedAfter, newConfig.API.DegradedAfter)
+	}
+	if oldConfig.API.AllowAPIBaseOverride != newConfig.API.AllowAPIBaseOverride {
+		log.Debug().Msgf("AllowAPIBaseOverride changed from %t to %t", oldConfig.API.AllowAPIBaseOverride, newConfig.API.AllowAPIBaseOverride)
+	}
+	if oldConfig.API.LimiterLogInterval != newConfig.API.LimiterLogInterval {
+		log.Debug().Msgf("Limiter log interval changed from %s to %s, takes effect after a restart", oldConfig.API.LimiterLogInterval, newConfig.API.LimiterLogInterval)
+	}
+	if oldConfig.API.MinRefetchInterval != newConfig.API.MinRefetchInterval {
+		log.Debug().Msgf("Min refetch interval changed from %s to %s", oldConfig.API.MinRefetchInterval, newConfig.API.MinRefetchInterval)
+	}
+	if oldConfig.API.RateLimitMode != newConfig.API.RateLimitMode {
+		log.Debug().Msgf("Rate limit mode changed from %s to %s", oldConfig.API.RateLimitMode, newConfig.API.RateLimitMode)
+	}
+
+	if oldConfig.Mock.Enabled != newConfig.Mock.Enabled {
+		log.Debug().Msgf("Mock indexer enabled changed from %t to %t", oldConfig.Mock.Enabled, newConfig.Mock.Enabled)
+	}
+	if oldConfig.Mock.FixturesDir != newConfig.Mock.FixturesDir {
+		log.Debug().Msgf("Mock fixtures dir changed from %s to %s", oldConfig.Mock.FixturesDir, newConfig.Mock.FixturesDir)
+	}
 	if oldConfig.IndexerKeys.REDKey != newConfig.IndexerKeys.REDKey {
 		log.Debug().Msg("red_apikey changed")
 	}
 	if oldConfig.IndexerKeys.OPSKey != newConfig.IndexerKeys.OPSKey {
 		log.Debug().Msg("ops_apikey changed")
 	}
+	if strings.Join(oldConfig.IndexerKeys.REDKeys, ",") != strings.Join(newConfig.IndexerKeys.REDKeys, ",") {
+		log.Debug().Msgf("red_apikeys changed, %d keys", len(newConfig.IndexerKeys.REDKeys))
+	}
 
 	if oldConfig.UserIDs.REDUserID != newConfig.UserIDs.REDUserID {
 		log.Debug().Msgf("REDUserID changed from %d to %d", oldConfig.UserIDs.REDUserID, newConfig.UserIDs.REDUserID)
@@ -133,6 +642,22 @@ func logConfigChanges(oldConfig, newConfig Config) {
 	if oldConfig.Ratio.MinRatio != newConfig.Ratio.MinRatio {
 		log.Debug().Msgf("MinRatio changed from %f to %f", oldConfig.Ratio.MinRatio, newConfig.Ratio.MinRatio)
 	}
+	if oldConfig.Ratio.RespectRequiredRatio != newConfig.Ratio.RespectRequiredRatio {
+		log.Debug().Msgf("RespectRequiredRatio changed from %t to %t", oldConfig.Ratio.RespectRequiredRatio, newConfig.Ratio.RespectRequiredRatio)
+	}
+	if oldConfig.Ratio.Epsilon != newConfig.Ratio.Epsilon {
+		log.Debug().Msgf("Ratio epsilon changed from %g to %g", oldConfig.Ratio.Epsilon, newConfig.Ratio.Epsilon)
+	}
+	if oldConfig.Ratio.SkipRatioOnFreeleech != newConfig.Ratio.SkipRatioOnFreeleech {
+		log.Debug().Msgf("SkipRatioOnFreeleech changed from %t to %t", oldConfig.Ratio.SkipRatioOnFreeleech, newConfig.Ratio.SkipRatioOnFreeleech)
+	}
+	if !slices.Equal(oldConfig.RatioBrackets, newConfig.RatioBrackets) {
+		log.Debug().Msgf("Ratio brackets changed from %v to %v", oldConfig.RatioBrackets, newConfig.RatioBrackets)
+	}
+
+	if oldConfig.ParsedSizes.MinUploaded != newConfig.ParsedSizes.MinUploaded {
+		log.Debug().Msgf("MinUploaded changed from %s to %s", oldConfig.ParsedSizes.MinUploaded, newConfig.ParsedSizes.MinUploaded)
+	}
 
 	if oldConfig.ParsedSizes.MinSize != newConfig.ParsedSizes.MinSize {
 		log.Debug().Msgf("MinSize changed from %s to %s", oldConfig.ParsedSizes.MinSize, newConfig.ParsedSizes.MinSize)
@@ -142,16 +667,170 @@ func logConfigChanges(oldConfig, newConfig Config) {
 		log.Debug().Msgf("MaxSize changed from %s to %s", oldConfig.ParsedSizes.MaxSize, newConfig.ParsedSizes.MaxSize)
 	}
 
+	if oldConfig.SizeCheck.DownloadPath != newConfig.SizeCheck.DownloadPath {
+		log.Debug().Msgf("Download path changed from %s to %s", oldConfig.SizeCheck.DownloadPath, newConfig.SizeCheck.DownloadPath)
+	}
+	if oldConfig.ParsedSizes.MinFree != newConfig.ParsedSizes.MinFree {
+		log.Debug().Msgf("MinFree changed from %s to %s", oldConfig.ParsedSizes.MinFree, newConfig.ParsedSizes.MinFree)
+	}
+	if oldConfig.ParsedSizes.QuotaMaxSize != newConfig.ParsedSizes.QuotaMaxSize {
+		log.Debug().Msgf("Quota max size changed from %s to %s", oldConfig.ParsedSizes.QuotaMaxSize, newConfig.ParsedSizes.QuotaMaxSize)
+	}
+	if oldConfig.Quota.Window != newConfig.Quota.Window {
+		log.Debug().Msgf("Quota window changed from %s to %s", oldConfig.Quota.Window, newConfig.Quota.Window)
+	}
+	if strings.Join(oldConfig.Schedule.AllowWindows, ",") != strings.Join(newConfig.Schedule.AllowWindows, ",") {
+		log.Debug().Msgf("Schedule windows changed from [%s] to [%s]", strings.Join(oldConfig.Schedule.AllowWindows, ", "), strings.Join(newConfig.Schedule.AllowWindows, ", "))
+	}
+	if oldConfig.Schedule.Timezone != newConfig.Schedule.Timezone {
+		log.Debug().Msgf("Schedule timezone changed from %s to %s", oldConfig.Schedule.Timezone, newConfig.Schedule.Timezone)
+	}
+	if oldConfig.Score.Enabled != newConfig.Score.Enabled {
+		log.Debug().Msgf("Score mode changed from %t to %t", oldConfig.Score.Enabled, newConfig.Score.Enabled)
+	}
+	if oldConfig.Score.Threshold != newConfig.Score.Threshold {
+		log.Debug().Msgf("Score threshold changed from %g to %g", oldConfig.Score.Threshold, newConfig.Score.Threshold)
+	}
+
+	if oldConfig.Leechers.MinLeechers != newConfig.Leechers.MinLeechers {
+		log.Debug().Msgf("MinLeechers changed from %d to %d", oldConfig.Leechers.MinLeechers, newConfig.Leechers.MinLeechers)
+	}
+	if oldConfig.Leechers.MaxLeechers != newConfig.Leechers.MaxLeechers {
+		log.Debug().Msgf("MaxLeechers changed from %d to %d", oldConfig.Leechers.MaxLeechers, newConfig.Leechers.MaxLeechers)
+	}
+	if oldConfig.Seeders.MinSeedersOrFreeleech != newConfig.Seeders.MinSeedersOrFreeleech {
+		log.Debug().Msgf("MinSeedersOrFreeleech changed from %d to %d", oldConfig.Seeders.MinSeedersOrFreeleech, newConfig.Seeders.MinSeedersOrFreeleech)
+	}
+
+	if oldConfig.Artists.MinArtists != newConfig.Artists.MinArtists {
+		log.Debug().Msgf("MinArtists changed from %d to %d", oldConfig.Artists.MinArtists, newConfig.Artists.MinArtists)
+	}
+	if oldConfig.Artists.MaxArtists != newConfig.Artists.MaxArtists {
+		log.Debug().Msgf("MaxArtists changed from %d to %d", oldConfig.Artists.MaxArtists, newConfig.Artists.MaxArtists)
+	}
+
+	if oldConfig.Tracks.MinTracks != newConfig.Tracks.MinTracks {
+		log.Debug().Msgf("MinTracks changed from %d to %d", oldConfig.Tracks.MinTracks, newConfig.Tracks.MinTracks)
+	}
+	if oldConfig.Tracks.MaxTracks != newConfig.Tracks.MaxTracks {
+		log.Debug().Msgf("MaxTracks changed from %d to %d", oldConfig.Tracks.MaxTracks, newConfig.Tracks.MaxTracks)
+	}
+	if oldConfig.Tracks.MaxFiles != newConfig.Tracks.MaxFiles {
+		log.Debug().Msgf("MaxFiles changed from %d to %d", oldConfig.Tracks.MaxFiles, newConfig.Tracks.MaxFiles)
+	}
+
+	if oldConfig.Bitrate.MinBitrate != newConfig.Bitrate.MinBitrate {
+		log.Debug().Msgf("MinBitrate changed from %d to %d", oldConfig.Bitrate.MinBitrate, newConfig.Bitrate.MinBitrate)
+	}
+	if oldConfig.Bitrate.MinAvgBitrate != newConfig.Bitrate.MinAvgBitrate {
+		log.Debug().Msgf("MinAvgBitrate changed from %d to %d", oldConfig.Bitrate.MinAvgBitrate, newConfig.Bitrate.MinAvgBitrate)
+	}
+	if oldConfig.Bitrate.MaxAvgBitrate != newConfig.Bitrate.MaxAvgBitrate {
+		log.Debug().Msgf("MaxAvgBitrate changed from %d to %d", oldConfig.Bitrate.MaxAvgBitrate, newConfig.Bitrate.MaxAvgBitrate)
+	}
+	if oldConfig.Bitrate.LosslessOnly != newConfig.Bitrate.LosslessOnly {
+		log.Debug().Msgf("LosslessOnly changed from %t to %t", oldConfig.Bitrate.LosslessOnly, newConfig.Bitrate.LosslessOnly)
+	}
+
+	if oldConfig.Filters.RejectReported != newConfig.Filters.RejectReported {
+		log.Debug().Msgf("RejectReported changed from %t to %t", oldConfig.Filters.RejectReported, newConfig.Filters.RejectReported)
+	}
+
+	if oldConfig.Filters.RejectVanityHouse != newConfig.Filters.RejectVanityHouse {
+		log.Debug().Msgf("RejectVanityHouse changed from %t to %t", oldConfig.Filters.RejectVanityHouse, newConfig.Filters.RejectVanityHouse)
+	}
+	if oldConfig.Filters.RequireVerifiedLog != newConfig.Filters.RequireVerifiedLog {
+		log.Debug().Msgf("RequireVerifiedLog changed from %t to %t", oldConfig.Filters.RequireVerifiedLog, newConfig.Filters.RequireVerifiedLog)
+	}
+	if oldConfig.Filters.RequireRipper != newConfig.Filters.RequireRipper {
+		log.Debug().Msgf("RequireRipper changed from %s to %s", oldConfig.Filters.RequireRipper, newConfig.Filters.RequireRipper)
+	}
+	if oldConfig.Filters.CueLogConsistent != newConfig.Filters.CueLogConsistent {
+		log.Debug().Msgf("CueLogConsistent changed from %t to %t", oldConfig.Filters.CueLogConsistent, newConfig.Filters.CueLogConsistent)
+	}
+	if oldConfig.Filters.RequireArtwork != newConfig.Filters.RequireArtwork {
+		log.Debug().Msgf("RequireArtwork changed from %t to %t", oldConfig.Filters.RequireArtwork, newConfig.Filters.RequireArtwork)
+	}
+	if oldConfig.Filters.RequireFeatured != newConfig.Filters.RequireFeatured {
+		log.Debug().Msgf("RequireFeatured changed from %t to %t", oldConfig.Filters.RequireFeatured, newConfig.Filters.RequireFeatured)
+		if newConfig.Filters.RequireFeatured && !newConfig.Mock.Enabled {
+			log.Warn().Msg("require_featured is set, but neither redacted nor ops reports featured releases, so every release will be rejected")
+		}
+	}
+	if oldConfig.Filters.SkipAlreadySnatched != newConfig.Filters.SkipAlreadySnatched {
+		log.Debug().Msgf("SkipAlreadySnatched changed from %t to %t", oldConfig.Filters.SkipAlreadySnatched, newConfig.Filters.SkipAlreadySnatched)
+	}
+	if oldConfig.Filters.NeutralLeechOnly != newConfig.Filters.NeutralLeechOnly {
+		log.Debug().Msgf("NeutralLeechOnly changed from %t to %t", oldConfig.Filters.NeutralLeechOnly, newConfig.Filters.NeutralLeechOnly)
+	}
+	if oldConfig.Filters.Glob != newConfig.Filters.Glob {
+		log.Debug().Msgf("Glob changed from %t to %t", oldConfig.Filters.Glob, newConfig.Filters.Glob)
+	}
+
+	if strings.Join(oldConfig.Filters.RequireCompleteMetadata, ",") != strings.Join(newConfig.Filters.RequireCompleteMetadata, ",") {
+		log.Debug().Msgf("RequireCompleteMetadata changed from %v to %v", oldConfig.Filters.RequireCompleteMetadata, newConfig.Filters.RequireCompleteMetadata)
+	}
+
+	if oldConfig.Filters.Preset != newConfig.Filters.Preset {
+		log.Debug().Msgf("Preset changed from %s to %s", oldConfig.Filters.Preset, newConfig.Filters.Preset)
+	}
+	if oldConfig.Filters.DescriptionContains != newConfig.Filters.DescriptionContains {
+		log.Debug().Msgf("DescriptionContains changed from %s to %s", oldConfig.Filters.DescriptionContains, newConfig.Filters.DescriptionContains)
+	}
+	if oldConfig.Filters.DescriptionExcludes != newConfig.Filters.DescriptionExcludes {
+		log.Debug().Msgf("DescriptionExcludes changed from %s to %s", oldConfig.Filters.DescriptionExcludes, newConfig.Filters.DescriptionExcludes)
+	}
+	if oldConfig.Filters.LineageContains != newConfig.Filters.LineageContains {
+		log.Debug().Msgf("LineageContains changed from %s to %s", oldConfig.Filters.LineageContains, newConfig.Filters.LineageContains)
+	}
+	if oldConfig.Filters.LineageExcludes != newConfig.Filters.LineageExcludes {
+		log.Debug().Msgf("LineageExcludes changed from %s to %s", oldConfig.Filters.LineageExcludes, newConfig.Filters.LineageExcludes)
+	}
+	if oldConfig.Filters.OPSRequireFlags != newConfig.Filters.OPSRequireFlags {
+		log.Debug().Msgf("OPSRequireFlags changed from %s to %s", oldConfig.Filters.OPSRequireFlags, newConfig.Filters.OPSRequireFlags)
+	}
+	if oldConfig.Filters.TorrentNameMode != newConfig.Filters.TorrentNameMode {
+		log.Debug().Msgf("TorrentNameMode changed from %s to %s", oldConfig.Filters.TorrentNameMode, newConfig.Filters.TorrentNameMode)
+	}
+	if oldConfig.Filters.AllowMBIDs != newConfig.Filters.AllowMBIDs {
+		log.Debug().Msgf("AllowMBIDs changed from %s to %s", oldConfig.Filters.AllowMBIDs, newConfig.Filters.AllowMBIDs)
+	}
+	if oldConfig.Filters.AllowCountries != newConfig.Filters.AllowCountries {
+		log.Debug().Msgf("AllowCountries changed from %s to %s", oldConfig.Filters.AllowCountries, newConfig.Filters.AllowCountries)
+	}
+	if oldConfig.Filters.NameSourceAllow != newConfig.Filters.NameSourceAllow {
+		log.Debug().Msgf("NameSourceAllow changed from %s to %s", oldConfig.Filters.NameSourceAllow, newConfig.Filters.NameSourceAllow)
+	}
+	if oldConfig.Filters.NameSourceDeny != newConfig.Filters.NameSourceDeny {
+		log.Debug().Msgf("NameSourceDeny changed from %s to %s", oldConfig.Filters.NameSourceDeny, newConfig.Filters.NameSourceDeny)
+	}
+	if oldConfig.Filters.TokenEligible != newConfig.Filters.TokenEligible {
+		log.Debug().Msgf("TokenEligible changed from %t to %t", oldConfig.Filters.TokenEligible, newConfig.Filters.TokenEligible)
+	}
+	if oldConfig.ParsedSizes.TokenMinSize != newConfig.ParsedSizes.TokenMinSize {
+		log.Debug().Msgf("TokenMinSize changed from %s to %s", oldConfig.ParsedSizes.TokenMinSize, newConfig.ParsedSizes.TokenMinSize)
+	}
+
 	if oldConfig.Uploaders.Uploaders != newConfig.Uploaders.Uploaders {
 		log.Debug().Msgf("Uploaders changed from %s to %s", oldConfig.Uploaders.Uploaders, newConfig.Uploaders.Uploaders)
 	}
 	if oldConfig.Uploaders.Mode != newConfig.Uploaders.Mode {
 		log.Debug().Msgf("Uploader mode changed from %s to %s", oldConfig.Uploaders.Mode, newConfig.Uploaders.Mode)
 	}
+	if oldConfig.Uploaders.MatchOn != newConfig.Uploaders.MatchOn {
+		log.Debug().Msgf("Uploader match_on changed from %s to %s", oldConfig.Uploaders.MatchOn, newConfig.Uploaders.MatchOn)
+	}
+
+	if oldConfig.RecordLabels.BlockCataloguePrefixes != newConfig.RecordLabels.BlockCataloguePrefixes {
+		log.Debug().Msgf("BlockCataloguePrefixes changed from %s to %s", oldConfig.RecordLabels.BlockCataloguePrefixes, newConfig.RecordLabels.BlockCataloguePrefixes)
+	}
 
 	if oldConfig.Logs.LogLevel != newConfig.Logs.LogLevel {
 		log.Debug().Msgf("Log level changed from %s to %s", oldConfig.Logs.LogLevel, newConfig.Logs.LogLevel)
 	}
+	if oldConfig.Logs.Output != newConfig.Logs.Output {
+		log.Debug().Msgf("Log output changed from %s to %s", oldConfig.Logs.Output, newConfig.Logs.Output)
+	}
 	if oldConfig.Logs.LogToFile != newConfig.Logs.LogToFile {
 		log.Debug().Msgf("LogToFile changed from %t to %t", oldConfig.Logs.LogToFile, newConfig.Logs.LogToFile)
 	}
@@ -172,6 +851,67 @@ func logConfigChanges(oldConfig, newConfig Config) {
 	}
 }
 
+// validateSizeRange checks that minsize and maxsize in [sizecheck] parse, and
+// that they leave a range a torrent can fall in.
+func validateSizeRange() []string {
+	var validationErrors []string
+	sizes := make(map[string]bytesize.ByteSize)
+	for _, key := range []string{"minsize", "maxsize"} {
+		value := viper.GetString("sizecheck." + key)
+		if value == "" {
+			continue
+		}
+		size, err := ParseByteSize(value)
+		if err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid sizecheck %s '%s': %v", key, value, err))
+			continue
+		}
+		sizes[key] = size
+	}
+
+	minSize, maxSize := sizes["minsize"], sizes["maxsize"]
+	if maxSize > 0 && minSize > maxSize {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid sizecheck: minsize %s is greater than maxsize %s, no torrent could pass", minSize, maxSize))
+	}
+	return validationErrors
+}
+
+// validateStatusCodes checks the status_codes section. Every code must be
+// unique, and either a 2xx other than the success status or a 4xx other than
+// 400 and 401, which already mean an invalid request or token.
+func validateStatusCodes() []string {
+	var validationErrors []string
+
+	successStatus := viper.GetInt("server.success_status")
+	if successStatus == 0 {
+		successStatus = http.StatusOK
+	}
+
+	hooks := make([]string, 0, len(viper.GetStringMap("status_codes")))
+	for hook := range viper.GetStringMap("status_codes") {
+		hooks = append(hooks, hook)
+	}
+	sort.Strings(hooks)
+
+	seen := make(map[int]string, len(hooks))
+	for _, hook := range hooks {
+		status := viper.GetInt("status_codes." + hook)
+		validStatus := (status >= 200 && status <= 299 && status != successStatus) ||
+			(status >= 402 && status <= 499)
+		if !validStatus {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid status code %d for '%s', must be a 2xx other than the success status, or 402-499", status, hook))
+			continue
+		}
+		if other, exists := seen[status]; exists {
+			validationErrors = append(validationErrors, fmt.Sprintf("Status code %d is used for both '%s' and '%s'", status, other, hook))
+			continue
+		}
+		seen[status] = hook
+	}
+
+	return validationErrors
+}
+
 func ValidateConfig() error {
 	var validationErrors []string
 
@@ -187,6 +927,9 @@ func ValidateConfig() error {
 	if envRedKey, exists := os.LookupEnv(EnvPrefix + "RED_APIKEY"); exists {
 		redApiKey = envRedKey
 	}
+	if redApiKey == "" && len(viper.GetStringSlice("indexer_keys.red_apikeys")) > 0 {
+		redApiKey = viper.GetStringSlice("indexer_keys.red_apikeys")[0]
+	}
 
 	opsApiKey := viper.GetString("indexer_keys.ops_apikey")
 	if envOpsKey, exists := os.LookupEnv(EnvPrefix + "OPS_APIKEY"); exists {
@@ -217,6 +960,117 @@ func ValidateConfig() error {
 		validationErrors = append(validationErrors, "Server port is required either in config or as a positive integer environment variable.")
 	}
 
+	if status := viper.GetInt("server.success_status"); status != 0 && (status < 200 || status > 299) {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid success_status %d, must be a 2xx status code", status))
+	}
+
+	validationErrors = append(validationErrors, validateStatusCodes()...)
+
+	defaultIndexer := viper.GetString("server.default_indexer")
+	if defaultIndexer != "" && defaultIndexer != "redacted" && defaultIndexer != "ops" {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid default indexer '%s', must be either 'redacted' or 'ops'", defaultIndexer))
+	}
+
+	logOutput := viper.GetString("logs.output")
+	if envOutput, exists := os.LookupEnv(EnvPrefix + "LOGS_OUTPUT"); exists {
+		logOutput = envOutput
+	}
+	switch logOutput {
+	case "", LogOutputStdout, LogOutputFile:
+	case LogOutputSyslog:
+		if runtime.GOOS == "windows" {
+			validationErrors = append(validationErrors, "Log output 'syslog' is not supported on Windows")
+		}
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid log output '%s', must be one of: %s, %s, %s", logOutput, LogOutputStdout, LogOutputFile, LogOutputSyslog))
+	}
+
+	if viper.GetInt("api.max_concurrent_per_indexer") < 0 {
+		validationErrors = append(validationErrors, "max_concurrent_per_indexer cannot be negative")
+	}
+
+	if mode := viper.GetString("api.ratelimit_mode"); mode != "" && mode != RateLimitWait && mode != RateLimitReject {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid ratelimit_mode '%s', must be either '%s' or '%s'", mode, RateLimitWait, RateLimitReject))
+	}
+
+	if interval := viper.GetDuration("api.min_refetch_interval"); interval < 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid min_refetch_interval '%s', must not be negative", interval))
+	}
+
+	if interval := viper.GetDuration("api.limiter_log_interval"); interval < 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid limiter_log_interval '%s', must not be negative", interval))
+	}
+
+	if window := viper.GetDuration("api.degraded_after"); window < 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid degraded_after '%s', must not be negative", window))
+	}
+
+	validationErrors = append(validationErrors, validateSizeRange()...)
+
+	// Neither tracker sends the featured flag, so the filter would reject
+	// every release. Only mock fixtures can carry it.
+	if viper.GetBool("filters.require_featured") && !viper.GetBool("mock.enabled") {
+		validationErrors = append(validationErrors, "Invalid require_featured in [filters], neither redacted nor ops reports featured releases, so every release would be rejected")
+	}
+
+	for _, key := range []string{"server.allowed_ips", "server.trusted_proxies"} {
+		if _, err := ParseIPPrefixes(viper.GetStringSlice(key)); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid %s %v", strings.TrimPrefix(key, "server."), err))
+		}
+	}
+
+	var brackets []RatioBracket
+	if err := viper.UnmarshalKey("ratio.brackets", &brackets); err != nil {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid ratio brackets: %v", err))
+	} else if _, err := ParseRatioBrackets(brackets); err != nil {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid %v", err))
+	}
+
+	if interval := viper.GetDuration("ratio.poll_interval"); interval != 0 && interval < time.Minute {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid ratio poll_interval '%s', must be 0 or at least 1m", interval))
+	}
+
+	for _, window := range viper.GetStringSlice("schedule.allow_windows") {
+		if _, err := ParseTimeWindow(window); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid schedule: %v", err))
+		}
+	}
+	if timezone := viper.GetString("schedule.timezone"); timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid schedule timezone '%s': %v", timezone, err))
+		}
+	}
+
+	if threshold := viper.GetFloat64("score.threshold"); threshold < 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid score threshold '%g', must not be negative", threshold))
+	} else if threshold == 0 && viper.GetBool("score.enabled") {
+		// A threshold of 0 is always reached, so every release would pass.
+		validationErrors = append(validationErrors, "Invalid score threshold '0', must be above 0 when scoring is enabled")
+	}
+	for hook := range viper.GetStringMap("score.weights") {
+		if weight := viper.GetFloat64("score.weights." + hook); weight < 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid score weight '%g' for '%s', must not be negative", weight, hook))
+		}
+	}
+
+	if epsilon := viper.GetFloat64("ratio.epsilon"); epsilon < 0 || epsilon >= 0.01 {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid ratio epsilon '%g', must be at least 0 and below 0.01", epsilon))
+	}
+
+	if mode := viper.GetString("filters.torrent_name_mode"); mode != "" && mode != TorrentNameWarn && mode != TorrentNameReject {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid torrent_name_mode '%s', must be either '%s' or '%s'", mode, TorrentNameWarn, TorrentNameReject))
+	}
+
+	if matchOn := viper.GetString("uploaders.match_on"); matchOn != "" && matchOn != MatchOnUploader && matchOn != MatchOnEditor {
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid uploaders match_on '%s', must be either '%s' or '%s'", matchOn, MatchOnUploader, MatchOnEditor))
+	}
+
+	for _, field := range viper.GetStringSlice("filters.require_complete_metadata") {
+		if !IsMetadataField(field) {
+			validationErrors = append(validationErrors, fmt.Sprintf("Invalid require_complete_metadata field '%s', must be one of: %s", field, strings.Join(MetadataFields, ", ")))
+		}
+	}
+
 	if len(validationErrors) > 0 {
 		return errors.New(strings.Join(validationErrors, "; "))
 	}
@@ -1,34 +1,146 @@
 package config
 
-import "github.com/inhies/go-bytesize"
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
-var config Config
+	"github.com/inhies/go-bytesize"
+)
+
+// current holds the active config. A reload unmarshals into a new Config and
+// swaps the pointer, so a reader holding a *Config never sees a half-applied
+// reload.
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(&Config{})
+}
 
 type Config struct {
-	IndexerKeys   IndexerKeys   `mapstructure:"indexer_keys"`
-	Authorization Authorization `mapstructure:"authorization"`
-	UserIDs       UserIDs       `mapstructure:"userid"`
-	Ratio         Ratio         `mapstructure:"ratio"`
-	SizeCheck     SizeCheck     `mapstructure:"sizecheck"`
-	ParsedSizes   ParsedSizeCheck
-	Uploaders     Uploaders    `mapstructure:"uploaders"`
-	RecordLabels  RecordLabels `mapstructure:"record_labels"`
-	Logs          Logs         `mapstructure:"logs"`
-	Server        Server       `mapstructure:"server"`
+	IndexerKeys     IndexerKeys   `mapstructure:"indexer_keys"`
+	Authorization   Authorization `mapstructure:"authorization"`
+	UserIDs         UserIDs       `mapstructure:"userid"`
+	Ratio           Ratio         `mapstructure:"ratio"`
+	SizeCheck       SizeCheck     `mapstructure:"sizecheck"`
+	Quota           Quota         `mapstructure:"quota"`
+	Schedule        Schedule      `mapstructure:"schedule"`
+	Score           Score         `mapstructure:"score"`
+	ParsedSizes     ParsedSizeCheck
+	RatioBrackets   []ParsedRatioBracket
+	ParsedSchedule  ParsedSchedule
+	AllowedIPs      []netip.Prefix    // Parsed server.allowed_ips
+	TrustedProxies  []netip.Prefix    // Parsed server.trusted_proxies
+	Leechers        Leechers          `mapstructure:"leechers"`
+	Seeders         Seeders           `mapstructure:"seeders"`
+	Artists         Artists           `mapstructure:"artists"`
+	Tracks          Tracks            `mapstructure:"tracks"`
+	Bitrate         Bitrate           `mapstructure:"bitrate"`
+	Filters         Filters           `mapstructure:"filters"`
+	Uploaders       Uploaders         `mapstructure:"uploaders"`
+	RecordLabels    RecordLabels      `mapstructure:"record_labels"`
+	Logs            Logs              `mapstructure:"logs"`
+	Server          Server            `mapstructure:"server"`
+	API             API               `mapstructure:"api"`
+	Mock            Mock              `mapstructure:"mock"`
+	DecisionWebhook DecisionWebhook   `mapstructure:"decision_webhook"`
+	Analytics       Analytics         `mapstructure:"analytics"`
+	Integrations    Integrations      `mapstructure:"integrations"`
+	RequestAliases  map[string]string `mapstructure:"request_aliases"`
+	Presets         map[string]Preset `mapstructure:"presets"`
+	Messages        map[string]string `mapstructure:"messages"`     // Custom response bodies keyed by hook name
+	StatusCodes     map[string]int    `mapstructure:"status_codes"` // Custom rejection status codes keyed by hook name
 }
 
 type Server struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host           string `mapstructure:"host"`
+	Port           int    `mapstructure:"port"`
+	DefaultIndexer string `mapstructure:"default_indexer"`
+	MaxHooks       int    `mapstructure:"max_hooks"`      // Max filters a single request may enable, 0 is unlimited
+	SuccessStatus  int    `mapstructure:"success_status"` // Status code for approved releases, must be 2xx
+
+	CollectAllReasons bool `mapstructure:"collect_all_reasons"` // Run every filter and report all rejections instead of stopping at the first
+	StrictRequest     bool `mapstructure:"strict_request"`      // Reject requests with fields that are neither known nor an alias
+	RejectHeaders     bool `mapstructure:"reject_headers"`      // Set X-Reject-Reason and X-Reject-Detail on rejections
+	QuietRejections   bool `mapstructure:"quiet_rejections"`    // Answer rejections with the status code and an empty body
+	IncludeRelease    bool `mapstructure:"include_release"`     // Return the fetched release metadata as JSON on approval
+	Maintenance       bool `mapstructure:"maintenance"`         // Answer every hook request with 503 without checking it
+
+	AllowedIPs     []string `mapstructure:"allowed_ips"`     // IPs or CIDRs allowed to call the hook endpoints, empty allows all
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // Proxies whose X-Forwarded-For is used to find the client IP
+}
+
+type API struct {
+	Timeout         time.Duration `mapstructure:"timeout"`           // Timeout for each tracker API call
+	Jitter          time.Duration `mapstructure:"jitter"`            // Max random delay before each tracker API call
+	MaxResponseSize string        `mapstructure:"max_response_size"` // Max accepted size of a tracker API response
+	RateLimitMode   string        `mapstructure:"ratelimit_mode"`    // "wait" blocks until the limiter allows a call, "reject" fails at once
+
+	MaxConcurrentPerIndexer int  `mapstructure:"max_concurrent_per_indexer"` // Max API calls in flight per indexer, 0 is unlimited
+	ExposeUpstreamErrors    bool `mapstructure:"expose_upstream_errors"`     // Return the tracker's error status and message in 500 responses
+
+	AuthScheme    string        `mapstructure:"auth_scheme"`    // Prefix for the API key in the Authorization header, eg. "token "
+	DegradedAfter time.Duration `mapstructure:"degraded_after"` // Report an indexer as degraded when failing without a success for this long
+
+	AllowAPIBaseOverride bool          `mapstructure:"allow_api_base_override"` // Honor api_base in requests, eg. for a staging tracker
+	LimiterLogInterval   time.Duration `mapstructure:"limiter_log_interval"`    // Log the rate limiter state this often at debug level, 0 disables
+	MinRefetchInterval   time.Duration `mapstructure:"min_refetch_interval"`    // Least time between live fetches of the same lookup, 0 disables
+}
+
+// Log outputs for Logs.Output. The file output also logs to the console.
+const (
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputSyslog = "syslog"
+)
+
+// Rate limit modes for API.RateLimitMode.
+const (
+	RateLimitWait   = "wait"
+	RateLimitReject = "reject"
+)
+
+// Analytics is read once at startup, changing it needs a restart.
+type Analytics struct {
+	SQLitePath string `mapstructure:"sqlite_path"` // Every decision is stored in this SQLite database, empty disables
+}
+
+// Integrations are optional connections to the user's other tools.
+type Integrations struct {
+	QBittorrent QBittorrent `mapstructure:"qbittorrent"`
+}
+
+// QBittorrent is a qBittorrent Web UI checked for releases that are already
+// in the client.
+type QBittorrent struct {
+	URL      string `mapstructure:"url"` // Empty disables the duplicate check
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+type DecisionWebhook struct {
+	URL     string        `mapstructure:"url"`     // Decisions are POSTed here as JSON, empty disables
+	Timeout time.Duration `mapstructure:"timeout"` // Timeout for each POST
+}
+
+type Mock struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	FixturesDir string `mapstructure:"fixtures_dir"`
 }
 
 type Authorization struct {
-	APIToken string `mapstructure:"api_token"`
+	APIToken     string        `mapstructure:"api_token"`
+	ReplayWindow time.Duration `mapstructure:"replay_window"` // Require X-Timestamp and X-Nonce within this window, 0 disables
 }
 
 type IndexerKeys struct {
 	REDKey string `mapstructure:"red_apikey"`
 	OPSKey string `mapstructure:"ops_apikey"`
+
+	REDKeys []string `mapstructure:"red_apikeys"` // More RED keys, tried in order when a key is rate limited or rejected
 }
 
 type UserIDs struct {
@@ -37,30 +149,320 @@ type UserIDs struct {
 }
 
 type Ratio struct {
+	MinRatio             float64 `mapstructure:"minratio"`
+	MinUploaded          string  `mapstructure:"minuploaded"`
+	RespectRequiredRatio bool    `mapstructure:"respect_required_ratio"`  // Reject if the download would drop the ratio below the tracker's required ratio
+	Epsilon              float64 `mapstructure:"epsilon"`                 // Tolerance for ratio comparisons, absorbs float rounding at round thresholds
+	SkipRatioOnFreeleech bool    `mapstructure:"skip_ratio_on_freeleech"` // Skip the minratio check for freeleech torrents
+
+	PollInterval time.Duration `mapstructure:"poll_interval"` // Fetch user stats in the background this often, 0 fetches them per request
+
+	Brackets []RatioBracket `mapstructure:"brackets"` // minratio by torrent size, in place of MinRatio
+}
+
+// RatioBracket sets the minratio for torrents of at least MinSize.
+type RatioBracket struct {
+	MinSize  string  `mapstructure:"min_size"`
 	MinRatio float64 `mapstructure:"minratio"`
 }
 
+// ParsedRatioBracket is a RatioBracket with its size parsed.
+type ParsedRatioBracket struct {
+	MinSize  bytesize.ByteSize
+	MinRatio float64
+}
+
+// ParseRatioBrackets parses brackets and sorts them by size, smallest first.
+func ParseRatioBrackets(brackets []RatioBracket) ([]ParsedRatioBracket, error) {
+	parsed := make([]ParsedRatioBracket, 0, len(brackets))
+	for _, bracket := range brackets {
+		var size bytesize.ByteSize
+		if bracket.MinSize != "" {
+			var err error
+			if size, err = ParseByteSize(bracket.MinSize); err != nil {
+				return nil, fmt.Errorf("ratio bracket min_size '%s': %w", bracket.MinSize, err)
+			}
+		}
+		if bracket.MinRatio < 0 {
+			return nil, fmt.Errorf("ratio bracket minratio %g for '%s' must not be negative", bracket.MinRatio, bracket.MinSize)
+		}
+		parsed = append(parsed, ParsedRatioBracket{MinSize: size, MinRatio: bracket.MinRatio})
+	}
+
+	sort.SliceStable(parsed, func(i, j int) bool { return parsed[i].MinSize < parsed[j].MinSize })
+	return parsed, nil
+}
+
+// ParseIPPrefixes parses a list of CIDRs, eg. "192.168.1.0/24". A bare IP
+// stands for that single address. Entries may hold several comma-separated
+// CIDRs, as they do when set from an environment variable.
+func ParseIPPrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range strings.Split(strings.Join(entries, ","), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("IP '%s': %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("CIDR '%s': %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
 type SizeCheck struct {
-	MinSize string `mapstructure:"minsize"`
-	MaxSize string `mapstructure:"maxsize"`
+	MinSize      string `mapstructure:"minsize"`
+	MaxSize      string `mapstructure:"maxsize"`
+	DownloadPath string `mapstructure:"download_path"` // Reject torrents larger than the free space here
+	MinFree      string `mapstructure:"min_free"`      // Free space to keep on DownloadPath
 }
 
 type ParsedSizeCheck struct {
-	MinSize bytesize.ByteSize
-	MaxSize bytesize.ByteSize
+	MinSize         bytesize.ByteSize
+	MaxSize         bytesize.ByteSize
+	MinUploaded     bytesize.ByteSize
+	MaxResponseSize bytesize.ByteSize
+	MinFree         bytesize.ByteSize
+	QuotaMaxSize    bytesize.ByteSize
+	TokenMinSize    bytesize.ByteSize
+}
+
+// Quota caps the total size of approved releases in a rolling window.
+type Quota struct {
+	MaxSize string        `mapstructure:"max_size"` // Empty disables the quota
+	Window  time.Duration `mapstructure:"window"`
+}
+
+// Score replaces pass/fail with points: every passing filter adds its
+// weight, and the release is approved when the total reaches Threshold.
+type Score struct {
+	Enabled   bool               `mapstructure:"enabled"`
+	Threshold float64            `mapstructure:"threshold"`
+	Weights   map[string]float64 `mapstructure:"weights"` // Points per filter name, filters not listed are worth 1
+}
+
+// Schedule limits approvals to windows of the day, eg. "08:00-17:00".
+type Schedule struct {
+	AllowWindows []string `mapstructure:"allow_windows"` // Empty allows grabs at any time
+	Timezone     string   `mapstructure:"timezone"`      // IANA name such as "Europe/Oslo", empty uses the server's local time
+}
+
+// TimeWindow is a daily window of time, as offsets from midnight. A window
+// whose end is before its start runs past midnight.
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseTimeWindow parses a window written as "HH:MM-HH:MM".
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	startText, endText, ok := strings.Cut(s, "-")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("time window '%s' must look like 08:00-17:00", s)
+	}
+
+	var window TimeWindow
+	for _, part := range []struct {
+		text   string
+		offset *time.Duration
+	}{{startText, &window.Start}, {endText, &window.End}} {
+		clock, err := time.Parse("15:04", strings.TrimSpace(part.text))
+		if err != nil {
+			return TimeWindow{}, fmt.Errorf("time window '%s' must look like 08:00-17:00", s)
+		}
+		*part.offset = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+	return window, nil
+}
+
+// Contains reports whether the time of day of t falls inside the window,
+// including its start and excluding its end.
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// ParsedSchedule is Schedule with its windows and timezone parsed, once per
+// config load.
+type ParsedSchedule struct {
+	Windows  []TimeWindow
+	Location *time.Location // nil uses the server's local time
+}
+
+// ParseSchedule parses the windows and timezone of schedule.
+func ParseSchedule(schedule Schedule) (ParsedSchedule, error) {
+	var parsed ParsedSchedule
+	for _, text := range schedule.AllowWindows {
+		window, err := ParseTimeWindow(text)
+		if err != nil {
+			return ParsedSchedule{}, err
+		}
+		parsed.Windows = append(parsed.Windows, window)
+	}
+
+	if schedule.Timezone != "" {
+		location, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return ParsedSchedule{}, fmt.Errorf("schedule timezone '%s': %w", schedule.Timezone, err)
+		}
+		parsed.Location = location
+	}
+	return parsed, nil
+}
+
+// In returns t in the schedule's timezone.
+func (s ParsedSchedule) In(t time.Time) time.Time {
+	if s.Location == nil {
+		return t
+	}
+	return t.In(s.Location)
+}
+
+// Allows reports whether t, in the schedule's timezone, falls inside one of
+// its windows. A schedule without windows always allows.
+func (s ParsedSchedule) Allows(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+
+	t = s.In(t)
+	for _, window := range s.Windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+type Leechers struct {
+	MinLeechers int `mapstructure:"minleechers"`
+	MaxLeechers int `mapstructure:"maxleechers"`
+}
+
+type Seeders struct {
+	MinSeedersOrFreeleech int `mapstructure:"min_seeders_or_freeleech"` // Freeleech torrents pass regardless of seeders
+}
+
+type Artists struct {
+	MinArtists int `mapstructure:"minartists"`
+	MaxArtists int `mapstructure:"maxartists"`
+}
+
+// Tracks bounds the number of audio files in the torrent's file list.
+// MaxFiles caps the number of files of any kind.
+type Tracks struct {
+	MinTracks int `mapstructure:"mintracks"`
+	MaxTracks int `mapstructure:"maxtracks"`
+	MaxFiles  int `mapstructure:"maxfiles"`
+}
+
+type Bitrate struct {
+	MinBitrate    int            `mapstructure:"minbitrate"`
+	MinAvgBitrate int            `mapstructure:"min_avg_bitrate"` // Average bitrate from size and duration, in kbps
+	MaxAvgBitrate int            `mapstructure:"max_avg_bitrate"`
+	LosslessOnly  bool           `mapstructure:"lossless_only"` // Only allow Lossless and 24bit Lossless encodings
+	Encodings     map[string]int `mapstructure:"encodings"`     // Overrides for the nominal bitrate of an encoding
+}
+
+type Filters struct {
+	RejectReported          bool     `mapstructure:"reject_reported"`
+	RejectVanityHouse       bool     `mapstructure:"reject_vanity_house"`
+	RequireVerifiedLog      bool     `mapstructure:"require_verified_log"`
+	RequireRipper           string   `mapstructure:"require_ripper"`     // Log must be made with one of these rippers, eg. "EAC,XLD"
+	CueLogConsistent        bool     `mapstructure:"cue_log_consistent"` // CD rips must have both a log and a cue, or neither
+	RequireArtwork          bool     `mapstructure:"require_artwork"`
+	RequireFeatured         bool     `mapstructure:"require_featured"`
+	SkipAlreadySnatched     bool     `mapstructure:"skip_already_snatched"` // Reject torrents in the user's recent snatches
+	NeutralLeechOnly        bool     `mapstructure:"neutral_leech_only"`    // Only allow torrents where neither upload nor download counts
+	Glob                    bool     `mapstructure:"glob"`
+	RequireCompleteMetadata []string `mapstructure:"require_complete_metadata"`
+	Preset                  string   `mapstructure:"preset"`
+	DescriptionContains     string   `mapstructure:"description_contains"` // Torrent description must contain one of these keywords
+	DescriptionExcludes     string   `mapstructure:"description_excludes"` // Torrent description must contain none of these keywords
+	LineageContains         string   `mapstructure:"lineage_contains"`     // Release lineage must contain one of these keywords, if the tracker reports one
+	LineageExcludes         string   `mapstructure:"lineage_excludes"`     // Release lineage must contain none of these keywords
+	OPSRequireFlags         string   `mapstructure:"ops_require_flags"`    // Boolean fields of the OPS torrent object that must be set, OPS only
+	TorrentNameMode         string   `mapstructure:"torrent_name_mode"`    // "warn" logs a torrent name mismatch, "reject" rejects the release
+	AllowMBIDs              string   `mapstructure:"allow_mbids"`          // Release MusicBrainz ID must be one of these, if the tracker reports one
+	AllowCountries          string   `mapstructure:"allow_countries"`      // Release country must be one of these, if the tracker reports one
+	NameSourceAllow         string   `mapstructure:"name_source_allow"`    // Release name must contain one of these source tags
+	NameSourceDeny          string   `mapstructure:"name_source_deny"`     // Release name must contain none of these source tags
+	TokenEligible           bool     `mapstructure:"token_eligible"`       // Only allow torrents worth spending a freeleech token on
+	TokenMinSize            string   `mapstructure:"token_min_size"`       // Smallest torrent worth a freeleech token
+}
+
+// DefaultRatioEpsilon is the default tolerance for ratio comparisons.
+const DefaultRatioEpsilon = 1e-6
+
+// Torrent name modes for Filters.TorrentNameMode.
+const (
+	TorrentNameWarn   = "warn"
+	TorrentNameReject = "reject"
+)
+
+// Preset is a named combination of format, encoding and media conditions.
+type Preset struct {
+	Formats     []string `mapstructure:"formats"`
+	Encodings   []string `mapstructure:"encodings"`
+	Media       []string `mapstructure:"media"`
+	MinLogScore int      `mapstructure:"min_log_score"`
+	RequireCue  bool     `mapstructure:"require_cue"`
+}
+
+const (
+	MetadataCatalogueNumber = "catalogue_number"
+	MetadataYear            = "year"
+	MetadataRecordLabel     = "record_label"
+)
+
+// MetadataFields lists the fields accepted by require_complete_metadata.
+var MetadataFields = []string{MetadataCatalogueNumber, MetadataYear, MetadataRecordLabel}
+
+func IsMetadataField(field string) bool {
+	field = strings.ToLower(strings.TrimSpace(field))
+	for _, valid := range MetadataFields {
+		if field == valid {
+			return true
+		}
+	}
+	return false
 }
 
 type Uploaders struct {
 	Uploaders string `mapstructure:"uploaders"`
 	Mode      string `mapstructure:"mode"`
+	MatchOn   string `mapstructure:"match_on"` // "uploader" matches the original uploader, "editor" the last editor
 }
 
+// Uploader fields for Uploaders.MatchOn.
+const (
+	MatchOnUploader = "uploader"
+	MatchOnEditor   = "editor"
+)
+
 type RecordLabels struct {
-	RecordLabels string `mapstructure:"record_labels"`
+	RecordLabels           string `mapstructure:"record_labels"`
+	AllowLabels            string `mapstructure:"allow_labels"`             // Release must be on one of these labels
+	BlockLabels            string `mapstructure:"block_labels"`             // Release must not be on any of these, wins over AllowLabels
+	BlockCataloguePrefixes string `mapstructure:"block_catalogue_prefixes"` // Catalogue number must not start with any of these
 }
 
 type Logs struct {
 	LogLevel    string `mapstructure:"loglevel"`
+	Output      string `mapstructure:"output"` // stdout, file or syslog; empty keeps the logtofile behavior
 	LogToFile   bool   `mapstructure:"logtofile"`
 	LogFilePath string `mapstructure:"logfilepath"`
 	MaxSize     int    `mapstructure:"maxsize"`    // Max file size in MB
@@ -2,9 +2,18 @@ package config
 
 import (
 	"bytes"
+	"io"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/inhies/go-bytesize"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -79,7 +88,7 @@ func TestWatchConfigChanges(t *testing.T) {
 	assert.NoError(t, err)
 
 	InitConfig("testconfig_updated.toml")
-	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, 8080, GetConfig().Server.Port)
 
 	os.Remove("testconfig_updated.toml")
 }
@@ -125,7 +134,7 @@ func TestValidateConfigWithPartialIndexers(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupConfig()
 			err := ValidateConfig()
-			
+
 			if tt.wantErr {
 				assert.Error(t, err)
 				if tt.errMsg != "" {
@@ -137,3 +146,582 @@ func TestValidateConfigWithPartialIndexers(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigProfileOverlay(t *testing.T) {
+	viper.Reset()
+	os.Clearenv()
+	dir := t.TempDir()
+
+	baseFile := filepath.Join(dir, "config.toml")
+	assert.NoError(t, os.WriteFile(baseFile, []byte(`
+[server]
+host = "127.0.0.1"
+port = 42135
+
+[ratio]
+minratio = 0.5
+`), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "config.prod.toml"), []byte(`
+[server]
+port = 8080
+`), 0644))
+
+	os.Setenv(EnvPrefix+"PROFILE", "prod")
+	defer os.Unsetenv(EnvPrefix + "PROFILE")
+
+	setupViper(baseFile)
+	assert.Equal(t, 8080, viper.GetInt("server.port"))
+	assert.Equal(t, "127.0.0.1", viper.GetString("server.host"))
+	assert.Equal(t, 0.5, viper.GetFloat64("ratio.minratio"))
+
+	os.Setenv(EnvPrefix+"PROFILE", "missing")
+	assert.Error(t, readConfigFiles(baseFile))
+}
+
+func TestConfigMultipleFiles(t *testing.T) {
+	viper.Reset()
+	os.Clearenv()
+	dir := t.TempDir()
+
+	baseFile := filepath.Join(dir, "config.toml")
+	assert.NoError(t, os.WriteFile(baseFile, []byte(`
+[server]
+host = "127.0.0.1"
+port = 42135
+
+[authorization]
+api_token = "placeholder"
+`), 0644))
+	secretsFile := filepath.Join(dir, "secrets.toml")
+	assert.NoError(t, os.WriteFile(secretsFile, []byte(`
+[authorization]
+api_token = "${TEST_API_TOKEN}"
+`), 0644))
+	overrideFile := filepath.Join(dir, "override.toml")
+	assert.NoError(t, os.WriteFile(overrideFile, []byte(`
+[server]
+port = 8080
+`), 0644))
+
+	os.Setenv("TEST_API_TOKEN", "secret_token")
+	defer os.Unsetenv("TEST_API_TOKEN")
+
+	paths := SplitConfigPaths(baseFile + ", " + secretsFile + "," + overrideFile)
+	assert.Equal(t, []string{baseFile, secretsFile, overrideFile}, paths)
+
+	setupViper(paths[0], paths[1:]...)
+	assert.Equal(t, "127.0.0.1", viper.GetString("server.host"))
+	assert.Equal(t, 8080, viper.GetInt("server.port"))
+	assert.Equal(t, "secret_token", viper.GetString("authorization.api_token"))
+
+	assert.Error(t, readConfigFiles(baseFile, filepath.Join(dir, "missing.toml")))
+}
+
+func TestConfigDirectory(t *testing.T) {
+	viper.Reset()
+	os.Clearenv()
+	dir := t.TempDir()
+
+	baseFile := filepath.Join(dir, "config.toml")
+	assert.NoError(t, os.WriteFile(baseFile, []byte(`
+[authorization]
+api_token = "placeholder"
+`), 0644))
+
+	indexersDir := filepath.Join(dir, "indexers")
+	assert.NoError(t, os.Mkdir(indexersDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(indexersDir, "red.toml"), []byte(`
+[indexer_keys]
+red_apikey = "${TEST_RED_KEY}"
+
+[userid]
+red_user_id = 1
+`), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(indexersDir, "ops.toml"), []byte(`
+[indexer_keys]
+ops_apikey = "ops_key"
+
+[userid]
+ops_user_id = 2
+`), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(indexersDir, "notes.txt"), []byte("not config"), 0644))
+
+	os.Setenv("TEST_RED_KEY", "red_key")
+	defer os.Unsetenv("TEST_RED_KEY")
+
+	files, err := ExpandConfigPaths([]string{baseFile, indexersDir})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{baseFile, filepath.Join(indexersDir, "ops.toml"), filepath.Join(indexersDir, "red.toml")}, files)
+
+	setupViper(files[0], files[1:]...)
+	assert.Equal(t, "red_key", viper.GetString("indexer_keys.red_apikey"))
+	assert.Equal(t, "ops_key", viper.GetString("indexer_keys.ops_apikey"))
+	assert.Equal(t, 1, viper.GetInt("userid.red_user_id"))
+	assert.Equal(t, 2, viper.GetInt("userid.ops_user_id"))
+}
+
+func TestRescanConfigDirs(t *testing.T) {
+	setupTestEnv()
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.toml")
+	second := filepath.Join(dir, "b.toml")
+	assert.NoError(t, viper.WriteConfigAs(first))
+	viper.Set("server.port", 8082)
+	assert.NoError(t, viper.WriteConfigAs(second))
+	viper.Set("server.port", nil)
+
+	previousPaths, previousDirs := configPaths, configDirs
+	defer func() { configPaths, configDirs, extraConfigFiles = previousPaths, previousDirs, nil }()
+	configPaths, configDirs = []string{dir}, []string{dir}
+	viper.SetConfigFile(first)
+	handleConfigChange(fsnotify.Event{Name: second})
+	assert.Equal(t, []string{second}, extraConfigFiles)
+	assert.Equal(t, 8082, GetConfig().Server.Port)
+
+	// Removing the base file makes the next one the base, instead of failing
+	// every later reload.
+	assert.NoError(t, os.Remove(first))
+	handleConfigChange(fsnotify.Event{Name: first})
+	assert.Equal(t, second, viper.ConfigFileUsed())
+	assert.Empty(t, extraConfigFiles)
+	assert.Equal(t, 8082, GetConfig().Server.Port)
+}
+
+func TestValidateConfigRequireFeatured(t *testing.T) {
+	setupTestEnv()
+
+	viper.Set("filters.require_featured", true)
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid require_featured")
+
+	viper.Set("mock.enabled", true)
+	assert.NoError(t, ValidateConfig())
+}
+
+func TestValidateConfigDefaultIndexer(t *testing.T) {
+	setupTestEnv()
+
+	viper.Set("server.default_indexer", "redacted")
+	assert.NoError(t, ValidateConfig())
+
+	viper.Set("server.default_indexer", "ptp")
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid default indexer 'ptp'")
+}
+
+func TestValidateConfigSuccessStatus(t *testing.T) {
+	setupTestEnv()
+
+	viper.Set("server.success_status", 204)
+	assert.NoError(t, ValidateConfig())
+
+	viper.Set("server.success_status", 302)
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid success_status 302")
+}
+
+func TestValidateConfigStatusCodes(t *testing.T) {
+	setupTestEnv()
+	defer viper.Set("status_codes", nil)
+
+	viper.Set("status_codes", map[string]interface{}{"ratio": 460, "uploader": 461})
+	assert.NoError(t, ValidateConfig())
+
+	viper.Set("status_codes", map[string]interface{}{"ratio": 460, "uploader": 460})
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Status code 460 is used for both 'ratio' and 'uploader'")
+
+	viper.Set("status_codes", map[string]interface{}{"ratio": 200})
+	err = ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid status code 200 for 'ratio'")
+
+	viper.Set("status_codes", map[string]interface{}{"ratio": 503})
+	assert.Error(t, ValidateConfig())
+}
+
+func TestValidateConfigScore(t *testing.T) {
+	setupTestEnv()
+	defer viper.Set("score", nil)
+
+	viper.Set("score", map[string]interface{}{"threshold": 2.5, "weights": map[string]interface{}{"uploader": 2}})
+	assert.NoError(t, ValidateConfig())
+
+	viper.Set("score", map[string]interface{}{"threshold": -1})
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid score threshold '-1'")
+
+	viper.Set("score", map[string]interface{}{"weights": map[string]interface{}{"size": -2}})
+	err = ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid score weight '-2' for 'size'")
+
+	viper.Set("score", map[string]interface{}{"enabled": true})
+	err = ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid score threshold '0'")
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	window, err := ParseTimeWindow("08:00-17:30")
+	assert.NoError(t, err)
+	assert.Equal(t, TimeWindow{Start: 8 * time.Hour, End: 17*time.Hour + 30*time.Minute}, window)
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.True(t, window.Contains(day.Add(8*time.Hour)))
+	assert.False(t, window.Contains(day.Add(17*time.Hour+30*time.Minute)))
+
+	overnight, err := ParseTimeWindow("22:00 - 02:00")
+	assert.NoError(t, err)
+	assert.True(t, overnight.Contains(day.Add(23*time.Hour)))
+	assert.True(t, overnight.Contains(day.Add(time.Hour)))
+	assert.False(t, overnight.Contains(day.Add(12*time.Hour)))
+
+	for _, invalid := range []string{"08:00", "8-17", "25:00-26:00"} {
+		_, err := ParseTimeWindow(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseRatioBrackets(t *testing.T) {
+	brackets, err := ParseRatioBrackets([]RatioBracket{
+		{MinSize: "5GB", MinRatio: 1.0},
+		{MinSize: "", MinRatio: 0.6},
+		{MinSize: "1GiB", MinRatio: 0.8},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []ParsedRatioBracket{
+		{MinSize: 0, MinRatio: 0.6},
+		{MinSize: bytesize.GB, MinRatio: 0.8},
+		{MinSize: 5 * bytesize.GB, MinRatio: 1.0},
+	}, brackets)
+
+	_, err = ParseRatioBrackets([]RatioBracket{{MinSize: "lots", MinRatio: 1}})
+	assert.Error(t, err)
+
+	_, err = ParseRatioBrackets([]RatioBracket{{MinSize: "1GB", MinRatio: -1}})
+	assert.Error(t, err)
+}
+
+func TestValidateConfigSizeRange(t *testing.T) {
+	setupTestEnv()
+	defer viper.Set("sizecheck", nil)
+
+	viper.Set("sizecheck", map[string]interface{}{"minsize": "100MB", "maxsize": "1GB"})
+	assert.NoError(t, ValidateConfig())
+
+	viper.Set("sizecheck", map[string]interface{}{"minsize": "1GB", "maxsize": "100MB"})
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "minsize 1.00GB is greater than maxsize 100.00MB")
+
+	viper.Set("sizecheck", map[string]interface{}{"maxsize": "lots"})
+	err = ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid sizecheck maxsize 'lots'")
+}
+
+func TestValidateConfigRatioBrackets(t *testing.T) {
+	setupTestEnv()
+	defer viper.Set("ratio.brackets", nil)
+
+	viper.Set("ratio.brackets", []map[string]interface{}{{"min_size": "1GB", "minratio": 1.0}})
+	assert.NoError(t, ValidateConfig())
+
+	viper.Set("ratio.brackets", []map[string]interface{}{{"min_size": "1XB", "minratio": 1.0}})
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid ratio bracket min_size '1XB'")
+}
+
+func TestParseIPPrefixes(t *testing.T) {
+	prefixes, err := ParseIPPrefixes([]string{"127.0.0.1", " 10.1.2.3/8 ", "::1", "192.168.0.0/16,172.16.0.0/12", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+	}, prefixes)
+
+	_, err = ParseIPPrefixes([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+
+	_, err = ParseIPPrefixes([]string{"localhost"})
+	assert.Error(t, err)
+}
+
+func TestValidateConfigAllowedIPs(t *testing.T) {
+	setupTestEnv()
+	defer viper.Set("server.allowed_ips", nil)
+
+	viper.Set("server.allowed_ips", []string{"127.0.0.1", "172.16.0.0/12"})
+	assert.NoError(t, ValidateConfig())
+
+	viper.Set("server.allowed_ips", []string{"300.0.0.1"})
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid allowed_ips IP '300.0.0.1'")
+}
+
+func TestRedactedString(t *testing.T) {
+	cfg := Config{
+		Authorization: Authorization{APIToken: "aaa129cd1d66ed6fa567da2d07a5dd0e"},
+		IndexerKeys:   IndexerKeys{REDKey: "red_secret_key_1234", OPSKey: "abc"},
+		Server:        Server{Host: "127.0.0.1", Port: 42135},
+	}
+
+	out := cfg.RedactedString()
+	assert.NotContains(t, out, "aaa129cd1d66ed6fa567da2d07a5dd0e")
+	assert.NotContains(t, out, "red_secret_key_1234")
+	assert.Contains(t, out, `"APIToken":"****dd0e"`)
+	assert.Contains(t, out, `"REDKey":"****1234"`)
+	assert.Contains(t, out, `"OPSKey":"****"`)
+	assert.Contains(t, out, `"Host":"127.0.0.1"`)
+
+	// the original config must not be modified
+	assert.Equal(t, "red_secret_key_1234", cfg.IndexerKeys.REDKey)
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bytesize.ByteSize
+	}{
+		{input: "100MB", want: 100 * bytesize.MB},
+		{input: "500 GiB", want: 500 * bytesize.GB},
+		{input: "1 TiB", want: bytesize.TB},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.input)
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.want, got, tt.input)
+	}
+
+	_, err := ParseByteSize("500 apples")
+	assert.Error(t, err)
+}
+
+func TestInitConfigWithoutFile(t *testing.T) {
+	viper.Reset()
+	os.Clearenv()
+
+	os.Setenv(EnvPrefix+"API_TOKEN", "env_token")
+	os.Setenv(EnvPrefix+"OPS_APIKEY", "env_ops_key")
+	defer os.Clearenv()
+
+	InitConfig(filepath.Join(t.TempDir(), "missing.toml"))
+
+	assert.Equal(t, "127.0.0.1", viper.GetString("server.host"))
+	assert.Equal(t, 42135, viper.GetInt("server.port"))
+	assert.NoError(t, ValidateConfig())
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	setupTestEnv()
+	readAndUnmarshalConfig()
+
+	cfg := GetConfig()
+	assert.Equal(t, "red_key", cfg.IndexerKeys.REDKey)
+	assert.Equal(t, "ops_key", cfg.IndexerKeys.OPSKey)
+	assert.Equal(t, 1, cfg.UserIDs.REDUserID)
+	assert.Equal(t, 2, cfg.UserIDs.OPSUserID)
+	assert.Equal(t, 10*bytesize.MB, cfg.ParsedSizes.MinSize)
+	assert.Equal(t, "test_label", cfg.RecordLabels.RecordLabels)
+
+	path := filepath.Join(t.TempDir(), "roundtrip.toml")
+	assert.NoError(t, viper.WriteConfigAs(path))
+
+	viper.Reset()
+	viper.SetConfigFile(path)
+	assert.NoError(t, viper.ReadInConfig())
+	readAndUnmarshalConfig()
+
+	assert.Equal(t, cfg, GetConfig())
+}
+
+// TestConfigReloadRace reads the config from several goroutines while it is
+// being reloaded. Run with -race to catch unsynchronized access.
+func TestConfigReloadRace(t *testing.T) {
+	setupTestEnv()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, viper.WriteConfigAs(path))
+	viper.SetConfigFile(path)
+	readAndUnmarshalConfig()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				cfg := GetConfig()
+				if cfg.IndexerKeys.REDKey != "red_key" || cfg.ParsedSizes.MinSize != 10*bytesize.MB {
+					t.Errorf("inconsistent config snapshot: %+v", cfg.IndexerKeys)
+					return
+				}
+				_ = cfg.RedactedString()
+			}
+		}()
+	}
+
+	// Both watchers may reload at the same time.
+	var reloads sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		reloads.Add(1)
+		go func() {
+			defer reloads.Done()
+			for j := 0; j < 25; j++ {
+				handleConfigChange(fsnotify.Event{Name: path})
+			}
+		}()
+	}
+	reloads.Wait()
+	close(done)
+	wg.Wait()
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	setupTestEnv()
+	t.Setenv(EnvPrefix+"HOST", "0.0.0.0")
+	t.Setenv(EnvPrefix+"PORT", "8080")
+	t.Setenv(EnvPrefix+"API_TOKEN", "env-token")
+	t.Setenv(EnvPrefix+"RED_APIKEY", "env-red-key")
+	t.Setenv(EnvPrefix+"LOGS_MAXAGE", "not a number")
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, viper.WriteConfigAs(path))
+	viper.SetConfigFile(path)
+	readAndUnmarshalConfig()
+	stored := GetConfig()
+
+	check := func(cfg *Config) {
+		assert.Equal(t, "0.0.0.0", cfg.Server.Host)
+		assert.Equal(t, 8080, cfg.Server.Port)
+		assert.Equal(t, "env-token", cfg.Authorization.APIToken)
+		assert.Equal(t, "env-red-key", cfg.IndexerKeys.REDKey)
+		assert.Equal(t, "ops_key", cfg.IndexerKeys.OPSKey)
+		assert.Equal(t, viper.GetInt("logs.maxage"), cfg.Logs.MaxAge)
+	}
+	check(stored)
+
+	// A reload builds a fresh Config, the overrides must be applied to it too.
+	handleConfigChange(fsnotify.Event{Name: path})
+	assert.NotSame(t, stored, GetConfig())
+	check(GetConfig())
+}
+
+func TestScheduleConfigChange(t *testing.T) {
+	setupTestEnv()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, viper.WriteConfigAs(path))
+	viper.SetConfigFile(path)
+	readAndUnmarshalConfig()
+
+	viper.Set("server.port", 8081)
+	assert.NoError(t, viper.WriteConfigAs(path))
+	viper.Set("server.port", nil)
+
+	// A burst of events is folded into one reload after the debounce.
+	for i := 0; i < 5; i++ {
+		scheduleConfigChange(fsnotify.Event{Name: path})
+	}
+	assert.Eventually(t, func() bool {
+		return GetConfig().Server.Port == 8081
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		want     bool
+	}{
+		{"No windows", Schedule{}, true},
+		{"Inside window", Schedule{AllowWindows: []string{"08:00-17:00"}}, true},
+		{"Outside window", Schedule{AllowWindows: []string{"18:00-23:00"}}, false},
+		{"Any window matches", Schedule{AllowWindows: []string{"18:00-23:00", "11:00-13:00"}}, true},
+		{"Timezone", Schedule{AllowWindows: []string{"08:00-17:00"}, Timezone: "Asia/Tokyo"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.schedule)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Allows(now))
+		})
+	}
+
+	_, err := ParseSchedule(Schedule{AllowWindows: []string{"08:00"}})
+	assert.Error(t, err)
+	_, err = ParseSchedule(Schedule{Timezone: "Mars/Olympus_Mons"})
+	assert.Error(t, err)
+
+	setupTestEnv()
+	viper.Set("schedule.allow_windows", []string{"08:00-17:00"})
+	viper.Set("schedule.timezone", "Asia/Tokyo")
+	cfg, err := unmarshalConfig(&Config{})
+	assert.NoError(t, err)
+	assert.Len(t, cfg.ParsedSchedule.Windows, 1)
+	assert.Equal(t, "Asia/Tokyo", cfg.ParsedSchedule.Location.String())
+}
+
+type closeRecorder struct{ closed bool }
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestConfigureLoggerClosesPrevious(t *testing.T) {
+	previous := current.Load()
+	defer current.Store(previous)
+	defer func(logger zerolog.Logger) {
+		log.Logger = logger
+		for _, closer := range logClosers {
+			closer.Close()
+		}
+		logClosers = nil
+	}(log.Logger)
+
+	logFile := filepath.Join(t.TempDir(), "redactedhook.log")
+	current.Store(&Config{Logs: Logs{Output: LogOutputFile, LogFilePath: logFile, LogLevel: "info"}})
+
+	old := &closeRecorder{}
+	logClosers = []io.Closer{old}
+	configureLogger()
+
+	assert.True(t, old.closed, "previous log output left open")
+	assert.Len(t, logClosers, 1)
+	assert.NotSame(t, old, logClosers[0])
+}
+
+func TestLogOutput(t *testing.T) {
+	assert.Equal(t, "", logOutput(Logs{}))
+	assert.Equal(t, LogOutputFile, logOutput(Logs{LogToFile: true}))
+	assert.Equal(t, LogOutputSyslog, logOutput(Logs{Output: LogOutputSyslog, LogToFile: true}))
+
+	setupTestEnv()
+	viper.Set("logs.output", "carrier-pigeon")
+	err := ValidateConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid log output 'carrier-pigeon'")
+
+	viper.Set("logs.output", LogOutputStdout)
+	assert.NoError(t, ValidateConfig())
+}
@@ -9,31 +9,76 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// logClosers are the syslog connection and log file the current logger
+// writes to, closed once a reload replaces them. Guarded by reloadLock.
+var logClosers []io.Closer
+
 func configureLogger() {
+	cfg := GetConfig()
 	var writers []io.Writer
+	var closers []io.Closer
+	var syslogErr error
+	output := logOutput(cfg.Logs)
 
-	// always log to console
-	consoleWriter := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "2006-01-02 15:04:05"}
-	writers = append(writers, consoleWriter)
+	switch output {
+	case LogOutputStdout:
+		writers = append(writers, zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "2006-01-02 15:04:05"})
+	case LogOutputSyslog:
+		syslogWriter, syslogCloser, err := newSyslogWriter()
+		if err != nil {
+			syslogErr = err
+			writers = append(writers, zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "2006-01-02 15:04:05"})
+			break
+		}
+		writers = append(writers, syslogWriter)
+		closers = append(closers, syslogCloser)
+	default:
+		// log to console, and to a file when enabled
+		writers = append(writers, zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "2006-01-02 15:04:05"})
+	}
 
-	if config.Logs.LogToFile {
+	if output == LogOutputFile {
 		logFilePath := determineLogFilePath()
 
 		fileWriter := &lumberjack.Logger{
 			Filename:   logFilePath,
-			MaxSize:    config.Logs.MaxSize,    // megabytes
-			MaxBackups: config.Logs.MaxBackups, // number of backups
-			MaxAge:     config.Logs.MaxAge,     // days
-			Compress:   config.Logs.Compress,   // compress rolling files
+			MaxSize:    cfg.Logs.MaxSize,    // megabytes
+			MaxBackups: cfg.Logs.MaxBackups, // number of backups
+			MaxAge:     cfg.Logs.MaxAge,     // days
+			Compress:   cfg.Logs.Compress,   // compress rolling files
 		}
 		writers = append(writers, fileWriter)
+		closers = append(closers, fileWriter)
 	}
 
 	// Combine all writers
 	multiWriter := zerolog.MultiLevelWriter(writers...)
 	log.Logger = zerolog.New(multiWriter).With().Timestamp().Logger()
 
-	setLogLevel(config.Logs.LogLevel)
+	for _, closer := range logClosers {
+		if err := closer.Close(); err != nil {
+			log.Warn().Err(err).Msg("Unable to close the previous log output")
+		}
+	}
+	logClosers = closers
+
+	setLogLevel(cfg.Logs.LogLevel)
+
+	if syslogErr != nil {
+		log.Error().Err(syslogErr).Msg("Unable to log to syslog, logging to console instead")
+	}
+}
+
+// logOutput returns the configured log output. Without logs.output, the
+// older logtofile switch picks between console and file.
+func logOutput(logs Logs) string {
+	if logs.Output != "" {
+		return logs.Output
+	}
+	if logs.LogToFile {
+		return LogOutputFile
+	}
+	return ""
 }
 
 func setLogLevel(level string) {
@@ -47,7 +92,7 @@ func setLogLevel(level string) {
 }
 
 func determineLogFilePath() string {
-	logFilePath := config.Logs.LogFilePath
+	logFilePath := GetConfig().Logs.LogFilePath
 	if logFilePath == "" && isRunningInDocker() {
 		// use a sensible default log file path in Docker
 		logFilePath = "/redactedhook/redactedhook.log"
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
@@ -12,6 +13,18 @@ func isRunningInDocker() bool {
 	return err == nil
 }
 
+// SplitConfigPaths splits a comma-separated --config value into its files,
+// in the order they are merged.
+func SplitConfigPaths(configPath string) []string {
+	var paths []string
+	for _, path := range strings.Split(configPath, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 func determineConfigFile(configPath string) string {
 	if configPath != "" {
 		return configPath
@@ -34,3 +47,39 @@ func determineConfigFile(configPath string) string {
 	configFile := filepath.Join(configDir, defaultConfigFileName)
 	return configFile
 }
+
+// ExpandConfigPaths replaces every directory in paths with the *.toml files
+// it contains, sorted by name, so a directory of per-indexer files merges like
+// listing each file. Other paths are kept as they are.
+func ExpandConfigPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.toml"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			log.Warn().Msgf("Config directory %s contains no .toml files", path)
+		}
+		// Glob returns matches in lexical order already.
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// isConfigDir reports whether path is one of the directories listed in
+// --config.
+func isConfigDir(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if filepath.Clean(dir) == path {
+			return true
+		}
+	}
+	return false
+}
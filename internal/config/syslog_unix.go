@@ -0,0 +1,20 @@
+//go:build !windows
+
+package config
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// newSyslogWriter connects to the local syslog daemon, which is journald on
+// most systemd hosts. The closer ends the connection.
+func newSyslogWriter() (io.Writer, io.Closer, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "redactedhook")
+	if err != nil {
+		return nil, nil, err
+	}
+	return zerolog.SyslogLevelWriter(writer), writer, nil
+}
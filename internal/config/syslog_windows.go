@@ -0,0 +1,12 @@
+//go:build windows
+
+package config
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslogWriter() (io.Writer, io.Closer, error) {
+	return nil, nil, errors.New("syslog output is not supported on Windows")
+}